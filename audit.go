@@ -0,0 +1,130 @@
+package forge
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/log"
+	"github.com/spy16/forge/core/servio"
+)
+
+const (
+	permAuditRead = "audit:read"
+	maxAuditLimit = 200
+)
+
+// Audit records a security-relevant event in the audit log. The actor,
+// the request ID and the client IP are taken from the request context if
+// not set. Failures are logged and do not fail the request. If no audit
+// log is configured, the event is only written to the log.
+func (app *appForge) Audit(ctx context.Context, ev core.AuditEvent) {
+	ev = ev.Fill(ctx)
+
+	fields := core.M{
+		"audit":     ev.Action,
+		"actor_id":  ev.ActorID,
+		"target_id": ev.TargetID,
+	}
+	for k, v := range ev.Attribs {
+		fields[k] = v
+	}
+
+	if app.auditLog == nil {
+		log.Info(ctx, "audit: "+ev.Action, fields)
+		return
+	}
+
+	if err := app.auditLog.Append(ctx, ev); err != nil {
+		fields["error"] = err.Error()
+		log.Warn(ctx, "failed to record audit event", fields)
+	}
+}
+
+// onLogin records a login of the session user using the method and
+// cancels the pending deletion of the user account if any.
+func (app *appForge) onLogin(ctx context.Context, sess *core.Session, method string) {
+	app.restoreUser(ctx, sess)
+	app.Audit(ctx, core.AuditEvent{
+		Action:   "login",
+		ActorID:  sess.User.ID,
+		TargetID: sess.User.ID,
+		Attribs: core.M{
+			"method":     method,
+			"session_id": sess.ID,
+			"partial":    sess.Partial,
+			"mfa":        sess.MFA,
+		},
+	})
+}
+
+// auditLoginFailure records a failed login attempt. Malformed requests and
+// internal failures are not recorded. targetID is the user the attempt was
+// made for if known.
+func (app *appForge) auditLoginFailure(ctx context.Context, targetID, method string, err error, attribs core.M) {
+	if !errors.OneOf(err, []error{errors.MissingAuth, errors.NotFound, errors.Throttled, errors.Forbidden}) {
+		return
+	}
+
+	fields := core.M{"method": method, "reason": errors.E(err).Code}
+	for k, v := range attribs {
+		fields[k] = v
+	}
+	app.Audit(ctx, core.AuditEvent{
+		Action:   "login.failed",
+		TargetID: targetID,
+		Attribs:  fields,
+	})
+}
+
+func (app *appForge) auditRoutes(r chi.Router) {
+	r.Use(app.Authenticate(), denyAPIKeys, app.Authorize(permAuditRead))
+
+	// list the events newest first. 'next' is the cursor to be passed as
+	// 'before' to get the next page.
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		q := core.AuditQuery{
+			Action:   params.Get("action"),
+			ActorID:  params.Get("actor_id"),
+			TargetID: params.Get("target_id"),
+			Limit:    50,
+		}
+
+		if s := params.Get("limit"); s != "" {
+			limit, err := strconv.Atoi(s)
+			if err != nil || limit <= 0 || limit > maxAuditLimit {
+				servio.JSONErr(w, r, errors.InvalidInput.Hintf("limit must be between 1 and %d", maxAuditLimit))
+				return
+			}
+			q.Limit = limit
+		}
+
+		if s := params.Get("before"); s != "" {
+			before, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || before <= 0 {
+				servio.JSONErr(w, r, errors.InvalidInput.Hintf("before must be an event id"))
+				return
+			}
+			q.Before = before
+		}
+
+		events, err := app.auditLog.List(r.Context(), q)
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		res := core.M{"events": events}
+		if events == nil {
+			res["events"] = []core.AuditEvent{}
+		} else if len(events) == q.Limit {
+			res["next"] = strconv.FormatInt(events[len(events)-1].ID, 10)
+		}
+		servio.JSON(w, r, http.StatusOK, res)
+	})
+}
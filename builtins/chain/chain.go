@@ -0,0 +1,109 @@
+package chain
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+// Matcher returns true if the token may be handled by a backend.
+type Matcher func(token string) bool
+
+// Backend is an auth module in the chain.
+type Backend struct {
+	Name string
+	Auth core.Auth
+
+	// Match can be set to try the backend only for matching tokens. If
+	// nil, the backend is tried for all tokens.
+	Match Matcher
+}
+
+// Auth implements an auth module that delegates to multiple backends.
+// Backends matching the token are tried in order. errors.MissingAuth,
+// errors.NotFound and errors.InvalidInput from a backend are treated as
+// rejection of the token and the next backend is tried. errors.Conflict
+// and errors.Forbidden (e.g., the identity cannot be linked to an existing
+// account) are returned as is. Any other failure is returned immediately
+// as errors.InternalIssue.
+type Auth struct {
+	Backends []Backend
+}
+
+func (ch *Auth) Authenticate(ctx context.Context, token string) (*core.Session, error) {
+	lastErr := errors.MissingAuth.Hintf("no auth backend accepted the token")
+
+	for _, b := range ch.Backends {
+		if b.Match != nil && !b.Match(token) {
+			continue
+		}
+
+		sess, err := b.Auth.Authenticate(ctx, token)
+		if err == nil {
+			return sess, nil
+		}
+
+		rejections := []error{errors.MissingAuth, errors.NotFound, errors.InvalidInput}
+		if errors.OneOf(err, rejections) {
+			lastErr = errors.MissingAuth.CausedBy(err).Hintf("auth backend '%s' rejected the token", b.Name)
+			continue
+		} else if errors.OneOf(err, []error{errors.Conflict, errors.Forbidden, errors.InternalIssue}) {
+			return nil, err
+		}
+		return nil, errors.InternalIssue.CausedBy(err).Hintf("auth backend '%s' failed", b.Name)
+	}
+
+	return nil, lastErr
+}
+
+// Unwrap returns the auth modules of all backends in order.
+func (ch *Auth) Unwrap() []core.Auth {
+	res := make([]core.Auth, 0, len(ch.Backends))
+	for _, b := range ch.Backends {
+		res = append(res, b.Auth)
+	}
+	return res
+}
+
+// Prefix matches tokens with the given prefix.
+func Prefix(prefix string) Matcher {
+	return func(token string) bool { return strings.HasPrefix(token, prefix) }
+}
+
+// Issuer matches JWTs whose 'iss' claim is one of the given values. The
+// token signature is NOT verified here; that is left to the backend.
+func Issuer(issuers ...string) Matcher {
+	return func(token string) bool {
+		iss := peekIssuer(token)
+		for _, want := range issuers {
+			if iss != "" && iss == want {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func peekIssuer(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	return claims.Issuer
+}
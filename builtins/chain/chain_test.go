@@ -0,0 +1,83 @@
+package chain_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/builtins/chain"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+func TestAuth_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	fakeJWT := func(iss string) string {
+		payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"iss":%q}`, iss)))
+		return "e30." + payload + ".sig"
+	}
+
+	ch := &chain.Auth{
+		Backends: []chain.Backend{
+			{Name: "a", Auth: stubAuth{"a-token": "alice"}, Match: chain.Issuer("https://a")},
+			{Name: "b", Auth: stubAuth{"b-token": "bob"}, Match: chain.Prefix("b-")},
+			{Name: "fallback", Auth: stubAuth{fakeJWT("https://a"): "carol"}},
+			{Name: "malformed", Auth: failingAuth{errors.InvalidInput}, Match: chain.Prefix("malformed")},
+			{Name: "forbidden", Auth: failingAuth{errors.Forbidden}, Match: chain.Prefix("forbidden")},
+			{Name: "conflict", Auth: failingAuth{errors.Conflict.Coded("account_exists")}, Match: chain.Prefix("conflict")},
+			{Name: "broken", Auth: failingAuth{fmt.Errorf("connection refused")}, Match: chain.Prefix("broken")},
+		},
+	}
+
+	table := []struct {
+		title   string
+		token   string
+		want    string
+		wantErr error
+	}{
+		{title: "MatchByIssuer", token: fakeJWT("https://a"), want: "carol"},
+		{title: "MatchByPrefix", token: "b-token", want: "bob"},
+		{title: "NoBackendAccepts", token: "unknown", wantErr: errors.MissingAuth},
+		{title: "IssuerMismatch", token: fakeJWT("https://other"), wantErr: errors.MissingAuth},
+		{title: "InvalidToken", token: "malformed-token", wantErr: errors.MissingAuth},
+		{title: "Forbidden", token: "forbidden-token", wantErr: errors.Forbidden},
+		{title: "Conflict", token: "conflict-token", wantErr: errors.Conflict},
+		{title: "RealFailure", token: "broken-token", wantErr: errors.InternalIssue},
+	}
+
+	for _, tt := range table {
+		tt := tt
+		t.Run(tt.title, func(t *testing.T) {
+			sess, err := ch.Authenticate(context.Background(), tt.token)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, sess.User.ID)
+		})
+	}
+
+	assert.Len(t, ch.Unwrap(), 7)
+}
+
+type stubAuth map[string]string
+
+func (sa stubAuth) Authenticate(_ context.Context, token string) (*core.Session, error) {
+	id, found := sa[token]
+	if !found {
+		return nil, errors.MissingAuth
+	}
+	return &core.Session{User: core.User{ID: id}, Token: token}, nil
+}
+
+type failingAuth struct{ err error }
+
+func (fa failingAuth) Authenticate(context.Context, string) (*core.Session, error) {
+	return nil, fa.err
+}
@@ -12,6 +12,7 @@ type tokClaims struct {
 	Audience  string `json:"aud"`
 	IssuedAt  int64  `json:"iat"`
 	ExpiresAt int64  `json:"exp"`
+	AuthTime  int64  `json:"auth_time"`
 
 	Name          string `json:"name"`
 	Email         string `json:"email"`
@@ -11,9 +11,12 @@ import (
 	"github.com/spy16/forge/core/errors"
 )
 
-// Auth implements auth module for firebase-based user management.
+// Auth implements auth module for firebase-based user management. If
+// Users is set, the identity is persisted in the registry on every
+// successful authentication.
 type Auth struct {
 	keys      KeySource
+	Users     core.UserRegistry
 	ProjectID string
 }
 
@@ -34,9 +37,10 @@ func (au *Auth) Authenticate(ctx context.Context, token string) (*core.Session,
 	}
 
 	return &core.Session{
-		User:   *localUser,
-		Token:  token,
-		Expiry: time.Unix(claims.ExpiresAt, 0),
+		User:     *localUser,
+		Token:    token,
+		Expiry:   time.Unix(claims.ExpiresAt, 0),
+		AuthTime: time.Unix(claims.AuthTime, 0),
 	}, nil
 }
 
@@ -59,7 +63,16 @@ func (au *Auth) upsertLocalUser(ctx context.Context, claims tokClaims) (*core.Us
 		u.VerifiedAt = &now
 	}
 
-	return &u, nil
+	if au.Users == nil {
+		return &u, nil
+	}
+
+	local, err := core.UpsertIdentity(ctx, au.Users, core.NewAuthKey("firebase", claims.Subject), u)
+	if err != nil {
+		return nil, err
+	}
+	safe := local.Clone(true)
+	return &safe, nil
 }
 
 func (au *Auth) keyFunc(token *jwt.Token) (interface{}, error) {
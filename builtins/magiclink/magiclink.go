@@ -0,0 +1,294 @@
+package magiclink
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/log"
+	"github.com/spy16/forge/core/session"
+	"github.com/spy16/forge/core/strutils"
+)
+
+const (
+	tokenKindLink     = "magic_link"
+	tokenKindCode     = "magic_code"
+	tokenKindThrottle = "magic_throttle"
+
+	defaultTTL      = 15 * time.Minute
+	defaultCooldown = time.Minute
+	maxCodeFailures = 5
+)
+
+const mailBody = `Hello,
+
+Visit the link below to log in:
+
+%s
+
+Or enter this code on the login page: %s
+
+The link and the code expire at %s. If you did not request
+this, ignore this email.
+`
+
+var (
+	errBadToken = errors.InvalidInput.Coded("invalid_token")
+	errBadCode  = errors.InvalidInput.Coded("invalid_code")
+)
+
+// Auth implements passwordless login via email. Each login request mails
+// a single-use link and a 6-digit code of which either can be redeemed
+// once for a session. Requesting a new login invalidates the previous
+// link and code. Wrong codes are limited per request and login requests
+// are throttled per email.
+type Auth struct {
+	Users    core.UserRegistry
+	Tokens   core.TokenStore
+	Mailer   core.Mailer
+	Sessions *session.Issuer
+
+	// LinkURL is the redemption endpoint or page. The token is added to
+	// it as the 'token' query parameter.
+	LinkURL string
+
+	// TTL is the lifetime of the link and the code. Cooldown is the min
+	// interval between login mails to the same email.
+	TTL      time.Duration
+	Cooldown time.Duration
+
+	// Signup creates users with unknown emails on their first login. If
+	// not set, login requests for unknown emails are silently ignored.
+	Signup bool
+}
+
+// Send mails a login link and code to the email. The redirect is kept
+// with the link and returned when it is redeemed. To avoid revealing
+// which emails are registered, the mail is sent in the background and
+// neither the result nor the timing depends on the email being known.
+// Failures are logged.
+func (ma *Auth) Send(ctx context.Context, email, redirect string) error {
+	email = normalizeEmail(email)
+	if !strutils.IsValidEmail(email) {
+		return errors.InvalidInput.Coded("invalid_email").Hintf("email is not valid")
+	}
+	emailHash := core.HashToken(email)
+
+	if err := ma.throttle(ctx, emailHash); err != nil {
+		return err
+	}
+
+	bgCtx := core.NewCtx(context.Background(), core.FromCtx(ctx))
+	go func() {
+		if err := ma.send(bgCtx, email, emailHash, redirect); err != nil {
+			log.Warn(bgCtx, "failed to send magic link mail", core.M{"error": err.Error()})
+		}
+	}()
+	return nil
+}
+
+func (ma *Auth) send(ctx context.Context, email, emailHash, redirect string) error {
+	if !ma.Signup {
+		_, err := ma.Users.Get(ctx, core.NewAuthKey(core.KeyKindEmail, email))
+		if errors.Is(err, errors.NotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// invalidate the link and code of the previous request.
+	if prev, err := ma.Tokens.Take(ctx, tokenKindCode, emailHash); err == nil {
+		linkHash, _ := prev.Attribs["link"].(string)
+		_, _ = ma.Tokens.Take(ctx, tokenKindLink, linkHash)
+	}
+
+	raw, link := core.NewToken(tokenKindLink, "", ma.ttl())
+	link.Attribs = core.M{"email": email, "redirect": redirect}
+
+	code, err := newCode()
+	if err != nil {
+		return err
+	}
+	codeTok := core.Token{
+		Kind:      tokenKindCode,
+		Hash:      emailHash,
+		Attribs:   core.M{"code": core.HashToken(code), "link": link.Hash, "email": email},
+		ExpiresAt: link.ExpiresAt,
+	}
+
+	if err := ma.Tokens.Put(ctx, link); err != nil {
+		return err
+	} else if err := ma.Tokens.Put(ctx, codeTok); err != nil {
+		return err
+	}
+
+	linkURL, err := url.Parse(ma.LinkURL)
+	if err != nil {
+		return errors.InternalIssue.CausedBy(err).Hintf("invalid magic link url")
+	}
+	q := linkURL.Query()
+	q.Set("token", raw)
+	linkURL.RawQuery = q.Encode()
+
+	return ma.Mailer.Send(ctx, core.Mail{
+		To:      []string{email},
+		Subject: "Your login link",
+		Body:    fmt.Sprintf(mailBody, linkURL, code, link.ExpiresAt.Format(time.RFC1123)),
+	})
+}
+
+// RedeemLink exchanges the token from the login link for a session and
+// returns the redirect given when the link was requested.
+func (ma *Auth) RedeemLink(ctx context.Context, token string) (*core.Session, string, error) {
+	link, err := ma.Tokens.Take(ctx, tokenKindLink, core.HashToken(token))
+	if err != nil {
+		if errors.Is(err, errors.NotFound) {
+			return nil, "", errBadToken.Hintf("unknown or expired token")
+		}
+		return nil, "", err
+	}
+	email, _ := link.Attribs["email"].(string)
+	redirect, _ := link.Attribs["redirect"].(string)
+
+	// the code of the same request must not be usable anymore.
+	_, _ = ma.Tokens.Take(ctx, tokenKindCode, core.HashToken(normalizeEmail(email)))
+
+	sess, err := ma.login(ctx, email)
+	if err != nil {
+		return nil, "", err
+	}
+	return sess, redirect, nil
+}
+
+// RedeemCode exchanges the code mailed to the email for a session. After
+// too many wrong codes, the request is invalidated and a new login must
+// be requested.
+func (ma *Auth) RedeemCode(ctx context.Context, email, code string) (*core.Session, error) {
+	email = normalizeEmail(email)
+	emailHash := core.HashToken(email)
+
+	tok, err := ma.Tokens.Take(ctx, tokenKindCode, emailHash)
+	if err != nil {
+		if errors.Is(err, errors.NotFound) {
+			return nil, errBadCode.Hintf("unknown or expired code")
+		}
+		return nil, err
+	}
+
+	want, _ := tok.Attribs["code"].(string)
+	got := core.HashToken(strings.TrimSpace(code))
+	if subtle.ConstantTimeCompare([]byte(want), []byte(got)) != 1 {
+		// attribs may have been through a json round-trip.
+		failures := 0
+		switch n := tok.Attribs["failures"].(type) {
+		case int:
+			failures = n
+		case float64:
+			failures = int(n)
+		}
+
+		if failures+1 < maxCodeFailures {
+			tok.Attribs["failures"] = failures + 1
+			if err := ma.Tokens.Put(ctx, *tok); err != nil {
+				return nil, err
+			}
+			return nil, errBadCode.Hintf("code is not valid")
+		}
+
+		linkHash, _ := tok.Attribs["link"].(string)
+		_, _ = ma.Tokens.Take(ctx, tokenKindLink, linkHash)
+		return nil, errors.Throttled.Coded("too_many_attempts").Hintf("too many wrong codes, request a new login")
+	}
+
+	linkHash, _ := tok.Attribs["link"].(string)
+	_, _ = ma.Tokens.Take(ctx, tokenKindLink, linkHash)
+
+	storedEmail, _ := tok.Attribs["email"].(string)
+	return ma.login(ctx, storedEmail)
+}
+
+// login issues a session for the user with the email. The user is created
+// if signup is enabled. Redeeming the link or code proves the ownership
+// of the email and hence the email is marked as verified.
+func (ma *Auth) login(ctx context.Context, email string) (*core.Session, error) {
+	u, err := ma.Users.Get(ctx, core.NewAuthKey(core.KeyKindEmail, email))
+	if err != nil {
+		if !errors.Is(err, errors.NotFound) {
+			return nil, err
+		} else if !ma.Signup {
+			return nil, errBadToken.Hintf("user no longer exists")
+		}
+		newUser := core.NewUser("magic_link", "", email)
+		u = &newUser
+	}
+
+	if u.VerifiedAt == nil {
+		now := time.Now()
+		u.VerifiedAt = &now
+		u.VerifyToken = nil
+		if u, err = ma.Users.Upsert(ctx, *u); err != nil {
+			return nil, err
+		}
+	}
+
+	return ma.Sessions.Issue(ctx, *u)
+}
+
+// throttle allows one login request per cooldown for the email.
+func (ma *Auth) throttle(ctx context.Context, emailHash string) error {
+	errThrottled := errors.Throttled.Coded("magic_link_throttled").Hintf("login was requested recently, retry later")
+
+	if marker, err := ma.Tokens.Take(ctx, tokenKindThrottle, emailHash); err == nil {
+		_ = ma.Tokens.Put(ctx, *marker)
+		return errThrottled
+	} else if !errors.Is(err, errors.NotFound) {
+		return err
+	}
+
+	cooldown := ma.Cooldown
+	if cooldown <= 0 {
+		cooldown = defaultCooldown
+	}
+
+	marker := core.Token{
+		Kind:      tokenKindThrottle,
+		Hash:      emailHash,
+		ExpiresAt: time.Now().Add(cooldown),
+	}
+	if err := ma.Tokens.Put(ctx, marker); err != nil {
+		if errors.Is(err, errors.Conflict) {
+			return errThrottled
+		}
+		return err
+	}
+	return nil
+}
+
+// normalizeEmail returns the form of the email used for the throttle,
+// the tokens and the user lookups.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func (ma *Auth) ttl() time.Duration {
+	if ma.TTL <= 0 {
+		return defaultTTL
+	}
+	return ma.TTL
+}
+
+func newCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
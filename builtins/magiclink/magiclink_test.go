@@ -0,0 +1,193 @@
+package magiclink_test
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/builtins/magiclink"
+	"github.com/spy16/forge/builtins/memstore"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/session"
+)
+
+var codePattern = regexp.MustCompile(`code on the login page: (\d{6})`)
+
+func TestAuth_RedeemLink(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ma := newAuth(t)
+
+	// emails are normalized so that the casing does not create duplicates.
+	require.NoError(t, ma.Send(ctx, " Bob@BobMail.com", "/home"))
+	token, code := lastMail(t, ma, 1)
+
+	sess, redirect, err := ma.RedeemLink(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "/home", redirect)
+	assert.Equal(t, "bob@bobmail.com", sess.User.Email)
+	assert.NotNil(t, sess.User.VerifiedAt)
+
+	// link is single-use and invalidates the code.
+	_, _, err = ma.RedeemLink(ctx, token)
+	assert.ErrorIs(t, err, errors.InvalidInput)
+	_, err = ma.RedeemCode(ctx, "bob@bobmail.com", code)
+	assert.ErrorIs(t, err, errors.InvalidInput)
+
+	// second login resolves to the same user.
+	require.NoError(t, ma.Send(ctx, "bob@bobmail.com", ""))
+	token, _ = lastMail(t, ma, 2)
+	again, _, err := ma.RedeemLink(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, sess.User.ID, again.User.ID)
+}
+
+func TestAuth_RedeemCode(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ma := newAuth(t)
+
+	require.NoError(t, ma.Send(ctx, "bob@bobmail.com", ""))
+	oldToken, oldCode := lastMail(t, ma, 1)
+
+	// a new request invalidates the previous link and code.
+	require.NoError(t, ma.Send(ctx, "bob@bobmail.com", ""))
+	token, code := lastMail(t, ma, 2)
+	_, _, err := ma.RedeemLink(ctx, oldToken)
+	assert.ErrorIs(t, err, errors.InvalidInput)
+	if oldCode != code {
+		_, err = ma.RedeemCode(ctx, "bob@bobmail.com", oldCode)
+		assert.ErrorIs(t, err, errors.InvalidInput)
+	}
+
+	sess, err := ma.RedeemCode(ctx, "Bob@BobMail.com", code)
+	require.NoError(t, err)
+	assert.Equal(t, "bob@bobmail.com", sess.User.Email)
+
+	_, _, err = ma.RedeemLink(ctx, token)
+	assert.ErrorIs(t, err, errors.InvalidInput)
+
+	t.Run("TooManyAttempts", func(t *testing.T) {
+		require.NoError(t, ma.Send(ctx, "bob@bobmail.com", ""))
+		_, code := lastMail(t, ma, 3)
+
+		for i := 0; i < 4; i++ {
+			_, err := ma.RedeemCode(ctx, "bob@bobmail.com", "xxxxxx")
+			assert.ErrorIs(t, err, errors.InvalidInput)
+		}
+		_, err := ma.RedeemCode(ctx, "bob@bobmail.com", "xxxxxx")
+		assert.ErrorIs(t, err, errors.Throttled)
+
+		_, err = ma.RedeemCode(ctx, "bob@bobmail.com", code)
+		assert.ErrorIs(t, err, errors.InvalidInput)
+	})
+}
+
+func TestAuth_Send(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("Throttle", func(t *testing.T) {
+		ma := newAuth(t)
+		ma.Cooldown = time.Minute
+
+		require.NoError(t, ma.Send(ctx, "bob@bobmail.com", ""))
+		err := ma.Send(ctx, "BOB@bobmail.com", "")
+		assert.ErrorIs(t, err, errors.Throttled)
+
+		require.NoError(t, ma.Send(ctx, "alice@bobmail.com", ""))
+		waitMails(t, ma, 2)
+	})
+
+	t.Run("NoSignup", func(t *testing.T) {
+		ma := newAuth(t)
+		ma.Signup = false
+
+		// unknown emails are not revealed.
+		require.NoError(t, ma.Send(ctx, "bob@bobmail.com", ""))
+		time.Sleep(50 * time.Millisecond)
+		assert.Empty(t, ma.Mailer.(*mailCapture).sent())
+
+		_, err := ma.Users.Upsert(ctx, core.NewUser("", "bob", "bob@bobmail.com"))
+		require.NoError(t, err)
+		require.NoError(t, ma.Send(ctx, "bob@bobmail.com", ""))
+		waitMails(t, ma, 1)
+	})
+
+	t.Run("InvalidEmail", func(t *testing.T) {
+		ma := newAuth(t)
+		assert.ErrorIs(t, ma.Send(ctx, "not-an-email", ""), errors.InvalidInput)
+	})
+}
+
+// lastMail waits for the n-th mail (mails are sent in the background) and
+// returns the token and the code in it.
+func lastMail(t *testing.T, ma *magiclink.Auth, n int) (token, code string) {
+	t.Helper()
+
+	mails := waitMails(t, ma, n)
+	body := mails[n-1].Body
+
+	link, err := url.Parse(strings.TrimSpace(strings.Split(body, "\n\n")[2]))
+	require.NoError(t, err)
+
+	m := codePattern.FindStringSubmatch(body)
+	require.Len(t, m, 2)
+	return link.Query().Get("token"), m[1]
+}
+
+func newAuth(t *testing.T) *magiclink.Auth {
+	t.Helper()
+
+	key, err := session.NewHMACKey("k1", []byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	issuer, err := session.New("forge", time.Hour, "k1", key)
+	require.NoError(t, err)
+
+	return &magiclink.Auth{
+		Users:    memstore.NewUsers(),
+		Tokens:   memstore.NewTokens(),
+		Mailer:   &mailCapture{},
+		Sessions: issuer,
+		LinkURL:  "http://localhost/forge/auth/magic-link/verify",
+		Cooldown: time.Nanosecond,
+		Signup:   true,
+	}
+}
+
+func waitMails(t *testing.T, ma *magiclink.Auth, n int) []core.Mail {
+	t.Helper()
+
+	capture := ma.Mailer.(*mailCapture)
+	require.Eventually(t, func() bool { return len(capture.sent()) >= n }, time.Second, 5*time.Millisecond)
+	return capture.sent()
+}
+
+type mailCapture struct {
+	mu    sync.Mutex
+	mails []core.Mail
+}
+
+func (mc *mailCapture) Send(_ context.Context, mail core.Mail) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.mails = append(mc.mails, mail)
+	return nil
+}
+
+func (mc *mailCapture) sent() []core.Mail {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return append([]core.Mail{}, mc.mails...)
+}
@@ -0,0 +1,115 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+// APIKeyStore implements core.APIKeyStore using an in-memory map.
+type APIKeyStore struct {
+	mu     sync.RWMutex
+	keys   map[string]core.APIKey
+	hashes map[string]string // hash -> key-id
+}
+
+// NewAPIKeys returns an in-memory API key store.
+func NewAPIKeys() *APIKeyStore {
+	return &APIKeyStore{
+		keys:   map[string]core.APIKey{},
+		hashes: map[string]string{},
+	}
+}
+
+func (ks *APIKeyStore) Create(_ context.Context, key core.APIKey) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if _, found := ks.keys[key.ID]; found {
+		return errors.Conflict.Hintf("api key with id '%s' exists", key.ID)
+	} else if _, found := ks.hashes[key.Hash]; found {
+		return errors.Conflict.Hintf("api key already exists")
+	}
+
+	ks.keys[key.ID] = cloneAPIKey(key)
+	ks.hashes[key.Hash] = key.ID
+	return nil
+}
+
+func (ks *APIKeyStore) Get(_ context.Context, id string) (*core.APIKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, found := ks.keys[id]
+	if !found {
+		return nil, errors.NotFound.Hintf("api key '%s' not found", id)
+	}
+	cloned := cloneAPIKey(key)
+	return &cloned, nil
+}
+
+func (ks *APIKeyStore) Find(ctx context.Context, hash string) (*core.APIKey, error) {
+	ks.mu.RLock()
+	id, found := ks.hashes[hash]
+	ks.mu.RUnlock()
+
+	if !found {
+		return nil, errors.NotFound.Hintf("api key not found")
+	}
+	return ks.Get(ctx, id)
+}
+
+func (ks *APIKeyStore) List(_ context.Context, userID, orgID string) ([]core.APIKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	var res []core.APIKey
+	for _, key := range ks.keys {
+		if (userID == "" || key.UserID == userID) && (orgID == "" || key.OrgID == orgID) {
+			res = append(res, cloneAPIKey(key))
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreatedAt.Before(res[j].CreatedAt) })
+	return res, nil
+}
+
+func (ks *APIKeyStore) Touch(_ context.Context, id string, at time.Time) error {
+	return ks.update(id, func(key *core.APIKey) { key.LastUsedAt = &at })
+}
+
+func (ks *APIKeyStore) Revoke(_ context.Context, id string) error {
+	now := time.Now()
+	return ks.update(id, func(key *core.APIKey) {
+		if key.RevokedAt == nil {
+			key.RevokedAt = &now
+		}
+	})
+}
+
+func (ks *APIKeyStore) update(id string, fn func(key *core.APIKey)) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, found := ks.keys[id]
+	if !found {
+		return errors.NotFound.Hintf("api key '%s' not found", id)
+	}
+	fn(&key)
+	ks.keys[id] = key
+	return nil
+}
+
+func cloneAPIKey(key core.APIKey) core.APIKey {
+	if key.Scopes != nil {
+		key.Scopes = append([]string{}, key.Scopes...)
+	}
+	return key
+}
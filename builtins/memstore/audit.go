@@ -0,0 +1,111 @@
+package memstore
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+const defAuditLimit = 50
+
+// AuditLog implements core.AuditLog using an in-memory list. If a file
+// path is set, every event is appended to the file as a JSON line and
+// the events are restored on open.
+type AuditLog struct {
+	mu     sync.RWMutex
+	file   *os.File
+	events []core.AuditEvent
+}
+
+// NewAuditLog returns an in-memory audit log.
+func NewAuditLog() *AuditLog { return &AuditLog{} }
+
+// OpenAuditLog returns an audit log that appends to the given file. The
+// file is created if it does not exist.
+func OpenAuditLog(filePath string) (*AuditLog, error) {
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	al := &AuditLog{file: f}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+
+		var ev core.AuditEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			_ = f.Close()
+			return nil, errors.InternalIssue.CausedBy(err).Hintf("corrupted audit file '%s'", filePath)
+		}
+		al.events = append(al.events, ev)
+	}
+	if err := sc.Err(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return al, nil
+}
+
+func (al *AuditLog) Append(_ context.Context, ev core.AuditEvent) error {
+	if ev.Action == "" {
+		return errors.InvalidInput.Hintf("action must be set")
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	ev.ID = 1
+	if n := len(al.events); n > 0 {
+		ev.ID = al.events[n-1].ID + 1
+	}
+
+	if al.file != nil {
+		b, err := json.Marshal(ev)
+		if err != nil {
+			return errors.InvalidInput.CausedBy(err).Hintf("invalid event attribs")
+		}
+
+		if _, err := al.file.Write(append(b, '\n')); err != nil {
+			return err
+		}
+	}
+
+	al.events = append(al.events, ev)
+	return nil
+}
+
+func (al *AuditLog) List(_ context.Context, q core.AuditQuery) ([]core.AuditEvent, error) {
+	if q.Limit <= 0 {
+		q.Limit = defAuditLimit
+	}
+
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+
+	var res []core.AuditEvent
+	for i := len(al.events) - 1; i >= 0 && len(res) < q.Limit; i-- {
+		ev := al.events[i]
+		if (q.Before > 0 && ev.ID >= q.Before) || !q.Match(ev) {
+			continue
+		}
+		res = append(res, ev)
+	}
+	return res, nil
+}
+
+// Close closes the audit file if any.
+func (al *AuditLog) Close() error {
+	if al.file == nil {
+		return nil
+	}
+	return al.file.Close()
+}
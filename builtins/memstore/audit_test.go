@@ -0,0 +1,68 @@
+package memstore_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/builtins/memstore"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+func TestAuditLog(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	al, err := memstore.OpenAuditLog(file)
+	require.NoError(t, err)
+
+	for _, ev := range []core.AuditEvent{
+		{Action: "login", ActorID: "bob", TargetID: "bob"},
+		{Action: "login.failed", TargetID: "alice", Attribs: core.M{"reason": "invalid_credentials"}},
+		{Action: "login", ActorID: "alice", TargetID: "alice"},
+		{Action: "api_key.create", ActorID: "bob", TargetID: "k1"},
+	} {
+		require.NoError(t, al.Append(ctx, ev))
+	}
+	assert.ErrorIs(t, al.Append(ctx, core.AuditEvent{}), errors.InvalidInput)
+
+	events, err := al.List(ctx, core.AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+	assert.Equal(t, int64(4), events[0].ID)
+	assert.Equal(t, int64(1), events[3].ID)
+
+	events, err = al.List(ctx, core.AuditQuery{Action: "login", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "alice", events[0].ActorID)
+
+	events, err = al.List(ctx, core.AuditQuery{Action: "login", Before: events[0].ID})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "bob", events[0].ActorID)
+	require.NoError(t, al.Close())
+
+	// events are restored from the file and new ones continue the ids.
+	al, err = memstore.OpenAuditLog(file)
+	require.NoError(t, err)
+	defer func() { _ = al.Close() }()
+
+	require.NoError(t, al.Append(ctx, core.AuditEvent{Action: "logout", ActorID: "bob"}))
+
+	events, err = al.List(ctx, core.AuditQuery{TargetID: "alice"})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "invalid_credentials", events[1].Attribs["reason"])
+
+	events, err = al.List(ctx, core.AuditQuery{ActorID: "bob"})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, int64(5), events[0].ID)
+}
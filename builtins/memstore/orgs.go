@@ -0,0 +1,171 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+// OrgRegistry implements core.OrgRegistry using in-memory maps.
+type OrgRegistry struct {
+	mu      sync.RWMutex
+	orgs    map[string]core.Org
+	slugs   map[string]string                     // slug -> org-id
+	members map[string]map[string]core.Membership // org-id -> user-id -> membership
+}
+
+// NewOrgs returns an in-memory org registry.
+func NewOrgs() *OrgRegistry {
+	return &OrgRegistry{
+		orgs:    map[string]core.Org{},
+		slugs:   map[string]string{},
+		members: map[string]map[string]core.Membership{},
+	}
+}
+
+func (reg *OrgRegistry) Get(_ context.Context, idOrSlug string) (*core.Org, error) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	org, found := reg.orgs[idOrSlug]
+	if !found {
+		org, found = reg.orgs[reg.slugs[idOrSlug]]
+	}
+
+	if !found {
+		return nil, errors.NotFound.Hintf("org '%s' not found", idOrSlug)
+	}
+	return cloneOrg(org), nil
+}
+
+func (reg *OrgRegistry) Upsert(_ context.Context, org core.Org) (*core.Org, error) {
+	if err := org.Validate(); err != nil {
+		return nil, err
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if ownerID, taken := reg.slugs[org.Slug]; taken && ownerID != org.ID {
+		return nil, errors.Conflict.Coded("slug_taken").Hintf("slug is already in use")
+	}
+
+	now := time.Now()
+	if existing, found := reg.orgs[org.ID]; found {
+		org.CreatedAt = existing.CreatedAt
+		delete(reg.slugs, existing.Slug)
+	} else if org.CreatedAt.IsZero() {
+		org.CreatedAt = now
+	}
+	org.UpdatedAt = now
+
+	stored := cloneOrg(org)
+	reg.orgs[org.ID] = *stored
+	reg.slugs[org.Slug] = org.ID
+	return cloneOrg(*stored), nil
+}
+
+func (reg *OrgRegistry) Delete(_ context.Context, orgID string) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	org, found := reg.orgs[orgID]
+	if !found {
+		return errors.NotFound.Hintf("org '%s' not found", orgID)
+	}
+
+	delete(reg.orgs, org.ID)
+	delete(reg.slugs, org.Slug)
+	delete(reg.members, org.ID)
+	return nil
+}
+
+func (reg *OrgRegistry) Member(_ context.Context, orgID, userID string) (*core.Membership, error) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	m, found := reg.members[orgID][userID]
+	if !found {
+		return nil, errors.NotFound.Hintf("user is not a member of the org")
+	}
+	return &m, nil
+}
+
+func (reg *OrgRegistry) Members(_ context.Context, orgID string) ([]core.Membership, error) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	var res []core.Membership
+	for _, m := range reg.members[orgID] {
+		res = append(res, m)
+	}
+	sortMemberships(res)
+	return res, nil
+}
+
+func (reg *OrgRegistry) UserOrgs(_ context.Context, userID string) ([]core.Membership, error) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	var res []core.Membership
+	for _, members := range reg.members {
+		if m, found := members[userID]; found {
+			res = append(res, m)
+		}
+	}
+	sortMemberships(res)
+	return res, nil
+}
+
+func (reg *OrgRegistry) PutMember(_ context.Context, m core.Membership) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, found := reg.orgs[m.OrgID]; !found {
+		return errors.NotFound.Hintf("org '%s' not found", m.OrgID)
+	}
+
+	if existing, found := reg.members[m.OrgID][m.UserID]; found {
+		m.CreatedAt = existing.CreatedAt
+	} else if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+
+	if reg.members[m.OrgID] == nil {
+		reg.members[m.OrgID] = map[string]core.Membership{}
+	}
+	reg.members[m.OrgID][m.UserID] = m
+	return nil
+}
+
+func (reg *OrgRegistry) RemoveMember(_ context.Context, orgID, userID string) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, found := reg.members[orgID][userID]; !found {
+		return errors.NotFound.Hintf("user is not a member of the org")
+	}
+	delete(reg.members[orgID], userID)
+	return nil
+}
+
+func cloneOrg(org core.Org) *core.Org {
+	data := core.M{}
+	for k, v := range org.Data {
+		data[k] = v
+	}
+	org.Data = data
+	return &org
+}
+
+func sortMemberships(list []core.Membership) {
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+}
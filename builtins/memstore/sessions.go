@@ -0,0 +1,121 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+// SessionStore implements core.SessionStore using an in-memory map. All
+// sessions are lost on restart.
+type SessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]core.SessionRecord
+}
+
+// NewSessions returns an in-memory session store.
+func NewSessions() *SessionStore {
+	return &SessionStore{sessions: map[string]core.SessionRecord{}}
+}
+
+func (ss *SessionStore) Create(_ context.Context, rec core.SessionRecord) error {
+	if rec.ID == "" || rec.UserID == "" {
+		return errors.InvalidInput.Hintf("id and user_id must be set")
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if _, found := ss.sessions[rec.ID]; found {
+		return errors.Conflict.Hintf("session with id '%s' exists", rec.ID)
+	}
+
+	// drop the expired sessions of the user.
+	now := time.Now()
+	for id, existing := range ss.sessions {
+		if existing.UserID == rec.UserID && existing.ExpiresAt.Before(now) {
+			delete(ss.sessions, id)
+		}
+	}
+
+	ss.sessions[rec.ID] = rec
+	return nil
+}
+
+func (ss *SessionStore) Get(_ context.Context, id string) (*core.SessionRecord, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	rec, found := ss.sessions[id]
+	if !found {
+		return nil, errors.NotFound.Hintf("session '%s' not found", id)
+	}
+	return &rec, nil
+}
+
+func (ss *SessionStore) List(_ context.Context, userID string) ([]core.SessionRecord, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	var res []core.SessionRecord
+	for _, rec := range ss.sessions {
+		if rec.UserID == userID && rec.Active() {
+			res = append(res, rec)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreatedAt.Before(res[j].CreatedAt) })
+	return res, nil
+}
+
+func (ss *SessionStore) Touch(_ context.Context, id string, at time.Time) error {
+	return ss.update(id, func(rec *core.SessionRecord) { rec.LastSeenAt = at })
+}
+
+func (ss *SessionStore) Extend(_ context.Context, id string, expiresAt time.Time) error {
+	return ss.update(id, func(rec *core.SessionRecord) { rec.ExpiresAt = expiresAt })
+}
+
+func (ss *SessionStore) Revoke(_ context.Context, id string) error {
+	now := time.Now()
+	return ss.update(id, func(rec *core.SessionRecord) {
+		if rec.RevokedAt == nil {
+			rec.RevokedAt = &now
+		}
+	})
+}
+
+func (ss *SessionStore) RevokeUser(_ context.Context, userID string, except ...string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	keep := map[string]bool{}
+	for _, id := range except {
+		keep[id] = true
+	}
+
+	now := time.Now()
+	for id, rec := range ss.sessions {
+		if rec.UserID == userID && rec.RevokedAt == nil && !keep[id] {
+			rec.RevokedAt = &now
+			ss.sessions[id] = rec
+		}
+	}
+	return nil
+}
+
+func (ss *SessionStore) update(id string, fn func(rec *core.SessionRecord)) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	rec, found := ss.sessions[id]
+	if !found {
+		return errors.NotFound.Hintf("session '%s' not found", id)
+	}
+	fn(&rec)
+	ss.sessions[id] = rec
+	return nil
+}
@@ -0,0 +1,68 @@
+package memstore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+// TokenStore implements core.TokenStore using an in-memory map. Expired
+// tokens are purged lazily.
+type TokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]core.Token
+}
+
+// NewTokens returns an in-memory token store.
+func NewTokens() *TokenStore {
+	return &TokenStore{tokens: map[string]core.Token{}}
+}
+
+func (ts *TokenStore) Put(_ context.Context, tok core.Token) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	now := time.Now()
+	for id, t := range ts.tokens {
+		if t.ExpiresAt.Before(now) {
+			delete(ts.tokens, id)
+		}
+	}
+
+	ts.tokens[tokenID(tok.Kind, tok.Hash)] = tok
+	return nil
+}
+
+func (ts *TokenStore) Take(_ context.Context, kind, hash string) (*core.Token, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	id := tokenID(kind, hash)
+	tok, found := ts.tokens[id]
+	if !found {
+		return nil, errors.NotFound.Hintf("token not found")
+	}
+	delete(ts.tokens, id)
+
+	if tok.ExpiresAt.Before(time.Now()) {
+		return nil, errors.NotFound.Hintf("token expired")
+	}
+	return &tok, nil
+}
+
+func (ts *TokenStore) Revoke(_ context.Context, kind, userID string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for id, t := range ts.tokens {
+		if t.Kind == kind && t.UserID == userID {
+			delete(ts.tokens, id)
+		}
+	}
+	return nil
+}
+
+func tokenID(kind, hash string) string { return kind + "/" + hash }
@@ -0,0 +1,268 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+// UserRegistry implements core.UserRegistry using an in-memory map. If
+// a file path is set, the users are persisted to the file as JSON after
+// every change and restored on open.
+type UserRegistry struct {
+	mu       sync.RWMutex
+	file     string
+	users    map[string]core.User
+	keys     map[string]string                  // indexed auth-key -> user-id
+	attached map[string]map[string]core.UserKey // user-id -> auth-key -> key
+}
+
+// NewUsers returns an in-memory user registry.
+func NewUsers() *UserRegistry {
+	return &UserRegistry{
+		users:    map[string]core.User{},
+		keys:     map[string]string{},
+		attached: map[string]map[string]core.UserKey{},
+	}
+}
+
+// OpenUsers returns a user registry that persists to the given file.
+// The file is created if it does not exist.
+func OpenUsers(filePath string) (*UserRegistry, error) {
+	reg := NewUsers()
+	reg.file = filePath
+
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return reg, nil
+		}
+		return nil, err
+	}
+
+	var records []userRecord
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, errors.InternalIssue.CausedBy(err).Hintf("corrupted users file '%s'", filePath)
+	}
+
+	for _, rec := range records {
+		u := rec.User
+		u.Attributes = rec.Attributes
+		reg.index(u)
+
+		for _, key := range rec.Keys {
+			reg.attach(u.ID, key)
+		}
+	}
+	return reg, nil
+}
+
+func (reg *UserRegistry) Get(_ context.Context, key string) (*core.User, error) {
+	if err := core.ValidateAuthKey(key); err != nil {
+		return nil, err
+	}
+
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	id, found := reg.keys[indexKey(key)]
+	if !found {
+		return nil, errors.NotFound.Hintf("user with key '%s' not found", key)
+	}
+
+	u := reg.users[id]
+	cloned := u.Clone(false)
+	return &cloned, nil
+}
+
+func (reg *UserRegistry) Upsert(_ context.Context, u core.User) (*core.User, error) {
+	if err := u.Validate(); err != nil {
+		return nil, err
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	for _, key := range u.AuthKeys() {
+		if ownerID, taken := reg.keys[indexKey(key)]; taken && ownerID != u.ID {
+			kind, _ := core.SplitAuthKey(key)
+			return nil, errors.Conflict.Hintf("%s already in use", kind)
+		}
+	}
+
+	now := time.Now()
+	if existing, found := reg.users[u.ID]; found {
+		u.CreatedAt = existing.CreatedAt
+		for _, key := range existing.AuthKeys() {
+			delete(reg.keys, indexKey(key))
+		}
+	} else if u.CreatedAt.IsZero() {
+		u.CreatedAt = now
+	}
+	u.UpdatedAt = now
+
+	reg.index(u.Clone(false))
+	if err := reg.flush(); err != nil {
+		return nil, err
+	}
+
+	stored := u.Clone(false)
+	return &stored, nil
+}
+
+func (reg *UserRegistry) Keys(_ context.Context, userID string) ([]core.UserKey, error) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	u, found := reg.users[userID]
+	if !found {
+		return nil, errors.NotFound.Hintf("user '%s' not found", userID)
+	}
+
+	var keys []core.UserKey
+	for _, key := range u.AuthKeys() {
+		keys = append(keys, core.UserKey{AuthKey: key})
+	}
+	for _, key := range reg.attached[userID] {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (reg *UserRegistry) AttachKey(_ context.Context, userID string, key core.UserKey) error {
+	if err := core.ValidateAttachableKey(key.AuthKey); err != nil {
+		return err
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, found := reg.users[userID]; !found {
+		return errors.NotFound.Hintf("user '%s' not found", userID)
+	} else if ownerID, taken := reg.keys[key.AuthKey]; taken && ownerID != userID {
+		return errors.Conflict.Hintf("key is attached to another user")
+	}
+
+	reg.attach(userID, key)
+	return reg.flush()
+}
+
+func (reg *UserRegistry) DetachKey(_ context.Context, userID, authKey string) error {
+	if err := core.ValidateAttachableKey(authKey); err != nil {
+		return err
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, found := reg.attached[userID][authKey]; !found {
+		return errors.NotFound.Hintf("key not attached to user '%s'", userID)
+	}
+
+	delete(reg.keys, authKey)
+	delete(reg.attached[userID], authKey)
+	return reg.flush()
+}
+
+func (reg *UserRegistry) Purge(_ context.Context, before time.Time) ([]string, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	var purged []string
+	for id, u := range reg.users {
+		if u.DeletedAt == nil || !u.DeletedAt.Before(before) {
+			continue
+		}
+
+		for _, key := range u.AuthKeys() {
+			delete(reg.keys, indexKey(key))
+		}
+		for key := range reg.attached[id] {
+			delete(reg.keys, key)
+		}
+		delete(reg.attached, id)
+		delete(reg.users, id)
+		purged = append(purged, id)
+	}
+
+	if len(purged) == 0 {
+		return nil, nil
+	}
+	return purged, reg.flush()
+}
+
+func (reg *UserRegistry) index(u core.User) {
+	reg.users[u.ID] = u
+	for _, key := range u.AuthKeys() {
+		reg.keys[indexKey(key)] = u.ID
+	}
+}
+
+// indexKey returns the form of the key used in the index. Emails are
+// case-insensitive.
+func indexKey(key string) string {
+	if kind, val := core.SplitAuthKey(key); kind == core.KeyKindEmail {
+		return core.NewAuthKey(kind, strings.ToLower(val))
+	}
+	return key
+}
+
+func (reg *UserRegistry) attach(userID string, key core.UserKey) {
+	if reg.attached[userID] == nil {
+		reg.attached[userID] = map[string]core.UserKey{}
+	}
+	reg.attached[userID][key.AuthKey] = key
+	reg.keys[key.AuthKey] = userID
+}
+
+// flush writes all users to the file atomically. Caller must hold the
+// write lock.
+func (reg *UserRegistry) flush() error {
+	if reg.file == "" {
+		return nil
+	}
+
+	records := make([]userRecord, 0, len(reg.users))
+	for _, u := range reg.users {
+		rec := userRecord{User: u, Attributes: u.Attributes}
+		for _, key := range reg.attached[u.ID] {
+			rec.Keys = append(rec.Keys, key)
+		}
+		records = append(records, rec)
+	}
+
+	b, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return errors.InternalIssue.CausedBy(err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(reg.file), ".forge-users-*")
+	if err != nil {
+		return errors.InternalIssue.CausedBy(err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return errors.InternalIssue.CausedBy(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.InternalIssue.CausedBy(err)
+	}
+	return os.Rename(tmp.Name(), reg.file)
+}
+
+// userRecord is the persisted form of a user. Attributes are not part
+// of the JSON form of core.User and hence are stored separately.
+type userRecord struct {
+	core.User
+	Keys       []core.UserKey `json:"keys,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
@@ -0,0 +1,172 @@
+package memstore_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/builtins/memstore"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+func TestUserRegistry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	reg := memstore.NewUsers()
+
+	bob := core.NewUser("password", "bob", "bob@bobmail.com")
+	_, err := reg.Upsert(ctx, bob)
+	require.NoError(t, err)
+
+	t.Run("Get", func(t *testing.T) {
+		got, err := reg.Get(ctx, core.NewAuthKey(core.KeyKindEmail, bob.Email))
+		require.NoError(t, err)
+		assert.Equal(t, bob.ID, got.ID)
+
+		// emails are case-insensitive.
+		got, err = reg.Get(ctx, core.NewAuthKey(core.KeyKindEmail, "Bob@BobMail.com"))
+		require.NoError(t, err)
+		assert.Equal(t, bob.ID, got.ID)
+
+		_, err = reg.Get(ctx, core.NewAuthKey(core.KeyKindUsername, "alice"))
+		assert.ErrorIs(t, err, errors.NotFound)
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		_, err := reg.Upsert(ctx, core.NewUser("", "bob", "alice@bobmail.com"))
+		assert.ErrorIs(t, err, errors.Conflict)
+
+		_, err = reg.Upsert(ctx, core.NewUser("", "alice", "bob@bobmail.com"))
+		assert.ErrorIs(t, err, errors.Conflict)
+
+		_, err = reg.Upsert(ctx, core.NewUser("", "alice", "BOB@bobmail.com"))
+		assert.ErrorIs(t, err, errors.Conflict)
+	})
+
+	t.Run("ChangeEmail", func(t *testing.T) {
+		updated := bob.Clone(false)
+		updated.Email = "bobby@bobmail.com"
+		_, err := reg.Upsert(ctx, updated)
+		require.NoError(t, err)
+
+		_, err = reg.Get(ctx, core.NewAuthKey(core.KeyKindEmail, "bob@bobmail.com"))
+		assert.ErrorIs(t, err, errors.NotFound)
+
+		got, err := reg.Get(ctx, core.NewAuthKey(core.KeyKindEmail, "bobby@bobmail.com"))
+		require.NoError(t, err)
+		assert.True(t, bob.CreatedAt.Equal(got.CreatedAt))
+	})
+}
+
+func TestOpenUsers(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "users.json")
+
+	reg, err := memstore.OpenUsers(file)
+	require.NoError(t, err)
+
+	bob := core.NewUser("password", "bob", "bob@bobmail.com")
+	bob.Attributes = core.M{"plan": "pro"}
+	_, err = reg.Upsert(ctx, bob)
+	require.NoError(t, err)
+	require.NoError(t, reg.AttachKey(ctx, bob.ID, core.UserKey{AuthKey: "phone/123"}))
+
+	reopened, err := memstore.OpenUsers(file)
+	require.NoError(t, err)
+
+	_, err = reopened.Get(ctx, "phone/123")
+	require.NoError(t, err)
+
+	got, err := reopened.Get(ctx, core.NewAuthKey(core.KeyKindUsername, "bob"))
+	require.NoError(t, err)
+	assert.Equal(t, bob.ID, got.ID)
+	assert.Equal(t, "pro", got.Attributes["plan"])
+	assert.Equal(t, *bob.VerifyToken, *got.VerifyToken)
+}
+
+func TestUserRegistry_Keys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	reg := memstore.NewUsers()
+
+	bob, err := reg.Upsert(ctx, core.NewUser("", "bob", "bob@bobmail.com"))
+	require.NoError(t, err)
+	alice, err := reg.Upsert(ctx, core.NewUser("", "alice", "alice@bobmail.com"))
+	require.NoError(t, err)
+
+	phone := core.UserKey{AuthKey: core.NewAuthKey("phone", "+911234567890"), Attribs: core.M{"verified": true}}
+	require.NoError(t, reg.AttachKey(ctx, bob.ID, phone))
+
+	got, err := reg.Get(ctx, phone.AuthKey)
+	require.NoError(t, err)
+	assert.Equal(t, bob.ID, got.ID)
+
+	keys, err := reg.Keys(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Len(t, keys, 4)
+	assert.Contains(t, keys, phone)
+
+	err = reg.AttachKey(ctx, alice.ID, phone)
+	assert.ErrorIs(t, err, errors.Conflict)
+
+	err = reg.AttachKey(ctx, bob.ID, core.UserKey{AuthKey: core.NewAuthKey(core.KeyKindEmail, "x@bobmail.com")})
+	assert.ErrorIs(t, err, errors.InvalidInput)
+
+	err = reg.AttachKey(ctx, "unknown", core.UserKey{AuthKey: core.NewAuthKey("phone", "123")})
+	assert.ErrorIs(t, err, errors.NotFound)
+
+	require.NoError(t, reg.DetachKey(ctx, bob.ID, phone.AuthKey))
+	_, err = reg.Get(ctx, phone.AuthKey)
+	assert.ErrorIs(t, err, errors.NotFound)
+
+	err = reg.DetachKey(ctx, bob.ID, phone.AuthKey)
+	assert.ErrorIs(t, err, errors.NotFound)
+}
+
+func TestUserRegistry_Purge(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	reg := memstore.NewUsers()
+
+	now := time.Now()
+	bob := core.NewUser("", "bob", "bob@bobmail.com")
+	deletedAt := now.Add(-2 * time.Hour)
+	bob.DeletedAt = &deletedAt
+	_, err := reg.Upsert(ctx, bob)
+	require.NoError(t, err)
+	require.NoError(t, reg.AttachKey(ctx, bob.ID, core.UserKey{AuthKey: "phone/+15550100"}))
+
+	alice := core.NewUser("", "alice", "alice@bobmail.com")
+	recent := now.Add(-time.Minute)
+	alice.DeletedAt = &recent
+	_, err = reg.Upsert(ctx, alice)
+	require.NoError(t, err)
+
+	purged, err := reg.Purge(ctx, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{bob.ID}, purged)
+
+	_, err = reg.Get(ctx, "email/bob@bobmail.com")
+	assert.ErrorIs(t, err, errors.NotFound)
+	_, err = reg.Get(ctx, "phone/+15550100")
+	assert.ErrorIs(t, err, errors.NotFound)
+
+	// users in the grace period are retained.
+	got, err := reg.Get(ctx, "email/alice@bobmail.com")
+	require.NoError(t, err)
+	assert.NotNil(t, got.DeletedAt)
+
+	// the email of the purged user is free again.
+	_, err = reg.Upsert(ctx, core.NewUser("", "bob", "bob@bobmail.com"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,265 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/strutils"
+)
+
+// Provider represents an OAuth2 provider that supports the authorization
+// code flow with PKCE. After the code exchange, the identity of the user
+// is fetched from the UserInfo endpoint.
+type Provider struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	Scopes       []string
+
+	// Fields of the UserInfo response. IDField defaults to 'sub' and
+	// EmailField to 'email'. If VerifiedField is empty, emails are not
+	// trusted as verified.
+	IDField       string
+	EmailField    string
+	VerifiedField string
+
+	// EmailsURL can be set for providers that list the emails of the user
+	// separately (e.g., GitHub). The primary email, if verified, is used
+	// instead of the one in the UserInfo response.
+	EmailsURL string
+
+	// Data maps user data fields to the UserInfo response fields.
+	Data map[string]string
+
+	Client *http.Client
+}
+
+// Preset returns the provider preset for well-known providers. Only client
+// credentials need to be set on the returned value.
+func Preset(name string) (Provider, bool) {
+	switch name {
+	case "google":
+		return Provider{
+			Name:          name,
+			AuthURL:       "https://accounts.google.com/o/oauth2/v2/auth",
+			TokenURL:      "https://oauth2.googleapis.com/token",
+			UserInfoURL:   "https://openidconnect.googleapis.com/v1/userinfo",
+			Scopes:        []string{"openid", "email", "profile"},
+			VerifiedField: "email_verified",
+			Data:          map[string]string{"name": "name", "picture": "picture"},
+		}, true
+
+	case "github":
+		return Provider{
+			Name:        name,
+			AuthURL:     "https://github.com/login/oauth/authorize",
+			TokenURL:    "https://github.com/login/oauth/access_token",
+			UserInfoURL: "https://api.github.com/user",
+			EmailsURL:   "https://api.github.com/user/emails",
+			Scopes:      []string{"read:user", "user:email"},
+			IDField:     "id",
+			Data:        map[string]string{"name": "name", "picture": "avatar_url"},
+		}, true
+
+	default:
+		return Provider{}, false
+	}
+}
+
+// NewPKCE returns a new PKCE code verifier and its S256 challenge.
+func NewPKCE() (verifier, challenge string) {
+	verifier = strutils.RandToken(32)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL of the provider's consent page.
+func (p *Provider) AuthCodeURL(state, challenge, redirectURI string) string {
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {redirectURI},
+		"state":                 {state},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	if len(p.Scopes) > 0 {
+		q.Set("scope", strings.Join(p.Scopes, " "))
+	}
+
+	sep := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.AuthURL + sep + q.Encode()
+}
+
+// Exchange exchanges the authorization code for an access token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, redirectURI string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.InternalIssue.CausedBy(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var res struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+		ErrorDesc   string `json:"error_description"`
+	}
+	if err := p.do(req, &res); err != nil {
+		return "", err
+	}
+
+	if res.Error != "" {
+		return "", errors.MissingAuth.Coded("oauth_failed").Hintf("%s: %s", res.Error, res.ErrorDesc)
+	} else if res.AccessToken == "" {
+		return "", errors.InternalIssue.Hintf("provider '%s' returned no access token", p.Name)
+	}
+	return res.AccessToken, nil
+}
+
+// Identity fetches the identity of the user that owns the access token.
+// The returned user has only the identity fields set and the ID set to
+// the subject at the provider.
+func (p *Provider) Identity(ctx context.Context, accessToken string) (*core.User, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.UserInfoURL, nil)
+	if err != nil {
+		return nil, errors.InternalIssue.CausedBy(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var info map[string]any
+	if err := p.do(req, &info); err != nil {
+		return nil, err
+	}
+
+	sub := stringify(info[orDefault(p.IDField, "sub")])
+	if sub == "" {
+		return nil, errors.InternalIssue.Hintf("provider '%s' returned no user id", p.Name)
+	}
+
+	u := &core.User{
+		ID:    sub,
+		Data:  core.UserData{},
+		Email: stringify(info[orDefault(p.EmailField, "email")]),
+	}
+
+	if verified, _ := info[p.VerifiedField].(bool); verified && p.VerifiedField != "" && u.Email != "" {
+		now := time.Now()
+		u.VerifiedAt = &now
+	}
+
+	if p.EmailsURL != "" {
+		if err := p.primaryEmail(ctx, accessToken, u); err != nil {
+			return nil, err
+		}
+	}
+
+	for field, key := range p.Data {
+		if v, found := info[key]; found && v != nil {
+			u.Data[field] = v
+		}
+	}
+	return u, nil
+}
+
+// primaryEmail sets the primary email of the user as verified if the
+// provider lists it as verified.
+func (p *Provider) primaryEmail(ctx context.Context, accessToken string, u *core.User) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.EmailsURL, nil)
+	if err != nil {
+		return errors.InternalIssue.CausedBy(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.do(req, &emails); err != nil {
+		return err
+	}
+
+	for _, e := range emails {
+		if e.Primary && e.Verified && e.Email != "" {
+			now := time.Now()
+			u.Email, u.VerifiedAt = e.Email, &now
+			break
+		}
+	}
+	return nil
+}
+
+func (p *Provider) do(req *http.Request, into any) error {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.InternalIssue.CausedBy(err).Hintf("request to provider '%s' failed", p.Name)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusBadRequest {
+		return errors.MissingAuth.Coded("oauth_failed").Hintf("provider '%s' returned %s", p.Name, resp.Status)
+	} else if resp.StatusCode != http.StatusOK {
+		return errors.InternalIssue.Hintf("provider '%s' returned unexpected status: %s", p.Name, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		return errors.InternalIssue.CausedBy(err).Hintf("provider '%s' returned invalid response", p.Name)
+	}
+	return nil
+}
+
+func stringify(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return fmt.Sprintf("%.0f", val)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,176 @@
+package oauth_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/builtins/oauth"
+	"github.com/spy16/forge/core/errors"
+)
+
+const (
+	testCode        = "the-code"
+	testAccessToken = "the-access-token"
+	testRedirectURI = "http://localhost:8080/forge/oauth/mock/callback"
+)
+
+func TestProvider_AuthCodeURL(t *testing.T) {
+	t.Parallel()
+
+	p := &oauth.Provider{
+		ClientID: "client",
+		AuthURL:  "https://sso.example.com/authorize?prompt=consent",
+		Scopes:   []string{"openid", "email"},
+	}
+
+	u, err := url.Parse(p.AuthCodeURL("state1", "challenge1", testRedirectURI))
+	require.NoError(t, err)
+
+	q := u.Query()
+	assert.Equal(t, "consent", q.Get("prompt"))
+	assert.Equal(t, "code", q.Get("response_type"))
+	assert.Equal(t, "client", q.Get("client_id"))
+	assert.Equal(t, "state1", q.Get("state"))
+	assert.Equal(t, "challenge1", q.Get("code_challenge"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+	assert.Equal(t, "openid email", q.Get("scope"))
+	assert.Equal(t, testRedirectURI, q.Get("redirect_uri"))
+}
+
+func TestProvider_Flow(t *testing.T) {
+	t.Parallel()
+
+	verifier, challenge := oauth.NewPKCE()
+	p := newProvider(t, challenge)
+
+	t.Run("WrongVerifier", func(t *testing.T) {
+		otherVerifier, _ := oauth.NewPKCE()
+		_, err := p.Exchange(context.Background(), testCode, otherVerifier, testRedirectURI)
+		assert.True(t, errors.Is(err, errors.MissingAuth))
+	})
+
+	t.Run("WrongCode", func(t *testing.T) {
+		_, err := p.Exchange(context.Background(), "other", verifier, testRedirectURI)
+		assert.True(t, errors.Is(err, errors.MissingAuth))
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		token, err := p.Exchange(context.Background(), testCode, verifier, testRedirectURI)
+		require.NoError(t, err)
+		assert.Equal(t, testAccessToken, token)
+
+		u, err := p.Identity(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "12345", u.ID)
+		assert.Equal(t, "bob@example.com", u.Email)
+		assert.NotNil(t, u.VerifiedAt)
+		assert.Equal(t, "Bob", u.Data["name"])
+	})
+
+	t.Run("BadToken", func(t *testing.T) {
+		_, err := p.Identity(context.Background(), "invalid")
+		assert.True(t, errors.Is(err, errors.MissingAuth))
+	})
+}
+
+func TestProvider_Identity_unverified(t *testing.T) {
+	t.Parallel()
+
+	_, challenge := oauth.NewPKCE()
+	p := newProvider(t, challenge)
+	p.VerifiedField = ""
+
+	u, err := p.Identity(context.Background(), testAccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "bob@example.com", u.Email)
+	assert.Nil(t, u.VerifiedAt)
+}
+
+func TestProvider_Identity_emails(t *testing.T) {
+	t.Parallel()
+
+	_, challenge := oauth.NewPKCE()
+	p := newProvider(t, challenge)
+	p.VerifiedField = ""
+	p.EmailsURL = p.UserInfoURL + "/emails"
+
+	u, err := p.Identity(context.Background(), testAccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "bob@work.example.com", u.Email)
+	assert.NotNil(t, u.VerifiedAt)
+}
+
+// newProvider starts a mock provider that accepts only the given PKCE
+// challenge.
+func newProvider(t *testing.T, challenge string) *oauth.Provider {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != testCode ||
+			r.PostForm.Get("client_id") != "client" ||
+			r.PostForm.Get("redirect_uri") != testRedirectURI ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": testAccessToken,
+			"token_type":   "bearer",
+		})
+	})
+
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testAccessToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":       12345,
+			"email":    "bob@example.com",
+			"verified": true,
+			"name":     "Bob",
+		})
+	})
+
+	mux.HandleFunc("/userinfo/emails", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testAccessToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode([]map[string]any{
+			{"email": "bob@example.com", "primary": false, "verified": false},
+			{"email": "bob@work.example.com", "primary": true, "verified": true},
+		})
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return &oauth.Provider{
+		Name:          "mock",
+		ClientID:      "client",
+		ClientSecret:  "secret",
+		AuthURL:       srv.URL + "/authorize",
+		TokenURL:      srv.URL + "/token",
+		UserInfoURL:   srv.URL + "/userinfo",
+		IDField:       "id",
+		VerifiedField: "verified",
+		Data:          map[string]string{"name": "name"},
+	}
+}
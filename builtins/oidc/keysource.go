@@ -0,0 +1,204 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pquerna/cachecontrol/cacheobject"
+
+	"github.com/spy16/forge/core/errors"
+)
+
+const (
+	defaultCacheTTL = time.Hour
+	minRefetchGap   = time.Minute
+	minRSABits      = 2048
+)
+
+// KeySource fetches and caches the JSON Web Key Set (JWKS) published by
+// a provider. Keys are re-fetched once the cache expires as per the
+// Cache-Control header or when an unknown kid is seen (at most once per
+// minute, to survive key rotations without allowing abuse).
+type KeySource struct {
+	URL    string
+	Client *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	nextSync  time.Time
+	lastFetch time.Time
+}
+
+// Find returns the public key with the given kid.
+func (ks *KeySource) Find(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if err := ks.syncIfNeeded(ctx, false); err != nil {
+		return nil, err
+	}
+
+	if key, found := ks.lookup(kid); found {
+		return key, nil
+	}
+
+	// the provider may have rotated the keys.
+	if err := ks.syncIfNeeded(ctx, true); err != nil {
+		return nil, err
+	}
+
+	if key, found := ks.lookup(kid); found {
+		return key, nil
+	}
+	return nil, errors.NotFound.Hintf("unknown kid '%s'", kid)
+}
+
+func (ks *KeySource) lookup(kid string) (crypto.PublicKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, found := ks.keys[kid]
+	return key, found
+}
+
+func (ks *KeySource) syncIfNeeded(ctx context.Context, force bool) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := time.Now()
+	if force && now.Sub(ks.lastFetch) < minRefetchGap {
+		return nil
+	} else if !force && ks.nextSync.After(now) {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient(ks.Client).Do(req)
+	if err != nil {
+		return errors.InternalIssue.CausedBy(err).Hintf("failed to fetch jwks")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	ks.lastFetch = now
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.InternalIssue.
+			CausedBy(fmt.Errorf("unexpected status: %s", resp.Status))
+	}
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return errors.InternalIssue.CausedBy(err).Hintf("invalid jwks")
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		// keys of unsupported types are skipped.
+		if pub, err := k.publicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+	ks.keys = keys
+
+	ttl := defaultCacheTTL
+	if dirs, err := cacheobject.ParseResponseCacheControl(resp.Header.Get("Cache-Control")); err == nil && dirs.MaxAge > 0 {
+		ttl = time.Duration(dirs.MaxAge) * time.Second
+	}
+	ks.nextSync = now.Add(ttl)
+	return nil
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if n.BitLen() < minRSABits {
+			return nil, fmt.Errorf("rsa key is too small")
+		} else if !e.IsInt64() || e.Int64() < 3 || e.Int64() > math.MaxInt32 || e.Bit(0) == 0 {
+			return nil, fmt.Errorf("invalid rsa exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		} else if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type '%s'", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	return c
+}
@@ -0,0 +1,217 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+const (
+	defaultProvider = "oidc"
+	defaultLeeway   = time.Minute
+)
+
+// DefaultClaims is the claim mapping used when Auth.Claims is not set.
+var DefaultClaims = map[string]string{
+	"name":    "name",
+	"picture": "picture",
+}
+
+// Auth implements auth module for any OpenID Connect provider (e.g.,
+// Auth0, Keycloak, Cognito, Dex). The provider is discovered using the
+// '.well-known/openid-configuration' document of the issuer and tokens
+// are verified using the provider's JWKS. If Users is set, the identity
+// is persisted in the registry on every successful authentication.
+type Auth struct {
+	// IssuerURL is the provider's issuer identifier. Must exactly match
+	// the 'iss' claim of the tokens.
+	IssuerURL string
+
+	// Audience lists the accepted 'aud' values (i.e., client IDs). If
+	// empty, the audience is not checked.
+	Audience []string
+
+	// Leeway is the allowed clock-skew for exp/nbf checks. Defaults to 1
+	// minute.
+	Leeway time.Duration
+
+	// Claims maps user data fields to token claims. DefaultClaims is used
+	// if nil.
+	Claims map[string]string
+
+	// Provider is used as the kind of auth key attached to local users.
+	// Defaults to 'oidc'.
+	Provider string
+
+	Users  core.UserRegistry
+	Client *http.Client
+
+	mu   sync.Mutex
+	keys *KeySource
+}
+
+func (au *Auth) Authenticate(ctx context.Context, token string) (*core.Session, error) {
+	keys, err := au.keySource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	leeway := au.Leeway
+	if leeway <= 0 {
+		leeway = defaultLeeway
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims,
+		func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			return keys.Find(ctx, kid)
+		},
+		jwt.WithIssuer(au.IssuerURL),
+		jwt.WithLeeway(leeway),
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+	)
+	if err != nil {
+		if errors.Is(err, errors.InternalIssue) {
+			return nil, err
+		}
+		return nil, errors.MissingAuth.CausedBy(err).Hintf("%s", err)
+	}
+
+	if err := au.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	u := au.toUser(claims)
+	if au.Users != nil {
+		local, err := core.UpsertIdentity(ctx, au.Users, core.NewAuthKey(au.provider(), u.ID), u)
+		if err != nil {
+			return nil, err
+		}
+		u = local.Clone(true)
+	}
+
+	sess := &core.Session{User: u, Token: token}
+	if exp, _ := claims.GetExpirationTime(); exp != nil {
+		sess.Expiry = exp.Time
+	}
+	if authTime, ok := claims["auth_time"].(float64); ok {
+		sess.AuthTime = time.Unix(int64(authTime), 0)
+	} else if iat, _ := claims.GetIssuedAt(); iat != nil {
+		sess.AuthTime = iat.Time
+	}
+	return sess, nil
+}
+
+func (au *Auth) checkClaims(claims jwt.MapClaims) error {
+	if exp, _ := claims.GetExpirationTime(); exp == nil {
+		return errors.MissingAuth.Hintf("exp claim is required")
+	}
+
+	if sub, _ := claims.GetSubject(); sub == "" {
+		return errors.MissingAuth.Hintf("sub claim is required")
+	}
+
+	if len(au.Audience) == 0 {
+		return nil
+	}
+
+	aud, _ := claims.GetAudience()
+	for _, got := range aud {
+		for _, want := range au.Audience {
+			if got == want {
+				return nil
+			}
+		}
+	}
+	return errors.MissingAuth.Hintf("aud mismatch")
+}
+
+func (au *Auth) toUser(claims jwt.MapClaims) core.User {
+	sub, _ := claims.GetSubject()
+	email, _ := claims["email"].(string)
+
+	u := core.User{
+		ID:    sub,
+		Data:  core.UserData{},
+		Email: email,
+	}
+
+	if verified, _ := claims["email_verified"].(bool); verified && email != "" {
+		now := time.Now()
+		u.VerifiedAt = &now
+	}
+
+	mapping := au.Claims
+	if mapping == nil {
+		mapping = DefaultClaims
+	}
+	for field, claim := range mapping {
+		if v, found := claims[claim]; found {
+			u.Data[field] = v
+		}
+	}
+	return u
+}
+
+// keySource discovers the provider configuration on first use. Failed
+// discoveries are retried on the next call.
+func (au *Auth) keySource(ctx context.Context) (*KeySource, error) {
+	au.mu.Lock()
+	defer au.mu.Unlock()
+
+	if au.keys != nil {
+		return au.keys, nil
+	}
+
+	discoveryURL := strings.TrimSuffix(au.IssuerURL, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, errors.InternalIssue.CausedBy(err)
+	}
+
+	resp, err := httpClient(au.Client).Do(req)
+	if err != nil {
+		return nil, errors.InternalIssue.CausedBy(err).Hintf("oidc discovery failed")
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.InternalIssue.
+			CausedBy(fmt.Errorf("unexpected status: %s", resp.Status)).
+			Hintf("oidc discovery failed")
+	}
+
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, errors.InternalIssue.CausedBy(err).Hintf("invalid oidc discovery document")
+	}
+
+	if doc.Issuer != au.IssuerURL {
+		return nil, errors.InternalIssue.Hintf("discovered issuer '%s' does not match '%s'", doc.Issuer, au.IssuerURL)
+	} else if doc.JWKSURI == "" {
+		return nil, errors.InternalIssue.Hintf("discovery document has no jwks_uri")
+	}
+
+	au.keys = &KeySource{URL: doc.JWKSURI, Client: au.Client}
+	return au.keys, nil
+}
+
+func (au *Auth) provider() string {
+	if au.Provider == "" {
+		return defaultProvider
+	}
+	return au.Provider
+}
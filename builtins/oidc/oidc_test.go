@@ -0,0 +1,195 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/builtins/memstore"
+	"github.com/spy16/forge/builtins/oidc"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+func TestAuth_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	provider := newProvider(t)
+	au := &oidc.Auth{
+		IssuerURL: provider.URL,
+		Audience:  []string{"my-client"},
+		Claims:    map[string]string{"name": "name", "tenant": "https://forge.dev/tenant"},
+	}
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":                      provider.URL,
+			"sub":                      "auth0|bob",
+			"aud":                      []string{"my-client", "other"},
+			"exp":                      time.Now().Add(time.Hour).Unix(),
+			"email":                    "bob@bobmail.com",
+			"email_verified":           true,
+			"name":                     "Bob",
+			"https://forge.dev/tenant": "acme",
+		}
+	}
+
+	with := func(k string, v any) jwt.MapClaims {
+		c := validClaims()
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+
+	table := []struct {
+		title   string
+		token   string
+		wantErr error
+	}{
+		{title: "RS256", token: provider.sign(t, "rsa", validClaims())},
+		{title: "ES256", token: provider.sign(t, "ec", validClaims())},
+		{title: "EdDSA", token: provider.sign(t, "ed", validClaims())},
+		{title: "ExpiredWithinLeeway", token: provider.sign(t, "rsa", with("exp", time.Now().Add(-30*time.Second).Unix()))},
+		{title: "Expired", token: provider.sign(t, "rsa", with("exp", time.Now().Add(-time.Hour).Unix())), wantErr: errors.MissingAuth},
+		{title: "NotYetValid", token: provider.sign(t, "rsa", with("nbf", time.Now().Add(time.Hour).Unix())), wantErr: errors.MissingAuth},
+		{title: "MissingExp", token: provider.sign(t, "rsa", with("exp", nil)), wantErr: errors.MissingAuth},
+		{title: "WrongIssuer", token: provider.sign(t, "rsa", with("iss", "https://evil.example")), wantErr: errors.MissingAuth},
+		{title: "WrongAudience", token: provider.sign(t, "rsa", with("aud", "other")), wantErr: errors.MissingAuth},
+		{title: "UnknownKid", token: provider.sign(t, "unknown", validClaims()), wantErr: errors.MissingAuth},
+		{title: "InvalidExponent", token: provider.sign(t, "bad-e", validClaims()), wantErr: errors.MissingAuth},
+		{title: "HS256", token: provider.sign(t, "hmac", validClaims()), wantErr: errors.MissingAuth},
+	}
+
+	for _, tt := range table {
+		tt := tt
+		t.Run(tt.title, func(t *testing.T) {
+			sess, err := au.Authenticate(context.Background(), tt.token)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "auth0|bob", sess.User.ID)
+			assert.Equal(t, "Bob", sess.User.Data["name"])
+			assert.Equal(t, "acme", sess.User.Data["tenant"])
+			assert.NotNil(t, sess.User.VerifiedAt)
+		})
+	}
+
+	// jwks is fetched once and cached as per Cache-Control.
+	assert.Equal(t, 1, provider.jwksHits)
+}
+
+func TestAuth_Authenticate_users(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	provider := newProvider(t)
+	users := memstore.NewUsers()
+	au := &oidc.Auth{IssuerURL: provider.URL, Provider: "keycloak", Users: users}
+
+	token := provider.sign(t, "rsa", jwt.MapClaims{
+		"iss":   provider.URL,
+		"sub":   "f3a1-77",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"email": "bob@bobmail.com",
+	})
+
+	first, err := au.Authenticate(ctx, token)
+	require.NoError(t, err)
+	assert.Nil(t, first.User.VerifiedAt)
+
+	second, err := au.Authenticate(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, first.User.ID, second.User.ID)
+
+	u, err := users.Get(ctx, core.NewAuthKey("keycloak", "f3a1-77"))
+	require.NoError(t, err)
+	assert.Equal(t, first.User.ID, u.ID)
+}
+
+type testProvider struct {
+	*httptest.Server
+	keys     map[string]crypto.Signer
+	jwksHits int
+}
+
+func newProvider(t *testing.T) *testProvider {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	p := &testProvider{keys: map[string]crypto.Signer{"rsa": rsaKey, "ec": ecKey, "ed": edKey}}
+
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	jwks := []map[string]any{
+		{"kid": "rsa", "kty": "RSA", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kid": "ec", "kty": "EC", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+		{"kid": "ed", "kty": "OKP", "crv": "Ed25519", "x": b64(edKey.Public().(ed25519.PublicKey))},
+		{"kid": "enc", "kty": "RSA", "use": "enc", "n": b64(rsaKey.N.Bytes()), "e": "AQAB"},
+		{"kid": "bad-e", "kty": "RSA", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(make([]byte, 9))},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":   p.URL,
+			"jwks_uri": p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.jwksHits++
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": jwks})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *testProvider) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	var method jwt.SigningMethod
+	var key any
+	switch kid {
+	case "rsa", "unknown", "bad-e":
+		method, key = jwt.SigningMethodRS256, p.keys["rsa"]
+	case "ec":
+		method, key = jwt.SigningMethodES256, p.keys["ec"]
+	case "ed":
+		method, key = jwt.SigningMethodEdDSA, p.keys["ed"]
+	case "hmac":
+		method, key = jwt.SigningMethodHS256, []byte("0123456789abcdef0123456789abcdef")
+	}
+
+	tok := jwt.NewWithClaims(method, claims)
+	tok.Header["kid"] = kid
+	signed, err := tok.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
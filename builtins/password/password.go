@@ -0,0 +1,370 @@
+package password
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/log"
+	"github.com/spy16/forge/core/session"
+	"github.com/spy16/forge/core/strutils"
+)
+
+// TokenKindReset is the kind of the password reset tokens.
+const TokenKindReset = "pwd_reset"
+
+const (
+	tokenKindFailures = "pwd_failures"
+	defaultResetTTL   = 30 * time.Minute
+
+	// after maxFailures wrong passwords within the failureWindow, the
+	// password of the user cannot be verified until the window ends.
+	maxFailures   = 5
+	failureWindow = 15 * time.Minute
+)
+
+const resetMailBody = `Hello %s,
+
+We received a request to reset your password. Visit the link below to
+set a new password:
+
+%s
+
+The link expires at %s. If you did not request this, ignore this email.
+`
+
+var (
+	errBadCreds   = errors.MissingAuth.Coded("invalid_credentials")
+	errLocked     = errors.Throttled.Coded("too_many_attempts").Hintf("too many wrong passwords, retry later")
+	errBadToken   = errors.InvalidInput.Coded("invalid_token")
+	errNoRecovery = errors.Unsupported.Hintf("password reset is not enabled")
+)
+
+// Auth implements password-based auth module. Users are maintained in
+// the given user registry and sessions are forge-signed tokens minted
+// by the session issuer. Password reset is enabled only when Tokens and
+// Mailer are set. Wrong passwords are throttled per user when Tokens is
+// set. If Policy is nil, core.DefaultPasswordPolicy is used.
+// If Hasher is nil, core.DefaultPasswordHasher is used.
+type Auth struct {
+	Users    core.UserRegistry
+	Tokens   core.TokenStore
+	Mailer   core.Mailer
+	Policy   *core.PasswordPolicy
+	Hasher   core.PasswordHasher
+	Sessions *session.Issuer
+
+	// ResetURL is the page where users can set a new password. The reset
+	// token is added to it as the 'token' query parameter.
+	ResetURL string
+	ResetTTL time.Duration
+}
+
+func (pa *Auth) Authenticate(ctx context.Context, token string) (*core.Session, error) {
+	return pa.Sessions.Authenticate(ctx, token)
+}
+
+// Signup registers a new user with given credentials and returns a new
+// session for the user.
+func (pa *Auth) Signup(ctx context.Context, email, username, pwd string) (*core.Session, error) {
+	email = strings.TrimSpace(email)
+	username = strings.TrimSpace(username)
+
+	if err := pa.ensureFree(ctx, core.NewAuthKey(core.KeyKindEmail, email)); err != nil {
+		return nil, err
+	}
+	if username != "" {
+		if err := pa.ensureFree(ctx, core.NewAuthKey(core.KeyKindUsername, username)); err != nil {
+			return nil, err
+		}
+	}
+
+	u := core.NewUser("password", username, email)
+	if err := u.Validate(); err != nil {
+		return nil, err
+	}
+
+	hash, err := pa.hashPassword(pwd, u)
+	if err != nil {
+		return nil, err
+	}
+	u.PwdHash = &hash
+
+	created, err := pa.Users.Upsert(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return pa.Sessions.Issue(ctx, *created)
+}
+
+// Login verifies the credentials and returns a new session. The key can
+// be either email or username of the user. If the stored hash uses an
+// outdated algorithm or cost, it is transparently replaced.
+func (pa *Auth) Login(ctx context.Context, key, pwd string) (*core.Session, error) {
+	key = strings.TrimSpace(key)
+
+	authKey := core.NewAuthKey(core.KeyKindUsername, key)
+	if strutils.IsValidEmail(key) {
+		authKey = core.NewAuthKey(core.KeyKindEmail, key)
+	}
+
+	u, err := pa.Users.Get(ctx, authKey)
+	if err != nil {
+		if errors.Is(err, errors.NotFound) {
+			return nil, errBadCreds
+		}
+		return nil, err
+	}
+
+	if err := pa.verify(ctx, *u, pwd); err != nil {
+		return nil, err
+	}
+	return pa.Sessions.Issue(ctx, *u)
+}
+
+// VerifyPassword checks the password of the user (e.g., to confirm a
+// sensitive change). Wrong passwords count towards the same throttle as
+// the logins.
+func (pa *Auth) VerifyPassword(ctx context.Context, userID, pwd string) error {
+	u, err := pa.Users.Get(ctx, core.NewAuthKey(core.KeyKindID, userID))
+	if err != nil {
+		return err
+	}
+	return pa.verify(ctx, *u, pwd)
+}
+
+// Logout invalidates the session identified by the token.
+func (pa *Auth) Logout(ctx context.Context, token string) error {
+	return pa.Sessions.Revoke(ctx, token)
+}
+
+// ForgotPassword mails a password reset link to the user with given email.
+// To avoid revealing which emails are registered, the mail is sent in the
+// background and neither the result nor the timing depends on the email.
+// Failures are logged.
+func (pa *Auth) ForgotPassword(ctx context.Context, email string) error {
+	if pa.Tokens == nil || pa.Mailer == nil {
+		return errNoRecovery
+	}
+
+	bgCtx := core.NewCtx(context.Background(), core.FromCtx(ctx))
+	go func() {
+		if err := pa.sendReset(bgCtx, email); err != nil {
+			log.Warn(bgCtx, "failed to send password reset mail", core.M{"error": err.Error()})
+		}
+	}()
+	return nil
+}
+
+func (pa *Auth) sendReset(ctx context.Context, email string) error {
+	u, err := pa.Users.Get(ctx, core.NewAuthKey(core.KeyKindEmail, strings.TrimSpace(email)))
+	if err != nil {
+		if errors.OneOf(err, []error{errors.NotFound, errors.InvalidInput}) {
+			return nil
+		}
+		return err
+	}
+
+	ttl := pa.ResetTTL
+	if ttl <= 0 {
+		ttl = defaultResetTTL
+	}
+
+	raw, tok := core.NewToken(TokenKindReset, u.ID, ttl)
+	if err := pa.Tokens.Put(ctx, tok); err != nil {
+		return err
+	}
+
+	link, err := url.Parse(pa.ResetURL)
+	if err != nil {
+		return errors.InternalIssue.CausedBy(err).Hintf("invalid reset url")
+	}
+	q := link.Query()
+	q.Set("token", raw)
+	link.RawQuery = q.Encode()
+
+	return pa.Mailer.Send(ctx, core.Mail{
+		To:      []string{u.Email},
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf(resetMailBody, u.Username, link, tok.ExpiresAt.Format(time.RFC1123)),
+	})
+}
+
+// ResetPassword sets a new password for the user that owns the reset
+// token, revokes all existing sessions of the user and returns the ID of
+// the user. Token is single use. Without a session store, the revocation
+// is kept in memory only and is lost on restart and not shared between
+// replicas.
+func (pa *Auth) ResetPassword(ctx context.Context, token, pwd string) (string, error) {
+	if pa.Tokens == nil {
+		return "", errNoRecovery
+	}
+
+	tok, err := pa.Tokens.Take(ctx, TokenKindReset, core.HashToken(token))
+	if err != nil {
+		if errors.Is(err, errors.NotFound) {
+			return "", errBadToken.Hintf("unknown or expired token")
+		}
+		return "", err
+	}
+
+	u, err := pa.Users.Get(ctx, core.NewAuthKey(core.KeyKindID, tok.UserID))
+	if err != nil {
+		if errors.Is(err, errors.NotFound) {
+			return "", errBadToken.Hintf("user no longer exists")
+		}
+		return "", err
+	}
+
+	hash, err := pa.hashPassword(pwd, *u)
+	if err != nil {
+		// restore the token so that the user can retry.
+		_ = pa.Tokens.Put(ctx, *tok)
+		return "", err
+	}
+
+	u.PwdHash = &hash
+	if _, err := pa.Users.Upsert(ctx, *u); err != nil {
+		return "", err
+	}
+	if err := pa.Sessions.RevokeUser(ctx, u.ID); err != nil {
+		return "", err
+	}
+	return u.ID, nil
+}
+
+// ChangePassword sets a new password for the user after verifying the
+// current password. Sessions of the user are not revoked.
+func (pa *Auth) ChangePassword(ctx context.Context, userID, current, pwd string) error {
+	u, err := pa.Users.Get(ctx, core.NewAuthKey(core.KeyKindID, userID))
+	if err != nil {
+		return err
+	}
+
+	if u.PwdHash == nil {
+		return errors.InvalidInput.Coded("no_password").Hintf("no password is set, use password reset instead")
+	} else if err := pa.verify(ctx, *u, current); err != nil {
+		if errors.Is(err, errors.MissingAuth) {
+			return errors.Forbidden.Coded("invalid_password").Hintf("current password does not match")
+		}
+		return err
+	}
+
+	hash, err := pa.hashPassword(pwd, *u)
+	if err != nil {
+		return err
+	}
+
+	u.PwdHash = &hash
+	_, err = pa.Users.Upsert(ctx, *u)
+	return err
+}
+
+// verify checks the password of the user. Wrong passwords are counted
+// and the verification is locked after too many of them.
+func (pa *Auth) verify(ctx context.Context, u core.User, pwd string) error {
+	failures, err := pa.takeFailures(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+
+	count, _ := failures.Attribs["count"].(float64)
+	if count >= maxFailures {
+		pa.putFailures(ctx, failures)
+		return errLocked
+	}
+
+	if u.PwdHash == nil {
+		return errBadCreds
+	}
+
+	match, needsRehash := pa.hasher().Verify(*u.PwdHash, pwd)
+	if !match {
+		failures.Attribs["count"] = count + 1
+		pa.putFailures(ctx, failures)
+		return errBadCreds
+	} else if needsRehash {
+		pa.rehash(ctx, u, pwd)
+	}
+	// the counter was taken and is hence reset.
+	return nil
+}
+
+// takeFailures takes the wrong password counter of the user from the
+// token store. A new counter is returned if there is none.
+func (pa *Auth) takeFailures(ctx context.Context, userID string) (core.Token, error) {
+	if pa.Tokens != nil {
+		tok, err := pa.Tokens.Take(ctx, tokenKindFailures, userID)
+		if err == nil {
+			return *tok, nil
+		} else if !errors.Is(err, errors.NotFound) {
+			return core.Token{}, err
+		}
+	}
+
+	return core.Token{
+		Kind:      tokenKindFailures,
+		Hash:      userID,
+		UserID:    userID,
+		Attribs:   core.M{"count": float64(0)},
+		ExpiresAt: time.Now().Add(failureWindow),
+	}, nil
+}
+
+func (pa *Auth) putFailures(ctx context.Context, tok core.Token) {
+	if pa.Tokens == nil {
+		return
+	}
+
+	if err := pa.Tokens.Put(ctx, tok); err != nil {
+		log.Warn(ctx, "failed to record wrong password", core.M{"user_id": tok.UserID, "error": err.Error()})
+	}
+}
+
+func (pa *Auth) hashPassword(pwd string, u core.User) (string, error) {
+	policy := core.DefaultPasswordPolicy
+	if pa.Policy != nil {
+		policy = *pa.Policy
+	}
+
+	if err := policy.Check(pwd, &u); err != nil {
+		return "", err
+	}
+	return pa.hasher().Hash(pwd)
+}
+
+// rehash upgrades the password hash of the user. Failures are logged and
+// not returned since the login itself has succeeded.
+func (pa *Auth) rehash(ctx context.Context, u core.User, pwd string) {
+	hash, err := pa.hasher().Hash(pwd)
+	if err == nil {
+		u.PwdHash = &hash
+		_, err = pa.Users.Upsert(ctx, u)
+	}
+
+	if err != nil {
+		log.Warn(ctx, "failed to upgrade password hash", core.M{"user_id": u.ID, "error": err.Error()})
+	}
+}
+
+func (pa *Auth) hasher() core.PasswordHasher {
+	if pa.Hasher == nil {
+		return core.DefaultPasswordHasher
+	}
+	return pa.Hasher
+}
+
+func (pa *Auth) ensureFree(ctx context.Context, key string) error {
+	_, err := pa.Users.Get(ctx, key)
+	if err == nil {
+		kind, _ := core.SplitAuthKey(key)
+		return errors.Conflict.Coded(kind+"_taken").Hintf("%s is already registered", kind)
+	} else if !errors.Is(err, errors.NotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package password_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/builtins/memstore"
+	"github.com/spy16/forge/builtins/password"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/pwdhash"
+	"github.com/spy16/forge/core/session"
+)
+
+func TestAuth(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	pa := newAuth(t)
+
+	sess, err := pa.Signup(ctx, "bob@bobmail.com", "bob", "s3cr3t-pwd")
+	require.NoError(t, err)
+	assert.Nil(t, sess.User.PwdHash)
+
+	_, err = pa.Signup(ctx, "bob@bobmail.com", "", "s3cr3t-pwd")
+	assert.ErrorIs(t, err, errors.Conflict)
+
+	t.Run("Login", func(t *testing.T) {
+		for _, key := range []string{"bob@bobmail.com", "bob"} {
+			got, err := pa.Login(ctx, key, "s3cr3t-pwd")
+			require.NoError(t, err)
+			assert.Equal(t, sess.User.ID, got.User.ID)
+		}
+
+		_, err := pa.Login(ctx, "bob", "wrong-pwd")
+		assert.ErrorIs(t, err, errors.MissingAuth)
+
+		_, err = pa.Login(ctx, "alice", "s3cr3t-pwd")
+		assert.ErrorIs(t, err, errors.MissingAuth)
+	})
+
+	t.Run("Logout", func(t *testing.T) {
+		got, err := pa.Login(ctx, "bob", "s3cr3t-pwd")
+		require.NoError(t, err)
+
+		_, err = pa.Authenticate(ctx, got.Token)
+		require.NoError(t, err)
+
+		require.NoError(t, pa.Logout(ctx, got.Token))
+		_, err = pa.Authenticate(ctx, got.Token)
+		assert.ErrorIs(t, err, errors.MissingAuth)
+	})
+}
+
+func TestAuth_ResetPassword(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	pa := newAuth(t)
+
+	sess, err := pa.Signup(ctx, "bob@bobmail.com", "bob", "s3cr3t-pwd")
+	require.NoError(t, err)
+
+	// unknown emails are not revealed. mails are sent in the background.
+	require.NoError(t, pa.ForgotPassword(ctx, "alice@bobmail.com"))
+	require.NoError(t, pa.ForgotPassword(ctx, "bob@bobmail.com"))
+
+	capture := pa.Mailer.(*mailCapture)
+	require.Eventually(t, func() bool { return len(capture.sent()) > 0 }, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	mails := capture.sent()
+	require.Len(t, mails, 1)
+	assert.Equal(t, []string{"bob@bobmail.com"}, mails[0].To)
+
+	link, err := url.Parse(strings.TrimSpace(strings.Split(mails[0].Body, "\n\n")[2]))
+	require.NoError(t, err)
+	token := link.Query().Get("token")
+	require.NotEmpty(t, token)
+
+	_, err = pa.ResetPassword(ctx, token, "short")
+	assert.ErrorIs(t, err, errors.InvalidInput)
+
+	userID, err := pa.ResetPassword(ctx, token, "n3w-s3cr3t-pwd")
+	require.NoError(t, err)
+	assert.Equal(t, sess.User.ID, userID)
+
+	// token is single-use.
+	_, err = pa.ResetPassword(ctx, token, "n3w-s3cr3t-pwd")
+	assert.ErrorIs(t, err, errors.InvalidInput)
+
+	// old sessions are revoked.
+	_, err = pa.Authenticate(ctx, sess.Token)
+	assert.ErrorIs(t, err, errors.MissingAuth)
+
+	_, err = pa.Login(ctx, "bob", "s3cr3t-pwd")
+	assert.ErrorIs(t, err, errors.MissingAuth)
+	_, err = pa.Login(ctx, "bob", "n3w-s3cr3t-pwd")
+	assert.NoError(t, err)
+}
+
+func TestAuth_Login_rehash(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	pa := newAuth(t)
+	pa.Hasher = &pwdhash.Hasher{Primary: &pwdhash.Bcrypt{Cost: 4}}
+
+	sess, err := pa.Signup(ctx, "bob@bobmail.com", "bob", "s3cr3t-pwd")
+	require.NoError(t, err)
+
+	pa.Hasher = &pwdhash.Hasher{
+		Primary: &pwdhash.Argon2id{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16},
+		Others:  []pwdhash.Algorithm{&pwdhash.Bcrypt{Cost: 4}},
+	}
+
+	_, err = pa.Login(ctx, "bob", "s3cr3t-pwd")
+	require.NoError(t, err)
+
+	u, err := pa.Users.Get(ctx, core.NewAuthKey(core.KeyKindID, sess.User.ID))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(*u.PwdHash, "$argon2id$"))
+
+	_, err = pa.Login(ctx, "bob", "s3cr3t-pwd")
+	assert.NoError(t, err)
+}
+
+func TestAuth_ChangePassword(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	pa := newAuth(t)
+
+	sess, err := pa.Signup(ctx, "bob@bobmail.com", "bob", "s3cr3t-pwd")
+	require.NoError(t, err)
+
+	err = pa.ChangePassword(ctx, sess.User.ID, "wrong-pwd", "n3w-s3cr3t-pwd")
+	assert.ErrorIs(t, err, errors.Forbidden)
+
+	err = pa.ChangePassword(ctx, sess.User.ID, "s3cr3t-pwd", "short")
+	assert.ErrorIs(t, err, errors.InvalidInput)
+
+	require.NoError(t, pa.ChangePassword(ctx, sess.User.ID, "s3cr3t-pwd", "n3w-s3cr3t-pwd"))
+
+	_, err = pa.Login(ctx, "bob", "s3cr3t-pwd")
+	assert.ErrorIs(t, err, errors.MissingAuth)
+	_, err = pa.Login(ctx, "bob", "n3w-s3cr3t-pwd")
+	assert.NoError(t, err)
+
+	// users without password must use the reset flow.
+	u, err := pa.Users.Upsert(ctx, core.NewUser("magic_link", "alice", "alice@bobmail.com"))
+	require.NoError(t, err)
+	err = pa.ChangePassword(ctx, u.ID, "", "n3w-s3cr3t-pwd")
+	assert.ErrorIs(t, err, errors.InvalidInput)
+}
+
+func TestAuth_VerifyPassword(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	pa := newAuth(t)
+	pa.Hasher = &pwdhash.Hasher{Primary: &pwdhash.Bcrypt{Cost: 4}}
+
+	sess, err := pa.Signup(ctx, "bob@bobmail.com", "bob", "s3cr3t-pwd")
+	require.NoError(t, err)
+
+	assert.NoError(t, pa.VerifyPassword(ctx, sess.User.ID, "s3cr3t-pwd"))
+
+	// wrong passwords lock both the verification and the login.
+	for i := 0; i < 5; i++ {
+		err := pa.VerifyPassword(ctx, sess.User.ID, "wrong-pwd")
+		assert.ErrorIs(t, err, errors.MissingAuth)
+	}
+	assert.ErrorIs(t, pa.VerifyPassword(ctx, sess.User.ID, "s3cr3t-pwd"), errors.Throttled)
+
+	_, err = pa.Login(ctx, "bob", "s3cr3t-pwd")
+	assert.ErrorIs(t, err, errors.Throttled)
+}
+
+func newAuth(t *testing.T) *password.Auth {
+	t.Helper()
+
+	key, err := session.NewHMACKey("k1", []byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	issuer, err := session.New("forge", time.Hour, "k1", key)
+	require.NoError(t, err)
+
+	return &password.Auth{
+		Users:    memstore.NewUsers(),
+		Tokens:   memstore.NewTokens(),
+		Mailer:   &mailCapture{},
+		Sessions: issuer,
+		ResetURL: "http://localhost/reset-password",
+	}
+}
+
+type mailCapture struct {
+	mu    sync.Mutex
+	mails []core.Mail
+}
+
+func (mc *mailCapture) Send(_ context.Context, mail core.Mail) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.mails = append(mc.mails, mail)
+	return nil
+}
+
+func (mc *mailCapture) sent() []core.Mail {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return append([]core.Mail{}, mc.mails...)
+}
@@ -0,0 +1,119 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+const apiKeyColumns = `id, name, prefix, hash, user_id, org_id, scopes, created_at, expires_at, last_used_at, revoked_at`
+
+// APIKeyStore implements core.APIKeyStore using the SQL store.
+type APIKeyStore struct {
+	*Store
+}
+
+func (ks *APIKeyStore) Create(ctx context.Context, key core.APIKey) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+
+	scopes, _ := json.Marshal(nonNil(key.Scopes))
+
+	const q = `INSERT INTO forge_api_keys (` + apiKeyColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := ks.db.ExecContext(ctx, ks.rebind(q),
+		key.ID, key.Name, key.Prefix, key.Hash, key.UserID, key.OrgID, string(scopes),
+		key.CreatedAt, key.ExpiresAt, key.LastUsedAt, key.RevokedAt,
+	)
+	if err != nil && isUniqueViolation(err) {
+		return errors.Conflict.CausedBy(err).Hintf("api key already exists")
+	}
+	return err
+}
+
+func (ks *APIKeyStore) Get(ctx context.Context, id string) (*core.APIKey, error) {
+	const q = `SELECT ` + apiKeyColumns + ` FROM forge_api_keys WHERE id = ?`
+	return ks.getOne(ctx, q, id)
+}
+
+func (ks *APIKeyStore) Find(ctx context.Context, hash string) (*core.APIKey, error) {
+	const q = `SELECT ` + apiKeyColumns + ` FROM forge_api_keys WHERE hash = ?`
+	return ks.getOne(ctx, q, hash)
+}
+
+func (ks *APIKeyStore) List(ctx context.Context, userID, orgID string) ([]core.APIKey, error) {
+	const q = `SELECT ` + apiKeyColumns + ` FROM forge_api_keys
+		WHERE (CAST(? AS TEXT) = '' OR user_id = ?) AND (CAST(? AS TEXT) = '' OR org_id = ?)
+		ORDER BY created_at`
+
+	rows, err := ks.db.QueryContext(ctx, ks.rebind(q), userID, userID, orgID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var res []core.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *key)
+	}
+	return res, rows.Err()
+}
+
+func (ks *APIKeyStore) Touch(ctx context.Context, id string, at time.Time) error {
+	const q = `UPDATE forge_api_keys SET last_used_at = ? WHERE id = ?`
+	return ks.update(ctx, q, at, id)
+}
+
+func (ks *APIKeyStore) Revoke(ctx context.Context, id string) error {
+	const q = `UPDATE forge_api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?`
+	return ks.update(ctx, q, time.Now(), id)
+}
+
+func (ks *APIKeyStore) update(ctx context.Context, q string, at time.Time, id string) error {
+	res, err := ks.db.ExecContext(ctx, ks.rebind(q), at, id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.NotFound.Hintf("api key '%s' not found", id)
+	}
+	return nil
+}
+
+func (ks *APIKeyStore) getOne(ctx context.Context, q string, arg string) (*core.APIKey, error) {
+	key, err := scanAPIKey(ks.db.QueryRowContext(ctx, ks.rebind(q), arg))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NotFound.Hintf("api key not found")
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (*core.APIKey, error) {
+	var key core.APIKey
+	var scopes string
+	if err := row.Scan(
+		&key.ID, &key.Name, &key.Prefix, &key.Hash, &key.UserID, &key.OrgID, &scopes,
+		&key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
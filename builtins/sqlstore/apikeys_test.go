@@ -0,0 +1,56 @@
+package sqlstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+func TestAPIKeyStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ks := openSQLite(t).APIKeys()
+
+	raw, key := core.NewAPIKey("bob", "ci", []string{"posts:read"}, time.Hour)
+	require.NoError(t, ks.Create(ctx, key))
+	assert.ErrorIs(t, ks.Create(ctx, key), errors.Conflict)
+
+	_, orgKey := core.NewAPIKey("bob", "deploy", nil, 0)
+	orgKey.OrgID = "acme"
+	require.NoError(t, ks.Create(ctx, orgKey))
+
+	got, err := ks.Find(ctx, core.HashToken(raw))
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, got.ID)
+	assert.Equal(t, []string{"posts:read"}, got.Scopes)
+	assert.True(t, got.Active())
+
+	_, err = ks.Find(ctx, core.HashToken("fk_unknown"))
+	assert.ErrorIs(t, err, errors.NotFound)
+
+	all, err := ks.List(ctx, "bob", "")
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	orgKeys, err := ks.List(ctx, "", "acme")
+	require.NoError(t, err)
+	require.Len(t, orgKeys, 1)
+	assert.Equal(t, orgKey.ID, orgKeys[0].ID)
+
+	require.NoError(t, ks.Touch(ctx, key.ID, time.Now()))
+	require.NoError(t, ks.Revoke(ctx, key.ID))
+	assert.ErrorIs(t, ks.Revoke(ctx, "unknown"), errors.NotFound)
+
+	got, err = ks.Get(ctx, key.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, got.LastUsedAt)
+	assert.NotNil(t, got.RevokedAt)
+	assert.False(t, got.Active())
+}
@@ -0,0 +1,84 @@
+package sqlstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+const defAuditLimit = 50
+
+// AuditLog implements core.AuditLog using the SQL store.
+type AuditLog struct {
+	*Store
+}
+
+func (al *AuditLog) Append(ctx context.Context, ev core.AuditEvent) error {
+	if ev.Action == "" {
+		return errors.InvalidInput.Hintf("action must be set")
+	}
+
+	attribs, err := json.Marshal(ev.Attribs)
+	if err != nil {
+		return errors.InvalidInput.CausedBy(err).Hintf("invalid event attribs")
+	}
+
+	const q = `INSERT INTO forge_audit_log (action, actor_id, target_id, request_id, remote_addr, attribs, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err = al.db.ExecContext(ctx, al.rebind(q),
+		ev.Action, ev.ActorID, ev.TargetID, ev.RequestID, ev.RemoteAddr, string(attribs), ev.CreatedAt,
+	)
+	return err
+}
+
+func (al *AuditLog) List(ctx context.Context, q core.AuditQuery) ([]core.AuditEvent, error) {
+	if q.Limit <= 0 {
+		q.Limit = defAuditLimit
+	}
+
+	query := `SELECT id, action, actor_id, target_id, request_id, remote_addr, attribs, created_at
+		FROM forge_audit_log WHERE 1 = 1`
+	var args []any
+	for _, filter := range []struct{ column, value string }{
+		{"action", q.Action},
+		{"actor_id", q.ActorID},
+		{"target_id", q.TargetID},
+	} {
+		if filter.value != "" {
+			query += ` AND ` + filter.column + ` = ?`
+			args = append(args, filter.value)
+		}
+	}
+	if q.Before > 0 {
+		query += ` AND id < ?`
+		args = append(args, q.Before)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, q.Limit)
+
+	rows, err := al.db.QueryContext(ctx, al.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var res []core.AuditEvent
+	for rows.Next() {
+		var ev core.AuditEvent
+		var attribs string
+		if err := rows.Scan(
+			&ev.ID, &ev.Action, &ev.ActorID, &ev.TargetID,
+			&ev.RequestID, &ev.RemoteAddr, &attribs, &ev.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal([]byte(attribs), &ev.Attribs); err != nil {
+			return nil, err
+		}
+		res = append(res, ev)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,54 @@
+package sqlstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+func TestAuditLog(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	al := openSQLite(t).AuditLog()
+
+	now := time.Now()
+	for _, ev := range []core.AuditEvent{
+		{Action: "login", ActorID: "bob", TargetID: "bob", RemoteAddr: "10.0.0.1"},
+		{Action: "login.failed", TargetID: "alice", Attribs: core.M{"reason": "invalid_credentials"}},
+		{Action: "login", ActorID: "alice", TargetID: "alice"},
+		{Action: "api_key.create", ActorID: "bob", TargetID: "k1", RequestID: "req-1"},
+	} {
+		ev.CreatedAt = now
+		require.NoError(t, al.Append(ctx, ev))
+	}
+	assert.ErrorIs(t, al.Append(ctx, core.AuditEvent{CreatedAt: now}), errors.InvalidInput)
+
+	events, err := al.List(ctx, core.AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+	assert.Equal(t, "api_key.create", events[0].Action)
+	assert.Equal(t, "req-1", events[0].RequestID)
+	assert.Equal(t, "10.0.0.1", events[3].RemoteAddr)
+
+	events, err = al.List(ctx, core.AuditQuery{Action: "login", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "alice", events[0].ActorID)
+
+	events, err = al.List(ctx, core.AuditQuery{Action: "login", Before: events[0].ID})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "bob", events[0].ActorID)
+
+	events, err = al.List(ctx, core.AuditQuery{TargetID: "alice"})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "invalid_credentials", events[1].Attribs["reason"])
+}
@@ -0,0 +1,6 @@
+package sqlstore
+
+import "database/sql"
+
+// DB exposes the underlying connection pool to the tests.
+func (st *Store) DB() *sql.DB { return st.db }
@@ -0,0 +1,13 @@
+CREATE TABLE forge_users
+(
+    id           TEXT PRIMARY KEY,
+    email        TEXT        NOT NULL UNIQUE,
+    username     TEXT        NOT NULL UNIQUE,
+    data         JSONB       NOT NULL DEFAULT '{}',
+    attributes   JSONB       NOT NULL DEFAULT '{}',
+    pwd_hash     TEXT,
+    created_at   TIMESTAMPTZ NOT NULL,
+    updated_at   TIMESTAMPTZ NOT NULL,
+    verified_at  TIMESTAMPTZ,
+    verify_token TEXT
+);
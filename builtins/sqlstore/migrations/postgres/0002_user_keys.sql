@@ -0,0 +1,9 @@
+CREATE TABLE forge_user_keys
+(
+    auth_key   TEXT PRIMARY KEY,
+    user_id    TEXT        NOT NULL REFERENCES forge_users (id) ON DELETE CASCADE,
+    attribs    JSONB       NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_forge_user_keys_user_id ON forge_user_keys (user_id);
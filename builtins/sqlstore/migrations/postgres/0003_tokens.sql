@@ -0,0 +1,11 @@
+CREATE TABLE forge_tokens
+(
+    kind       TEXT        NOT NULL,
+    hash       TEXT        NOT NULL,
+    user_id    TEXT        NOT NULL,
+    attribs    JSONB       NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (kind, hash)
+);
+
+CREATE INDEX idx_forge_tokens_expires_at ON forge_tokens (expires_at);
@@ -0,0 +1,2 @@
+ALTER TABLE forge_users ADD COLUMN roles JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE forge_users ADD COLUMN permissions JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,20 @@
+CREATE TABLE forge_orgs
+(
+    id         TEXT PRIMARY KEY,
+    slug       TEXT        NOT NULL UNIQUE,
+    name       TEXT        NOT NULL,
+    data       JSONB       NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE forge_org_members
+(
+    org_id     TEXT        NOT NULL REFERENCES forge_orgs (id) ON DELETE CASCADE,
+    user_id    TEXT        NOT NULL,
+    role       TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX idx_forge_org_members_user_id ON forge_org_members (user_id);
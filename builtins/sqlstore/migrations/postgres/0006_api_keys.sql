@@ -0,0 +1,17 @@
+CREATE TABLE forge_api_keys
+(
+    id           TEXT PRIMARY KEY,
+    name         TEXT        NOT NULL,
+    prefix       TEXT        NOT NULL,
+    hash         TEXT        NOT NULL UNIQUE,
+    user_id      TEXT        NOT NULL,
+    org_id       TEXT        NOT NULL DEFAULT '',
+    scopes       JSONB       NOT NULL DEFAULT '[]',
+    created_at   TIMESTAMPTZ NOT NULL,
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE INDEX idx_forge_api_keys_user_id ON forge_api_keys (user_id);
+CREATE INDEX idx_forge_api_keys_org_id ON forge_api_keys (org_id);
@@ -0,0 +1,13 @@
+CREATE TABLE forge_sessions
+(
+    id           TEXT PRIMARY KEY,
+    user_id      TEXT        NOT NULL,
+    user_agent   TEXT        NOT NULL DEFAULT '',
+    remote_addr  TEXT        NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL,
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE INDEX idx_forge_sessions_user_id ON forge_sessions (user_id);
@@ -0,0 +1,14 @@
+CREATE TABLE forge_audit_log
+(
+    id          BIGSERIAL PRIMARY KEY,
+    action      TEXT        NOT NULL,
+    actor_id    TEXT        NOT NULL DEFAULT '',
+    target_id   TEXT        NOT NULL DEFAULT '',
+    request_id  TEXT        NOT NULL DEFAULT '',
+    remote_addr TEXT        NOT NULL DEFAULT '',
+    attribs     JSONB       NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_forge_audit_log_actor_id ON forge_audit_log (actor_id);
+CREATE INDEX idx_forge_audit_log_target_id ON forge_audit_log (target_id);
@@ -0,0 +1,13 @@
+CREATE TABLE forge_users
+(
+    id           TEXT PRIMARY KEY,
+    email        TEXT      NOT NULL UNIQUE,
+    username     TEXT      NOT NULL UNIQUE,
+    data         TEXT      NOT NULL DEFAULT '{}',
+    attributes   TEXT      NOT NULL DEFAULT '{}',
+    pwd_hash     TEXT,
+    created_at   TIMESTAMP NOT NULL,
+    updated_at   TIMESTAMP NOT NULL,
+    verified_at  TIMESTAMP,
+    verify_token TEXT
+);
@@ -0,0 +1,2 @@
+ALTER TABLE forge_users ADD COLUMN roles TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE forge_users ADD COLUMN permissions TEXT NOT NULL DEFAULT '[]';
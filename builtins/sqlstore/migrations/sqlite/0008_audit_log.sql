@@ -0,0 +1,14 @@
+CREATE TABLE forge_audit_log
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    action      TEXT      NOT NULL,
+    actor_id    TEXT      NOT NULL DEFAULT '',
+    target_id   TEXT      NOT NULL DEFAULT '',
+    request_id  TEXT      NOT NULL DEFAULT '',
+    remote_addr TEXT      NOT NULL DEFAULT '',
+    attribs     TEXT      NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_forge_audit_log_actor_id ON forge_audit_log (actor_id);
+CREATE INDEX idx_forge_audit_log_target_id ON forge_audit_log (target_id);
@@ -0,0 +1,3 @@
+ALTER TABLE forge_users ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idx_forge_users_deleted_at ON forge_users (deleted_at);
@@ -0,0 +1 @@
+CREATE UNIQUE INDEX idx_forge_users_email_lower ON forge_users (lower(email));
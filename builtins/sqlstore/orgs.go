@@ -0,0 +1,187 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+const (
+	orgColumns    = `id, slug, name, data, created_at, updated_at`
+	memberColumns = `org_id, user_id, role, created_at`
+)
+
+// OrgRegistry implements core.OrgRegistry using the SQL store.
+type OrgRegistry struct {
+	*Store
+}
+
+func (or *OrgRegistry) Get(ctx context.Context, idOrSlug string) (*core.Org, error) {
+	// id match takes precedence over slug match.
+	const q = `SELECT ` + orgColumns + ` FROM forge_orgs WHERE id = ? OR slug = ? ORDER BY (id = ?) DESC LIMIT 1`
+
+	var org core.Org
+	var data string
+	err := or.db.QueryRowContext(ctx, or.rebind(q), idOrSlug, idOrSlug, idOrSlug).Scan(
+		&org.ID, &org.Slug, &org.Name, &data, &org.CreatedAt, &org.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NotFound.Hintf("org '%s' not found", idOrSlug)
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(data), &org.Data); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (or *OrgRegistry) Upsert(ctx context.Context, org core.Org) (*core.Org, error) {
+	if err := org.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if org.CreatedAt.IsZero() {
+		org.CreatedAt = now
+	}
+	org.UpdatedAt = now
+
+	data, err := json.Marshal(org.Data)
+	if err != nil {
+		return nil, errors.InvalidInput.CausedBy(err).Hintf("invalid org data")
+	}
+
+	const q = `INSERT INTO forge_orgs (` + orgColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			slug = excluded.slug,
+			name = excluded.name,
+			data = excluded.data,
+			updated_at = excluded.updated_at`
+
+	_, err = or.db.ExecContext(ctx, or.rebind(q),
+		org.ID, org.Slug, org.Name, string(data), org.CreatedAt, org.UpdatedAt,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.Conflict.Coded("slug_taken").CausedBy(err).Hintf("slug is already in use")
+		}
+		return nil, err
+	}
+
+	return or.Get(ctx, org.ID)
+}
+
+func (or *OrgRegistry) Delete(ctx context.Context, orgID string) error {
+	return or.withTx(ctx, func(tx *sql.Tx) error {
+		const delMembers = `DELETE FROM forge_org_members WHERE org_id = ?`
+		if _, err := tx.ExecContext(ctx, or.rebind(delMembers), orgID); err != nil {
+			return err
+		}
+
+		const delOrg = `DELETE FROM forge_orgs WHERE id = ?`
+		res, err := tx.ExecContext(ctx, or.rebind(delOrg), orgID)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return errors.NotFound.Hintf("org '%s' not found", orgID)
+		}
+		return nil
+	})
+}
+
+func (or *OrgRegistry) Member(ctx context.Context, orgID, userID string) (*core.Membership, error) {
+	const q = `SELECT ` + memberColumns + ` FROM forge_org_members WHERE org_id = ? AND user_id = ?`
+
+	var m core.Membership
+	err := or.db.QueryRowContext(ctx, or.rebind(q), orgID, userID).Scan(
+		&m.OrgID, &m.UserID, &m.Role, &m.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NotFound.Hintf("user is not a member of the org")
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (or *OrgRegistry) Members(ctx context.Context, orgID string) ([]core.Membership, error) {
+	const q = `SELECT ` + memberColumns + ` FROM forge_org_members WHERE org_id = ? ORDER BY created_at`
+	return or.listMembers(ctx, q, orgID)
+}
+
+func (or *OrgRegistry) UserOrgs(ctx context.Context, userID string) ([]core.Membership, error) {
+	const q = `SELECT ` + memberColumns + ` FROM forge_org_members WHERE user_id = ? ORDER BY created_at`
+	return or.listMembers(ctx, q, userID)
+}
+
+func (or *OrgRegistry) PutMember(ctx context.Context, m core.Membership) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+
+	return or.withTx(ctx, func(tx *sql.Tx) error {
+		var exists bool
+		const getOrg = `SELECT EXISTS (SELECT 1 FROM forge_orgs WHERE id = ?)`
+		if err := tx.QueryRowContext(ctx, or.rebind(getOrg), m.OrgID).Scan(&exists); err != nil {
+			return err
+		} else if !exists {
+			return errors.NotFound.Hintf("org '%s' not found", m.OrgID)
+		}
+
+		const q = `INSERT INTO forge_org_members (` + memberColumns + `)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT (org_id, user_id) DO UPDATE SET role = excluded.role`
+		_, err := tx.ExecContext(ctx, or.rebind(q), m.OrgID, m.UserID, m.Role, m.CreatedAt)
+		return err
+	})
+}
+
+func (or *OrgRegistry) RemoveMember(ctx context.Context, orgID, userID string) error {
+	const q = `DELETE FROM forge_org_members WHERE org_id = ? AND user_id = ?`
+	res, err := or.db.ExecContext(ctx, or.rebind(q), orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.NotFound.Hintf("user is not a member of the org")
+	}
+	return nil
+}
+
+func (or *OrgRegistry) listMembers(ctx context.Context, q string, arg string) ([]core.Membership, error) {
+	rows, err := or.db.QueryContext(ctx, or.rebind(q), arg)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var res []core.Membership
+	for rows.Next() {
+		var m core.Membership
+		if err := rows.Scan(&m.OrgID, &m.UserID, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	return res, rows.Err()
+}
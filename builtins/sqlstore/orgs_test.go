@@ -0,0 +1,70 @@
+package sqlstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+func TestOrgRegistry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	reg := openSQLite(t).Orgs()
+
+	acme := core.NewOrg("acme", "Acme Inc")
+	created, err := reg.Upsert(ctx, acme)
+	require.NoError(t, err)
+	assert.Equal(t, acme.ID, created.ID)
+
+	for _, key := range []string{acme.ID, acme.Slug} {
+		got, err := reg.Get(ctx, key)
+		require.NoError(t, err, key)
+		assert.Equal(t, "Acme Inc", got.Name)
+	}
+
+	_, err = reg.Upsert(ctx, core.NewOrg("acme", "Other"))
+	assert.ErrorIs(t, err, errors.Conflict)
+
+	t.Run("Members", func(t *testing.T) {
+		require.NoError(t, reg.PutMember(ctx, core.Membership{OrgID: acme.ID, UserID: "bob", Role: core.OrgRoleOwner}))
+		require.NoError(t, reg.PutMember(ctx, core.Membership{OrgID: acme.ID, UserID: "alice", Role: core.OrgRoleMember}))
+		require.NoError(t, reg.PutMember(ctx, core.Membership{OrgID: acme.ID, UserID: "alice", Role: core.OrgRoleAdmin}))
+
+		err := reg.PutMember(ctx, core.Membership{OrgID: "unknown", UserID: "bob", Role: core.OrgRoleMember})
+		assert.ErrorIs(t, err, errors.NotFound)
+
+		m, err := reg.Member(ctx, acme.ID, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, core.OrgRoleAdmin, m.Role)
+
+		members, err := reg.Members(ctx, acme.ID)
+		require.NoError(t, err)
+		assert.Len(t, members, 2)
+
+		orgs, err := reg.UserOrgs(ctx, "bob")
+		require.NoError(t, err)
+		require.Len(t, orgs, 1)
+		assert.Equal(t, acme.ID, orgs[0].OrgID)
+
+		require.NoError(t, reg.RemoveMember(ctx, acme.ID, "alice"))
+		_, err = reg.Member(ctx, acme.ID, "alice")
+		assert.ErrorIs(t, err, errors.NotFound)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, reg.Delete(ctx, acme.ID))
+
+		_, err := reg.Get(ctx, acme.Slug)
+		assert.ErrorIs(t, err, errors.NotFound)
+
+		orgs, err := reg.UserOrgs(ctx, "bob")
+		require.NoError(t, err)
+		assert.Empty(t, orgs)
+	})
+}
@@ -0,0 +1,131 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+const sessionColumns = `id, user_id, user_agent, remote_addr, created_at, last_seen_at, expires_at, revoked_at`
+
+// SessionStore implements core.SessionStore using the SQL store.
+type SessionStore struct {
+	*Store
+}
+
+func (ss *SessionStore) Create(ctx context.Context, rec core.SessionRecord) error {
+	if rec.ID == "" || rec.UserID == "" {
+		return errors.InvalidInput.Hintf("id and user_id must be set")
+	}
+
+	return ss.withTx(ctx, func(tx *sql.Tx) error {
+		// drop the expired sessions of the user.
+		const prune = `DELETE FROM forge_sessions WHERE user_id = ? AND expires_at < ?`
+		if _, err := tx.ExecContext(ctx, ss.rebind(prune), rec.UserID, time.Now()); err != nil {
+			return err
+		}
+
+		const q = `INSERT INTO forge_sessions (` + sessionColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		_, err := tx.ExecContext(ctx, ss.rebind(q),
+			rec.ID, rec.UserID, rec.UserAgent, rec.RemoteAddr,
+			rec.CreatedAt, rec.LastSeenAt, rec.ExpiresAt, rec.RevokedAt,
+		)
+		if err != nil && isUniqueViolation(err) {
+			return errors.Conflict.CausedBy(err).Hintf("session with id '%s' exists", rec.ID)
+		}
+		return err
+	})
+}
+
+func (ss *SessionStore) Get(ctx context.Context, id string) (*core.SessionRecord, error) {
+	const q = `SELECT ` + sessionColumns + ` FROM forge_sessions WHERE id = ?`
+
+	rec, err := scanSession(ss.db.QueryRowContext(ctx, ss.rebind(q), id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NotFound.Hintf("session '%s' not found", id)
+		}
+		return nil, err
+	}
+	return rec, nil
+}
+
+func (ss *SessionStore) List(ctx context.Context, userID string) ([]core.SessionRecord, error) {
+	const q = `SELECT ` + sessionColumns + ` FROM forge_sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY created_at`
+
+	rows, err := ss.db.QueryContext(ctx, ss.rebind(q), userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var res []core.SessionRecord
+	for rows.Next() {
+		rec, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *rec)
+	}
+	return res, rows.Err()
+}
+
+func (ss *SessionStore) Touch(ctx context.Context, id string, at time.Time) error {
+	const q = `UPDATE forge_sessions SET last_seen_at = ? WHERE id = ?`
+	return ss.update(ctx, q, at, id)
+}
+
+func (ss *SessionStore) Extend(ctx context.Context, id string, expiresAt time.Time) error {
+	const q = `UPDATE forge_sessions SET expires_at = ? WHERE id = ?`
+	return ss.update(ctx, q, expiresAt, id)
+}
+
+func (ss *SessionStore) Revoke(ctx context.Context, id string) error {
+	const q = `UPDATE forge_sessions SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?`
+	return ss.update(ctx, q, time.Now(), id)
+}
+
+func (ss *SessionStore) RevokeUser(ctx context.Context, userID string, except ...string) error {
+	q := `UPDATE forge_sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`
+	args := []any{time.Now(), userID}
+	if len(except) > 0 {
+		q += ` AND id NOT IN (?` + strings.Repeat(`, ?`, len(except)-1) + `)`
+		for _, id := range except {
+			args = append(args, id)
+		}
+	}
+
+	_, err := ss.db.ExecContext(ctx, ss.rebind(q), args...)
+	return err
+}
+
+func (ss *SessionStore) update(ctx context.Context, q string, at time.Time, id string) error {
+	res, err := ss.db.ExecContext(ctx, ss.rebind(q), at, id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.NotFound.Hintf("session '%s' not found", id)
+	}
+	return nil
+}
+
+func scanSession(row interface{ Scan(dest ...any) error }) (*core.SessionRecord, error) {
+	var rec core.SessionRecord
+	if err := row.Scan(
+		&rec.ID, &rec.UserID, &rec.UserAgent, &rec.RemoteAddr,
+		&rec.CreatedAt, &rec.LastSeenAt, &rec.ExpiresAt, &rec.RevokedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
@@ -0,0 +1,79 @@
+package sqlstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+func TestSessionStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ss := openSQLite(t).Sessions()
+
+	now := time.Now()
+	newRec := func(id, userID string, ttl time.Duration) core.SessionRecord {
+		return core.SessionRecord{
+			ID:         id,
+			UserID:     userID,
+			UserAgent:  "curl/8.0",
+			RemoteAddr: "10.0.0.1",
+			CreatedAt:  now,
+			LastSeenAt: now,
+			ExpiresAt:  now.Add(ttl),
+		}
+	}
+
+	require.NoError(t, ss.Create(ctx, newRec("s1", "bob", time.Hour)))
+	require.NoError(t, ss.Create(ctx, newRec("s2", "bob", time.Hour)))
+	require.NoError(t, ss.Create(ctx, newRec("s3", "bob", time.Hour)))
+	require.NoError(t, ss.Create(ctx, newRec("s4", "bob", -time.Hour)))
+	require.NoError(t, ss.Create(ctx, newRec("a1", "alice", time.Hour)))
+	assert.ErrorIs(t, ss.Create(ctx, newRec("s1", "bob", time.Hour)), errors.Conflict)
+
+	got, err := ss.Get(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, "curl/8.0", got.UserAgent)
+	assert.True(t, got.Active())
+
+	_, err = ss.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, errors.NotFound)
+
+	// expired sessions are not listed.
+	list, err := ss.List(ctx, "bob")
+	require.NoError(t, err)
+	assert.Len(t, list, 3)
+
+	require.NoError(t, ss.Touch(ctx, "s1", now.Add(time.Minute)))
+	assert.ErrorIs(t, ss.Touch(ctx, "unknown", now), errors.NotFound)
+
+	require.NoError(t, ss.Extend(ctx, "s2", now.Add(2*time.Hour)))
+	got, err = ss.Get(ctx, "s2")
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.Add(2*time.Hour), got.ExpiresAt, time.Second)
+
+	require.NoError(t, ss.Revoke(ctx, "s1"))
+	assert.ErrorIs(t, ss.Revoke(ctx, "unknown"), errors.NotFound)
+
+	got, err = ss.Get(ctx, "s1")
+	require.NoError(t, err)
+	assert.False(t, got.Active())
+
+	require.NoError(t, ss.RevokeUser(ctx, "bob", "s3"))
+	list, err = ss.List(ctx, "bob")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "s3", list[0].ID)
+
+	// other users are unaffected.
+	list, err = ss.List(ctx, "alice")
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+}
@@ -0,0 +1,192 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	_ "modernc.org/sqlite"
+
+	"github.com/spy16/forge/core/errors"
+)
+
+// Supported SQL drivers.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+//go:embed migrations
+var migrationsFS embed.FS
+
+// Store implements SQL-backed storage for forge modules. SQLite and
+// Postgres are supported.
+type Store struct {
+	db     *sql.DB
+	driver string
+}
+
+// Open opens a new store using the given driver and data-source name.
+func Open(driver, dsn string) (*Store, error) {
+	if driver != DriverSQLite && driver != DriverPostgres {
+		return nil, errors.InvalidInput.Hintf("unsupported sql driver '%s'", driver)
+	}
+
+	if driver == DriverSQLite {
+		// foreign keys are off by default in sqlite and must be enabled on
+		// every connection for the cascades to work.
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "_pragma=foreign_keys(1)"
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if driver == DriverSQLite {
+		// sqlite does not support concurrent writers.
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db, driver: driver}, nil
+}
+
+// Users returns a user registry backed by the store.
+func (st *Store) Users() *UserRegistry { return &UserRegistry{Store: st} }
+
+// Orgs returns an org registry backed by the store.
+func (st *Store) Orgs() *OrgRegistry { return &OrgRegistry{Store: st} }
+
+// APIKeys returns an API key store backed by the store.
+func (st *Store) APIKeys() *APIKeyStore { return &APIKeyStore{Store: st} }
+
+// Sessions returns a session store backed by the store.
+func (st *Store) Sessions() *SessionStore { return &SessionStore{Store: st} }
+
+// Tokens returns a token store backed by the store.
+func (st *Store) Tokens() *TokenStore { return &TokenStore{Store: st} }
+
+// AuditLog returns an audit log backed by the store.
+func (st *Store) AuditLog() *AuditLog { return &AuditLog{Store: st} }
+
+// Close closes the underlying database connections.
+func (st *Store) Close() error { return st.db.Close() }
+
+// Migrate applies all pending schema migrations in order. Each migration
+// runs in its own transaction and applied versions are tracked in the
+// 'forge_migrations' table.
+func (st *Store) Migrate(ctx context.Context) error {
+	const createTable = `CREATE TABLE IF NOT EXISTS forge_migrations (version INTEGER PRIMARY KEY, applied_at TIMESTAMP NOT NULL)`
+	if _, err := st.db.ExecContext(ctx, createTable); err != nil {
+		return err
+	}
+
+	applied := map[int]bool{}
+	rows, err := st.db.QueryContext(ctx, `SELECT version FROM forge_migrations`)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return err
+		}
+		applied[v] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	dir := path.Join("migrations", st.driver)
+	entries, err := migrationsFS.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		version, err := strconv.Atoi(strings.SplitN(entry.Name(), "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("invalid migration file name '%s': %w", entry.Name(), err)
+		} else if applied[version] {
+			continue
+		}
+
+		script, err := migrationsFS.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		if err := st.withTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+				return fmt.Errorf("migration '%s' failed: %w", entry.Name(), err)
+			}
+
+			const markApplied = `INSERT INTO forge_migrations (version, applied_at) VALUES (?, ?)`
+			_, err := tx.ExecContext(ctx, st.rebind(markApplied), version, time.Now())
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (st *Store) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// rebind converts '?' placeholders to the form supported by the driver.
+func (st *Store) rebind(query string) string {
+	if st.driver != DriverPostgres {
+		return query
+	}
+
+	var sb strings.Builder
+	n := 0
+	for _, ch := range query {
+		if ch == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+		} else {
+			sb.WriteRune(ch)
+		}
+	}
+	return sb.String()
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
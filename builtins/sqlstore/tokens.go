@@ -0,0 +1,67 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+// TokenStore implements core.TokenStore using the SQL store.
+type TokenStore struct {
+	*Store
+}
+
+func (ts *TokenStore) Put(ctx context.Context, tok core.Token) error {
+	attribs, err := json.Marshal(tok.Attribs)
+	if err != nil {
+		return errors.InvalidInput.CausedBy(err).Hintf("invalid token attribs")
+	}
+
+	const purge = `DELETE FROM forge_tokens WHERE expires_at < ?`
+	if _, err := ts.db.ExecContext(ctx, ts.rebind(purge), time.Now()); err != nil {
+		return err
+	}
+
+	const q = `INSERT INTO forge_tokens (kind, hash, user_id, attribs, expires_at) VALUES (?, ?, ?, ?, ?)`
+	_, err = ts.db.ExecContext(ctx, ts.rebind(q), tok.Kind, tok.Hash, tok.UserID, string(attribs), tok.ExpiresAt)
+	if err != nil && isUniqueViolation(err) {
+		return errors.Conflict.CausedBy(err).Hintf("token already exists")
+	}
+	return err
+}
+
+func (ts *TokenStore) Take(ctx context.Context, kind, hash string) (*core.Token, error) {
+	// a single delete ensures that only one of the concurrent takes gets
+	// the token.
+	const q = `DELETE FROM forge_tokens WHERE kind = ? AND hash = ? RETURNING kind, hash, user_id, attribs, expires_at`
+
+	var tok core.Token
+	var attribs string
+	if err := ts.db.QueryRowContext(ctx, ts.rebind(q), kind, hash).Scan(
+		&tok.Kind, &tok.Hash, &tok.UserID, &attribs, &tok.ExpiresAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NotFound.Hintf("token not found")
+		}
+		return nil, err
+	}
+
+	if tok.ExpiresAt.Before(time.Now()) {
+		return nil, errors.NotFound.Hintf("token expired")
+	}
+
+	if err := json.Unmarshal([]byte(attribs), &tok.Attribs); err != nil {
+		return nil, err
+	}
+	return &tok, nil
+}
+
+func (ts *TokenStore) Revoke(ctx context.Context, kind, userID string) error {
+	const q = `DELETE FROM forge_tokens WHERE kind = ? AND user_id = ?`
+	_, err := ts.db.ExecContext(ctx, ts.rebind(q), kind, userID)
+	return err
+}
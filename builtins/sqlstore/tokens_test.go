@@ -0,0 +1,83 @@
+package sqlstore_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+func TestTokenStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ts := openSQLite(t).Tokens()
+
+	raw, tok := core.NewToken("pwd_reset", "bob", time.Minute)
+	tok.Attribs = core.M{"foo": "bar"}
+	require.NoError(t, ts.Put(ctx, tok))
+
+	got, err := ts.Take(ctx, "pwd_reset", core.HashToken(raw))
+	require.NoError(t, err)
+	assert.Equal(t, "bob", got.UserID)
+	assert.Equal(t, "bar", got.Attribs["foo"])
+
+	_, err = ts.Take(ctx, "pwd_reset", core.HashToken(raw))
+	assert.ErrorIs(t, err, errors.NotFound)
+
+	expiredRaw, expired := core.NewToken("pwd_reset", "bob", -time.Minute)
+	require.NoError(t, ts.Put(ctx, expired))
+	_, err = ts.Take(ctx, "pwd_reset", core.HashToken(expiredRaw))
+	assert.ErrorIs(t, err, errors.NotFound)
+
+	t.Run("Revoke", func(t *testing.T) {
+		bobRaw, bobTok := core.NewToken("pwd_reset", "bob", time.Minute)
+		aliceRaw, aliceTok := core.NewToken("pwd_reset", "alice", time.Minute)
+		otherRaw, otherTok := core.NewToken("email_change", "bob", time.Minute)
+		for _, tok := range []core.Token{bobTok, aliceTok, otherTok} {
+			require.NoError(t, ts.Put(ctx, tok))
+		}
+
+		require.NoError(t, ts.Revoke(ctx, "pwd_reset", "bob"))
+
+		_, err := ts.Take(ctx, "pwd_reset", core.HashToken(bobRaw))
+		assert.ErrorIs(t, err, errors.NotFound)
+		_, err = ts.Take(ctx, "pwd_reset", core.HashToken(aliceRaw))
+		assert.NoError(t, err)
+		_, err = ts.Take(ctx, "email_change", core.HashToken(otherRaw))
+		assert.NoError(t, err)
+	})
+}
+
+func TestTokenStore_Take_concurrent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ts := openSQLite(t).Tokens()
+
+	raw, tok := core.NewToken("refresh", "bob", time.Minute)
+	require.NoError(t, ts.Put(ctx, tok))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ts.Take(ctx, "refresh", core.HashToken(raw)); err == nil {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, taken)
+}
@@ -0,0 +1,268 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+const userColumns = `id, email, username, data, attributes, pwd_hash, created_at, updated_at, verified_at, verify_token, roles, permissions, deleted_at`
+
+var userKeyColumns = map[string]string{
+	core.KeyKindID:       "id",
+	core.KeyKindEmail:    "email",
+	core.KeyKindUsername: "username",
+}
+
+// UserRegistry implements core.UserRegistry using the SQL store.
+type UserRegistry struct {
+	*Store
+}
+
+func (ur *UserRegistry) Get(ctx context.Context, key string) (*core.User, error) {
+	if err := core.ValidateAuthKey(key); err != nil {
+		return nil, err
+	}
+
+	q := `SELECT ` + userColumns + ` FROM forge_users WHERE id = (SELECT user_id FROM forge_user_keys WHERE auth_key = ?)`
+	arg := key
+	if kind, val := core.SplitAuthKey(key); kind == core.KeyKindEmail {
+		// emails are case-insensitive.
+		q = `SELECT ` + userColumns + ` FROM forge_users WHERE lower(email) = lower(?)`
+		arg = val
+	} else if core.IsBuiltinKind(kind) {
+		q = `SELECT ` + userColumns + ` FROM forge_users WHERE ` + userKeyColumns[kind] + ` = ?`
+		arg = val
+	}
+
+	u, err := scanUser(ur.db.QueryRowContext(ctx, ur.rebind(q), arg))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NotFound.Hintf("user with key '%s' not found", key)
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+func (ur *UserRegistry) Upsert(ctx context.Context, u core.User) (*core.User, error) {
+	if err := u.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = now
+	}
+	u.UpdatedAt = now
+
+	data, err := json.Marshal(u.Data)
+	if err != nil {
+		return nil, errors.InvalidInput.CausedBy(err).Hintf("invalid user data")
+	}
+	attribs, err := json.Marshal(u.Attributes)
+	if err != nil {
+		return nil, errors.InvalidInput.CausedBy(err).Hintf("invalid user attributes")
+	}
+	roles, _ := json.Marshal(nonNil(u.Roles))
+	perms, _ := json.Marshal(nonNil(u.Permissions))
+
+	const q = `INSERT INTO forge_users (` + userColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			email = excluded.email,
+			username = excluded.username,
+			data = excluded.data,
+			attributes = excluded.attributes,
+			pwd_hash = excluded.pwd_hash,
+			updated_at = excluded.updated_at,
+			verified_at = excluded.verified_at,
+			verify_token = excluded.verify_token,
+			roles = excluded.roles,
+			permissions = excluded.permissions,
+			deleted_at = excluded.deleted_at`
+
+	_, err = ur.db.ExecContext(ctx, ur.rebind(q),
+		u.ID, u.Email, u.Username, string(data), string(attribs), u.PwdHash,
+		u.CreatedAt, u.UpdatedAt, u.VerifiedAt, u.VerifyToken,
+		string(roles), string(perms), u.DeletedAt,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.Conflict.CausedBy(err).Hintf("email or username already in use")
+		}
+		return nil, err
+	}
+
+	return ur.Get(ctx, core.NewAuthKey(core.KeyKindID, u.ID))
+}
+
+func (ur *UserRegistry) Keys(ctx context.Context, userID string) ([]core.UserKey, error) {
+	u, err := ur.Get(ctx, core.NewAuthKey(core.KeyKindID, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []core.UserKey
+	for _, key := range u.AuthKeys() {
+		keys = append(keys, core.UserKey{AuthKey: key})
+	}
+
+	const q = `SELECT auth_key, attribs FROM forge_user_keys WHERE user_id = ? ORDER BY created_at`
+	rows, err := ur.db.QueryContext(ctx, ur.rebind(q), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var key core.UserKey
+		var attribs string
+		if err := rows.Scan(&key.AuthKey, &attribs); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(attribs), &key.Attribs); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (ur *UserRegistry) AttachKey(ctx context.Context, userID string, key core.UserKey) error {
+	if err := core.ValidateAttachableKey(key.AuthKey); err != nil {
+		return err
+	}
+
+	attribs, err := json.Marshal(key.Attribs)
+	if err != nil {
+		return errors.InvalidInput.CausedBy(err).Hintf("invalid key attribs")
+	}
+
+	return ur.withTx(ctx, func(tx *sql.Tx) error {
+		var ownerID string
+		const getOwner = `SELECT user_id FROM forge_user_keys WHERE auth_key = ?`
+		err := tx.QueryRowContext(ctx, ur.rebind(getOwner), key.AuthKey).Scan(&ownerID)
+		if err == nil && ownerID != userID {
+			return errors.Conflict.Hintf("key is attached to another user")
+		} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		var exists bool
+		const getUser = `SELECT EXISTS (SELECT 1 FROM forge_users WHERE id = ?)`
+		if err := tx.QueryRowContext(ctx, ur.rebind(getUser), userID).Scan(&exists); err != nil {
+			return err
+		} else if !exists {
+			return errors.NotFound.Hintf("user '%s' not found", userID)
+		}
+
+		const upsert = `INSERT INTO forge_user_keys (auth_key, user_id, attribs, created_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (auth_key) DO UPDATE SET attribs = excluded.attribs`
+		_, err = tx.ExecContext(ctx, ur.rebind(upsert), key.AuthKey, userID, string(attribs), time.Now())
+		if err != nil && isUniqueViolation(err) {
+			return errors.Conflict.CausedBy(err).Hintf("key is attached to another user")
+		}
+		return err
+	})
+}
+
+func (ur *UserRegistry) DetachKey(ctx context.Context, userID, authKey string) error {
+	if err := core.ValidateAttachableKey(authKey); err != nil {
+		return err
+	}
+
+	const q = `DELETE FROM forge_user_keys WHERE auth_key = ? AND user_id = ?`
+	res, err := ur.db.ExecContext(ctx, ur.rebind(q), authKey, userID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.NotFound.Hintf("key not attached to user '%s'", userID)
+	}
+	return nil
+}
+
+func (ur *UserRegistry) Purge(ctx context.Context, before time.Time) ([]string, error) {
+	var purged []string
+	err := ur.withTx(ctx, func(tx *sql.Tx) error {
+		const list = `SELECT id FROM forge_users WHERE deleted_at IS NOT NULL AND deleted_at < ?`
+		rows, err := tx.QueryContext(ctx, ur.rebind(list), before)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = rows.Close() }()
+
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			purged = append(purged, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		_ = rows.Close()
+
+		for _, id := range purged {
+			for _, q := range []string{
+				`DELETE FROM forge_org_members WHERE user_id = ?`,
+				`DELETE FROM forge_api_keys WHERE user_id = ?`,
+				`DELETE FROM forge_sessions WHERE user_id = ?`,
+				`DELETE FROM forge_tokens WHERE user_id = ?`,
+				`DELETE FROM forge_user_keys WHERE user_id = ?`,
+				`DELETE FROM forge_users WHERE id = ?`,
+			} {
+				if _, err := tx.ExecContext(ctx, ur.rebind(q), id); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
+
+func scanUser(row interface{ Scan(dest ...any) error }) (*core.User, error) {
+	var u core.User
+	var data, attribs, roles, perms string
+	if err := row.Scan(
+		&u.ID, &u.Email, &u.Username, &data, &attribs, &u.PwdHash,
+		&u.CreatedAt, &u.UpdatedAt, &u.VerifiedAt, &u.VerifyToken,
+		&roles, &perms, &u.DeletedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(data), &u.Data); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(attribs), &u.Attributes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(roles), &u.Roles); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(perms), &u.Permissions); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
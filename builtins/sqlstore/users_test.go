@@ -0,0 +1,229 @@
+package sqlstore_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/builtins/sqlstore"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/strutils"
+)
+
+func TestUserRegistry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := openSQLite(t)
+	reg := st.Users()
+
+	u := core.NewUser("password", "bob", "bob@bobmail.com")
+	u.PwdHash = strutils.Ptr("hash")
+	u.Data["name"] = "Bob"
+	u.Attributes = core.M{"plan": "pro"}
+
+	created, err := reg.Upsert(ctx, u)
+	require.NoError(t, err)
+	assert.Equal(t, u.ID, created.ID)
+	assert.Equal(t, "Bob", created.Data["name"])
+	assert.Equal(t, "pro", created.Attributes["plan"])
+	assert.Equal(t, "hash", *created.PwdHash)
+	assert.Equal(t, *u.VerifyToken, *created.VerifyToken)
+	assert.Nil(t, created.VerifiedAt)
+
+	t.Run("GetByKeys", func(t *testing.T) {
+		for _, key := range []string{
+			core.NewAuthKey(core.KeyKindID, u.ID),
+			core.NewAuthKey(core.KeyKindEmail, u.Email),
+			core.NewAuthKey(core.KeyKindUsername, u.Username),
+		} {
+			got, err := reg.Get(ctx, key)
+			require.NoError(t, err, key)
+			assert.Equal(t, u.ID, got.ID)
+		}
+
+		// emails are case-insensitive.
+		got, err := reg.Get(ctx, core.NewAuthKey(core.KeyKindEmail, "Bob@BobMail.com"))
+		require.NoError(t, err)
+		assert.Equal(t, u.ID, got.ID)
+
+		_, err = reg.Get(ctx, core.NewAuthKey(core.KeyKindEmail, "nobody@bobmail.com"))
+		assert.ErrorIs(t, err, errors.NotFound)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		now := time.Now()
+		created.VerifiedAt = &now
+		created.VerifyToken = nil
+		created.Roles = []string{"admin"}
+		created.Permissions = []string{"posts:*"}
+
+		updated, err := reg.Upsert(ctx, *created)
+		require.NoError(t, err)
+		assert.NotNil(t, updated.VerifiedAt)
+		assert.Nil(t, updated.VerifyToken)
+		assert.Equal(t, []string{"admin"}, updated.Roles)
+		assert.Equal(t, []string{"posts:*"}, updated.Permissions)
+		assert.True(t, created.CreatedAt.Equal(updated.CreatedAt))
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		dup := core.NewUser("password", "alice", "bob@bobmail.com")
+		_, err := reg.Upsert(ctx, dup)
+		assert.ErrorIs(t, err, errors.Conflict)
+
+		dup = core.NewUser("password", "alice", "BOB@bobmail.com")
+		_, err = reg.Upsert(ctx, dup)
+		assert.ErrorIs(t, err, errors.Conflict)
+	})
+}
+
+func TestStore_Migrate(t *testing.T) {
+	t.Parallel()
+
+	st := openSQLite(t)
+	// migrations are idempotent.
+	assert.NoError(t, st.Migrate(context.Background()))
+}
+
+func TestStore_ForeignKeys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := openSQLite(t)
+
+	bob := core.NewUser("password", "bob", "bob@bobmail.com")
+	_, err := st.Users().Upsert(ctx, bob)
+	require.NoError(t, err)
+	require.NoError(t, st.Users().AttachKey(ctx, bob.ID, core.UserKey{AuthKey: "phone/+15550100"}))
+
+	acme := core.NewOrg("acme", "Acme Inc")
+	_, err = st.Orgs().Upsert(ctx, acme)
+	require.NoError(t, err)
+	require.NoError(t, st.Orgs().PutMember(ctx, core.Membership{OrgID: acme.ID, UserID: bob.ID, Role: core.OrgRoleOwner}))
+
+	// deleting the parent rows directly must cascade.
+	_, err = st.DB().ExecContext(ctx, `DELETE FROM forge_users WHERE id = ?`, bob.ID)
+	require.NoError(t, err)
+	_, err = st.DB().ExecContext(ctx, `DELETE FROM forge_orgs WHERE id = ?`, acme.ID)
+	require.NoError(t, err)
+
+	var n int
+	require.NoError(t, st.DB().QueryRowContext(ctx, `SELECT COUNT(*) FROM forge_user_keys`).Scan(&n))
+	assert.Zero(t, n)
+	require.NoError(t, st.DB().QueryRowContext(ctx, `SELECT COUNT(*) FROM forge_org_members`).Scan(&n))
+	assert.Zero(t, n)
+}
+
+func openSQLite(t *testing.T) *sqlstore.Store {
+	t.Helper()
+
+	st, err := sqlstore.Open(sqlstore.DriverSQLite, filepath.Join(t.TempDir(), "forge.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = st.Close() })
+
+	require.NoError(t, st.Migrate(context.Background()))
+	return st
+}
+
+func TestUserRegistry_Keys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	reg := openSQLite(t).Users()
+
+	bob, err := reg.Upsert(ctx, core.NewUser("", "bob", "bob@bobmail.com"))
+	require.NoError(t, err)
+	alice, err := reg.Upsert(ctx, core.NewUser("", "alice", "alice@bobmail.com"))
+	require.NoError(t, err)
+
+	phone := core.UserKey{AuthKey: core.NewAuthKey("phone", "+911234567890"), Attribs: core.M{"verified": true}}
+	require.NoError(t, reg.AttachKey(ctx, bob.ID, phone))
+
+	got, err := reg.Get(ctx, phone.AuthKey)
+	require.NoError(t, err)
+	assert.Equal(t, bob.ID, got.ID)
+
+	keys, err := reg.Keys(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Len(t, keys, 4)
+	assert.Contains(t, keys, phone)
+
+	err = reg.AttachKey(ctx, alice.ID, phone)
+	assert.ErrorIs(t, err, errors.Conflict)
+
+	err = reg.AttachKey(ctx, bob.ID, core.UserKey{AuthKey: core.NewAuthKey(core.KeyKindEmail, "x@bobmail.com")})
+	assert.ErrorIs(t, err, errors.InvalidInput)
+
+	err = reg.AttachKey(ctx, "unknown", core.UserKey{AuthKey: core.NewAuthKey("phone", "123")})
+	assert.ErrorIs(t, err, errors.NotFound)
+
+	require.NoError(t, reg.DetachKey(ctx, bob.ID, phone.AuthKey))
+	_, err = reg.Get(ctx, phone.AuthKey)
+	assert.ErrorIs(t, err, errors.NotFound)
+
+	err = reg.DetachKey(ctx, bob.ID, phone.AuthKey)
+	assert.ErrorIs(t, err, errors.NotFound)
+}
+
+func TestUserRegistry_Purge(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := openSQLite(t)
+	reg := st.Users()
+
+	now := time.Now()
+	bob := core.NewUser("", "bob", "bob@bobmail.com")
+	deletedAt := now.Add(-2 * time.Hour)
+	bob.DeletedAt = &deletedAt
+	_, err := reg.Upsert(ctx, bob)
+	require.NoError(t, err)
+	require.NoError(t, reg.AttachKey(ctx, bob.ID, core.UserKey{AuthKey: "phone/+15550100"}))
+
+	acme := core.NewOrg("acme", "Acme Inc")
+	_, err = st.Orgs().Upsert(ctx, acme)
+	require.NoError(t, err)
+	require.NoError(t, st.Orgs().PutMember(ctx, core.Membership{OrgID: acme.ID, UserID: bob.ID, Role: core.OrgRoleOwner}))
+	_, key := core.NewAPIKey(bob.ID, "ci", nil, 0)
+	require.NoError(t, st.APIKeys().Create(ctx, key))
+	require.NoError(t, st.Sessions().Create(ctx, core.SessionRecord{ID: "s1", UserID: bob.ID, CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)}))
+	_, tok := core.NewToken("pwd_reset", bob.ID, time.Hour)
+	require.NoError(t, st.Tokens().Put(ctx, tok))
+
+	alice := core.NewUser("", "alice", "alice@bobmail.com")
+	recent := now.Add(-time.Minute)
+	alice.DeletedAt = &recent
+	_, err = reg.Upsert(ctx, alice)
+	require.NoError(t, err)
+
+	purged, err := reg.Purge(ctx, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{bob.ID}, purged)
+
+	_, err = reg.Get(ctx, "email/bob@bobmail.com")
+	assert.ErrorIs(t, err, errors.NotFound)
+	_, err = reg.Get(ctx, "phone/+15550100")
+	assert.ErrorIs(t, err, errors.NotFound)
+
+	// data of the purged user goes along with it.
+	for _, table := range []string{"forge_org_members", "forge_api_keys", "forge_sessions", "forge_tokens"} {
+		var n int
+		require.NoError(t, st.DB().QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&n))
+		assert.Zero(t, n, table)
+	}
+
+	// users in the grace period are retained.
+	got, err := reg.Get(ctx, "email/alice@bobmail.com")
+	require.NoError(t, err)
+	assert.NotNil(t, got.DeletedAt)
+
+	// the email of the purged user is free again.
+	_, err = reg.Upsert(ctx, core.NewUser("", "bob", "bob@bobmail.com"))
+	assert.NoError(t, err)
+}
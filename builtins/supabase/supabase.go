@@ -12,10 +12,13 @@ import (
 	"github.com/spy16/forge/core/errors"
 )
 
-// Auth implements auth module for supabase-based user management.
+// Auth implements auth module for supabase-based user management. If
+// Users is set, the identity is persisted in the registry on every
+// successful authentication.
 type Auth struct {
-	APIKey    string `json:"api_key"`
-	ProjectID string `json:"project_id"`
+	Users     core.UserRegistry `json:"-"`
+	APIKey    string            `json:"api_key"`
+	ProjectID string            `json:"project_id"`
 }
 
 func (sb *Auth) Authenticate(ctx context.Context, token string) (*core.Session, error) {
@@ -51,18 +54,32 @@ func (sb *Auth) Authenticate(ctx context.Context, token string) (*core.Session,
 		return nil, errors.InternalIssue.Hintf("supabase returned invalid response").CausedBy(err)
 	}
 
-	return &core.Session{
-		User: core.User{
-			ID: userData.ID,
-			Data: map[string]any{
-				"name":    userData.UserMetadata.Name,
-				"picture": userData.UserMetadata.AvatarURL,
-			},
-			Email:     userData.Email,
-			CreatedAt: userData.CreatedAt,
-			UpdatedAt: userData.UpdatedAt,
+	u := core.User{
+		ID: userData.ID,
+		Data: map[string]any{
+			"name":    userData.UserMetadata.Name,
+			"picture": userData.UserMetadata.AvatarURL,
 		},
-		Token: token,
+		Email:     userData.Email,
+		CreatedAt: userData.CreatedAt,
+		UpdatedAt: userData.UpdatedAt,
+	}
+	if !userData.EmailConfirmedAt.IsZero() {
+		u.VerifiedAt = &userData.EmailConfirmedAt
+	}
+
+	if sb.Users != nil {
+		local, err := core.UpsertIdentity(ctx, sb.Users, core.NewAuthKey("supabase", userData.ID), u)
+		if err != nil {
+			return nil, err
+		}
+		u = local.Clone(true)
+	}
+
+	return &core.Session{
+		User:     u,
+		Token:    token,
+		AuthTime: userData.LastSignInAt,
 	}, nil
 }
 
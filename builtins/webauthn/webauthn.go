@@ -0,0 +1,505 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+// COSE algorithm identifiers of the supported credential keys.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+
+	defaultTimeout = 5 * time.Minute
+)
+
+var (
+	errBadResponse  = errors.InvalidInput.Coded("invalid_webauthn_response")
+	errBadAssertion = errors.MissingAuth.Coded("invalid_webauthn_assertion")
+)
+
+// RelyingParty performs the server side of the WebAuthn registration and
+// authentication ceremonies. Attestation statements are not verified (i.e.,
+// attestation conveyance 'none') and hence the authenticator model is not
+// trusted, only the possession of the private key.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+
+	// RequireUserVerification rejects ceremonies where the authenticator
+	// did not verify the user (e.g., via biometrics or PIN).
+	RequireUserVerification bool
+
+	// Timeout is the ceremony timeout hinted to the client. Defaults to
+	// 5 minutes.
+	Timeout time.Duration
+}
+
+// User is the user entity included in the registration options.
+type User struct {
+	ID          string
+	Name        string
+	DisplayName string
+}
+
+// Credential is a registered public-key credential.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key encoded.
+	Alg       int
+	SignCount uint32
+}
+
+// Assertion is the result of a successful authentication ceremony.
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// AttestationResponse is the JSON form of the PublicKeyCredential returned
+// by 'navigator.credentials.create()'. Binary fields are base64url.
+type AttestationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of the PublicKeyCredential returned
+// by 'navigator.credentials.get()'. Binary fields are base64url.
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+type authData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+	CredID    []byte
+	PublicKey []byte
+}
+
+// NewChallenge returns a new random challenge in base64url form.
+func NewChallenge() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Encode returns the base64url form of the binary value as used in the
+// JSON forms of the ceremonies.
+func Encode(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// Decode decodes a base64url value with or without padding.
+func Decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// CreationOptions returns the options for 'navigator.credentials.create()'.
+// Credentials in exclude are not registered again on the same device.
+func (rp *RelyingParty) CreationOptions(challenge string, u User, exclude [][]byte) core.M {
+	excluded := make([]core.M, 0, len(exclude))
+	for _, id := range exclude {
+		excluded = append(excluded, core.M{"type": "public-key", "id": Encode(id)})
+	}
+
+	return core.M{
+		"challenge": challenge,
+		"rp":        core.M{"id": rp.ID, "name": rp.Name},
+		"user": core.M{
+			"id":          Encode([]byte(u.ID)),
+			"name":        u.Name,
+			"displayName": u.DisplayName,
+		},
+		"pubKeyCredParams": []core.M{
+			{"type": "public-key", "alg": AlgES256},
+			{"type": "public-key", "alg": AlgEdDSA},
+			{"type": "public-key", "alg": AlgRS256},
+		},
+		"timeout":            rp.timeout().Milliseconds(),
+		"attestation":        "none",
+		"excludeCredentials": excluded,
+		"authenticatorSelection": core.M{
+			"residentKey":      "preferred",
+			"userVerification": rp.userVerification(),
+		},
+	}
+}
+
+// RequestOptions returns the options for 'navigator.credentials.get()'.
+// If allow is empty, the client offers discoverable credentials.
+func (rp *RelyingParty) RequestOptions(challenge string, allow [][]byte) core.M {
+	allowed := make([]core.M, 0, len(allow))
+	for _, id := range allow {
+		allowed = append(allowed, core.M{"type": "public-key", "id": Encode(id)})
+	}
+
+	return core.M{
+		"challenge":        challenge,
+		"rpId":             rp.ID,
+		"timeout":          rp.timeout().Milliseconds(),
+		"userVerification": rp.userVerification(),
+		"allowCredentials": allowed,
+	}
+}
+
+// Challenge returns the challenge signed in the response. It can be used
+// to look up the ceremony state before verification.
+func (ar *AttestationResponse) Challenge() (string, error) {
+	cd, _, err := parseClientData(ar.Response.ClientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	return cd.Challenge, nil
+}
+
+// Challenge returns the challenge signed in the response. It can be used
+// to look up the ceremony state before verification.
+func (ar *AssertionResponse) Challenge() (string, error) {
+	cd, _, err := parseClientData(ar.Response.ClientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	return cd.Challenge, nil
+}
+
+// CredentialID returns the decoded ID of the credential used.
+func (ar *AssertionResponse) CredentialID() ([]byte, error) {
+	id, err := Decode(ar.RawID)
+	if err != nil || len(id) == 0 {
+		return nil, errBadResponse.Hintf("rawId is not valid base64url")
+	}
+	return id, nil
+}
+
+// VerifyRegistration verifies the response of a registration ceremony
+// started with the challenge and returns the new credential.
+func (rp *RelyingParty) VerifyRegistration(resp AttestationResponse, challenge string) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, errBadResponse.Hintf("credential type must be 'public-key'")
+	}
+
+	cd, _, err := parseClientData(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	} else if err := rp.checkClientData(cd, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	rawAtt, err := Decode(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, errBadResponse.Hintf("attestationObject is not valid base64url")
+	}
+	v, _, err := decodeCBOR(rawAtt)
+	if err != nil {
+		return nil, errBadResponse.CausedBy(err).Hintf("attestationObject is not valid cbor")
+	}
+	att, ok := v.(map[any]any)
+	if !ok {
+		return nil, errBadResponse.Hintf("attestationObject must be a map")
+	}
+	// attestation statements are not verified since 'none' is requested.
+	// clients may still pass through other formats.
+	if _, ok := att["fmt"].(string); !ok {
+		return nil, errBadResponse.Hintf("attestation format is missing")
+	}
+	rawAuth, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, errBadResponse.Hintf("authData is missing")
+	}
+
+	ad, err := parseAuthData(rawAuth)
+	if err != nil {
+		return nil, err
+	} else if err := rp.checkAuthData(ad); err != nil {
+		return nil, err
+	} else if ad.Flags&flagAttested == 0 || len(ad.CredID) == 0 {
+		return nil, errBadResponse.Hintf("attested credential data is missing")
+	}
+
+	if rawID, err := Decode(resp.RawID); err != nil || !bytes.Equal(rawID, ad.CredID) {
+		return nil, errBadResponse.Hintf("rawId does not match the attested credential")
+	}
+
+	_, alg, err := parsePublicKey(ad.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        ad.CredID,
+		PublicKey: ad.PublicKey,
+		Alg:       alg,
+		SignCount: ad.SignCount,
+	}, nil
+}
+
+// VerifyAssertion verifies the response of an authentication ceremony
+// started with the challenge against the stored credential. A sign count
+// that does not increase indicates a cloned authenticator and is rejected.
+func (rp *RelyingParty) VerifyAssertion(resp AssertionResponse, challenge string, cred Credential) (*Assertion, error) {
+	if resp.Type != "public-key" {
+		return nil, errBadResponse.Hintf("credential type must be 'public-key'")
+	}
+
+	if id, err := resp.CredentialID(); err != nil {
+		return nil, err
+	} else if !bytes.Equal(id, cred.ID) {
+		return nil, errBadAssertion.Hintf("credential does not match")
+	}
+
+	cd, rawCD, err := parseClientData(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	} else if err := rp.checkClientData(cd, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	rawAuth, err := Decode(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, errBadResponse.Hintf("authenticatorData is not valid base64url")
+	}
+	ad, err := parseAuthData(rawAuth)
+	if err != nil {
+		return nil, err
+	} else if err := rp.checkAuthData(ad); err != nil {
+		return nil, err
+	}
+
+	sig, err := Decode(resp.Response.Signature)
+	if err != nil {
+		return nil, errBadResponse.Hintf("signature is not valid base64url")
+	}
+
+	cdHash := sha256.Sum256(rawCD)
+	signed := append(append([]byte(nil), rawAuth...), cdHash[:]...)
+	if err := verifySignature(cred.PublicKey, signed, sig); err != nil {
+		return nil, err
+	}
+
+	if (ad.SignCount != 0 || cred.SignCount != 0) && ad.SignCount <= cred.SignCount {
+		return nil, errBadAssertion.Coded("webauthn_cloned").Hintf("sign count did not increase, authenticator may be cloned")
+	}
+
+	return &Assertion{
+		SignCount:    ad.SignCount,
+		UserVerified: ad.Flags&flagUserVerified != 0,
+	}, nil
+}
+
+func (rp *RelyingParty) checkClientData(cd *clientData, typ, challenge string) error {
+	if cd.Type != typ {
+		return errBadResponse.Hintf("client data type must be '%s'", typ)
+	} else if challenge == "" || subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(challenge)) != 1 {
+		return errBadResponse.Hintf("challenge does not match")
+	} else if cd.CrossOrigin {
+		return errBadResponse.Hintf("cross-origin ceremonies are not allowed")
+	}
+
+	for _, origin := range rp.Origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return errBadResponse.Hintf("origin '%s' is not allowed", cd.Origin)
+}
+
+func (rp *RelyingParty) checkAuthData(ad *authData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(ad.RPIDHash, rpIDHash[:]) != 1 {
+		return errBadResponse.Hintf("rp id does not match")
+	} else if ad.Flags&flagUserPresent == 0 {
+		return errBadResponse.Hintf("user presence is required")
+	} else if rp.RequireUserVerification && ad.Flags&flagUserVerified == 0 {
+		return errBadResponse.Hintf("user verification is required")
+	}
+	return nil
+}
+
+func (rp *RelyingParty) timeout() time.Duration {
+	if rp.Timeout <= 0 {
+		return defaultTimeout
+	}
+	return rp.Timeout
+}
+
+func (rp *RelyingParty) userVerification() string {
+	if rp.RequireUserVerification {
+		return "required"
+	}
+	return "preferred"
+}
+
+func parseClientData(s string) (*clientData, []byte, error) {
+	raw, err := Decode(s)
+	if err != nil {
+		return nil, nil, errBadResponse.Hintf("clientDataJSON is not valid base64url")
+	}
+
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, nil, errBadResponse.CausedBy(err).Hintf("clientDataJSON is not valid json")
+	}
+	return &cd, raw, nil
+}
+
+// parseAuthData parses the authenticator data. Layout: rpIdHash (32) |
+// flags (1) | signCount (4) | [aaguid (16) | credIdLen (2) | credId |
+// credentialPublicKey] | [extensions].
+func parseAuthData(b []byte) (*authData, error) {
+	if len(b) < 37 {
+		return nil, errBadResponse.Hintf("authenticator data is too short")
+	}
+
+	ad := &authData{
+		RPIDHash:  b[:32],
+		Flags:     b[32],
+		SignCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	if ad.Flags&flagAttested == 0 {
+		return ad, nil
+	}
+
+	rest := b[37:]
+	if len(rest) < 18 {
+		return nil, errBadResponse.Hintf("attested credential data is too short")
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return nil, errBadResponse.Hintf("credential id is truncated")
+	}
+	ad.CredID = append([]byte(nil), rest[:idLen]...)
+	rest = rest[idLen:]
+
+	_, n, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, errBadResponse.CausedBy(err).Hintf("credential public key is not valid cbor")
+	}
+	ad.PublicKey = append([]byte(nil), rest[:n]...)
+	return ad, nil
+}
+
+// parsePublicKey parses the COSE_Key of one of the supported algorithms.
+func parsePublicKey(coseKey []byte) (crypto.PublicKey, int, error) {
+	v, _, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, 0, errBadResponse.CausedBy(err).Hintf("public key is not valid cbor")
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, 0, errBadResponse.Hintf("public key must be a map")
+	}
+
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	crv, _ := m[int64(-1)].(int64)
+	x, _ := m[int64(-2)].([]byte)
+
+	switch {
+	case kty == 2 && alg == AlgES256 && crv == 1:
+		y, _ := m[int64(-3)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, 0, errBadResponse.Hintf("invalid ec2 key coordinates")
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, errBadResponse.Hintf("ec2 key is not on the curve")
+		}
+		return pub, AlgES256, nil
+
+	case kty == 1 && alg == AlgEdDSA && crv == 6:
+		if len(x) != ed25519.PublicKeySize {
+			return nil, 0, errBadResponse.Hintf("invalid okp key")
+		}
+		return ed25519.PublicKey(x), AlgEdDSA, nil
+
+	case kty == 3 && alg == AlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, errBadResponse.Hintf("invalid rsa key")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, AlgRS256, nil
+
+	default:
+		return nil, 0, errBadResponse.Coded("unsupported_webauthn_alg").Hintf("key type %d with alg %d is not supported", kty, alg)
+	}
+}
+
+func verifySignature(coseKey, data, sig []byte) error {
+	pub, _, err := parsePublicKey(coseKey)
+	if err != nil {
+		return err
+	}
+
+	var ok bool
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		ok = ecdsa.VerifyASN1(key, digest[:], sig)
+
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, data, sig)
+
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+
+	if !ok {
+		return errBadAssertion.Hintf("signature is not valid")
+	}
+	return nil
+}
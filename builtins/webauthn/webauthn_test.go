@@ -0,0 +1,186 @@
+package webauthn_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/builtins/webauthn"
+	"github.com/spy16/forge/core/errors"
+)
+
+const (
+	rpID   = "example.com"
+	origin = "https://example.com"
+)
+
+func TestRelyingParty(t *testing.T) {
+	t.Parallel()
+
+	rp := &webauthn.RelyingParty{ID: rpID, Name: "Example", Origins: []string{origin}}
+
+	register := func(t *testing.T) (*authenticator, *webauthn.Credential) {
+		auth := newAuthenticator(t)
+		challenge := webauthn.NewChallenge()
+
+		cred, err := rp.VerifyRegistration(auth.create(t, challenge, origin), challenge)
+		require.NoError(t, err)
+		assert.Equal(t, auth.credID, cred.ID)
+		assert.Equal(t, webauthn.AlgES256, cred.Alg)
+		return auth, cred
+	}
+
+	t.Run("Registration", func(t *testing.T) {
+		auth := newAuthenticator(t)
+		challenge := webauthn.NewChallenge()
+
+		resp := auth.create(t, challenge, origin)
+		got, err := resp.Challenge()
+		require.NoError(t, err)
+		assert.Equal(t, challenge, got)
+
+		_, err = rp.VerifyRegistration(resp, webauthn.NewChallenge())
+		assert.ErrorIs(t, err, errors.InvalidInput, "challenge mismatch")
+
+		_, err = rp.VerifyRegistration(auth.create(t, challenge, "https://evil.com"), challenge)
+		assert.ErrorIs(t, err, errors.InvalidInput, "origin mismatch")
+
+		_, err = rp.VerifyRegistration(resp, challenge)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Assertion", func(t *testing.T) {
+		auth, cred := register(t)
+
+		challenge := webauthn.NewChallenge()
+		res, err := rp.VerifyAssertion(auth.get(t, challenge, origin), challenge, *cred)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(1), res.SignCount)
+		assert.True(t, res.UserVerified)
+		cred.SignCount = res.SignCount
+
+		challenge = webauthn.NewChallenge()
+		_, err = rp.VerifyAssertion(auth.get(t, challenge, "https://evil.com"), challenge, *cred)
+		assert.ErrorIs(t, err, errors.InvalidInput)
+	})
+
+	t.Run("BadSignature", func(t *testing.T) {
+		auth, cred := register(t)
+
+		other := newAuthenticator(t)
+		other.credID = auth.credID
+
+		challenge := webauthn.NewChallenge()
+		_, err := rp.VerifyAssertion(other.get(t, challenge, origin), challenge, *cred)
+		assert.ErrorIs(t, err, errors.MissingAuth)
+	})
+
+	t.Run("Cloned", func(t *testing.T) {
+		auth, cred := register(t)
+		cred.SignCount = 10
+
+		challenge := webauthn.NewChallenge()
+		_, err := rp.VerifyAssertion(auth.get(t, challenge, origin), challenge, *cred)
+		assert.ErrorIs(t, err, errors.MissingAuth)
+	})
+
+	t.Run("RequireUserVerification", func(t *testing.T) {
+		strict := *rp
+		strict.RequireUserVerification = true
+
+		auth := newAuthenticator(t)
+		auth.flags &^= 0x04
+
+		challenge := webauthn.NewChallenge()
+		_, err := strict.VerifyRegistration(auth.create(t, challenge, origin), challenge)
+		assert.ErrorIs(t, err, errors.InvalidInput)
+	})
+}
+
+// authenticator is a software authenticator with an ES256 credential.
+type authenticator struct {
+	key       *ecdsa.PrivateKey
+	credID    []byte
+	flags     byte
+	signCount uint32
+}
+
+func newAuthenticator(t *testing.T) *authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credID := make([]byte, 16)
+	_, _ = rand.Read(credID)
+	return &authenticator{key: key, credID: credID, flags: 0x01 | 0x04}
+}
+
+func (a *authenticator) create(t *testing.T, challenge, origin string) webauthn.AttestationResponse {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+
+	// COSE_Key: {1: 2, 3: -7, -1: 1, -2: x, -3: y}
+	coseKey := []byte{0xa5, 0x01, 0x02, 0x03, 0x26, 0x20, 0x01}
+	coseKey = append(append(coseKey, 0x21, 0x58, 0x20), x...)
+	coseKey = append(append(coseKey, 0x22, 0x58, 0x20), y...)
+
+	attested := make([]byte, 16)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credID)))
+	attested = append(append(attested, a.credID...), coseKey...)
+	authData := append(a.authData(0x40), attested...)
+
+	// {"fmt": "none", "attStmt": {}, "authData": authData}
+	att := []byte{0xa3, 0x63, 'f', 'm', 't', 0x64, 'n', 'o', 'n', 'e'}
+	att = append(att, 0x67, 'a', 't', 't', 'S', 't', 'm', 't', 0xa0)
+	att = append(att, 0x68, 'a', 'u', 't', 'h', 'D', 'a', 't', 'a', 0x59)
+	att = binary.BigEndian.AppendUint16(att, uint16(len(authData)))
+	att = append(att, authData...)
+
+	var resp webauthn.AttestationResponse
+	resp.ID = webauthn.Encode(a.credID)
+	resp.RawID = resp.ID
+	resp.Type = "public-key"
+	resp.Response.ClientDataJSON = webauthn.Encode(clientData(t, "webauthn.create", challenge, origin))
+	resp.Response.AttestationObject = webauthn.Encode(att)
+	return resp
+}
+
+func (a *authenticator) get(t *testing.T, challenge, origin string) webauthn.AssertionResponse {
+	a.signCount++
+	authData := a.authData(0)
+	cd := clientData(t, "webauthn.get", challenge, origin)
+
+	cdHash := sha256.Sum256(cd)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), cdHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+
+	var resp webauthn.AssertionResponse
+	resp.ID = webauthn.Encode(a.credID)
+	resp.RawID = resp.ID
+	resp.Type = "public-key"
+	resp.Response.ClientDataJSON = webauthn.Encode(cd)
+	resp.Response.AuthenticatorData = webauthn.Encode(authData)
+	resp.Response.Signature = webauthn.Encode(sig)
+	return resp
+}
+
+func (a *authenticator) authData(extraFlags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	b := append(rpIDHash[:], a.flags|extraFlags)
+	return binary.BigEndian.AppendUint32(b, a.signCount)
+}
+
+func clientData(t *testing.T, typ, challenge, origin string) []byte {
+	b, err := json.Marshal(map[string]any{"type": typ, "challenge": challenge, "origin": origin})
+	require.NoError(t, err)
+	return b
+}
@@ -2,6 +2,7 @@ package forge
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"time"
@@ -36,6 +37,7 @@ func CLI(name string, forgeOpts ...Option) *cobra.Command {
 
 	cli.AddCommand(
 		cmdServe(name, forgeOpts),
+		cmdMigrate(name),
 		cmdConfigs(name),
 	)
 	return cli
@@ -49,13 +51,14 @@ func cmdServe(name string, forgeOpts []Option) *cobra.Command {
 		Use:   "serve",
 		Short: "Start HTTP server",
 		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
 			cl := makeConfLoader(name, cmd)
 			forgeOpts = append(forgeOpts,
 				WithConfLoader(cl),
-				WithPreHook(func(app PreContext) error {
-					// TODO: initialise modules using config only.
-					return nil
-				}),
+				WithPreHook(initModules),
+				WithPurge(ctx),
 			)
 
 			app, err := Forge(name, forgeOpts...)
@@ -83,6 +86,27 @@ func cmdServe(name string, forgeOpts []Option) *cobra.Command {
 	return cmd
 }
 
+func cmdMigrate(name string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply pending database migrations",
+		Run: func(cmd *cobra.Command, args []string) {
+			cl := makeConfLoader(name, cmd)
+
+			st, err := openStore(cl)
+			if err != nil {
+				log.Fatal(cmd.Context(), "failed to open store", err)
+			}
+			defer func() { _ = st.Close() }()
+
+			if err := st.Migrate(cmd.Context()); err != nil {
+				log.Fatal(cmd.Context(), "migration failed", err)
+			}
+			log.Info(cmd.Context(), "migrations applied")
+		},
+	}
+}
+
 func cmdConfigs(name string) *cobra.Command {
 	return &cobra.Command{
 		Use: "configs",
@@ -0,0 +1,119 @@
+package forge
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+// completeLogin attaches a refresh token to the new session and in cookie
+// mode, sets the session cookie as well.
+func (app *appForge) completeLogin(w http.ResponseWriter, r *http.Request, sess *core.Session) error {
+	if err := app.attachRefresh(w, r, sess); err != nil {
+		return err
+	}
+
+	if app.cookieMode() {
+		app.setAuthCookie(w, sess)
+	}
+	return nil
+}
+
+// setAuthCookie sets the session token as the auth cookie along with the
+// CSRF cookie. The CSRF token is derived from the session token so that
+// it cannot be planted by another (sub-)domain and must be echoed in the
+// CSRF header by scripts of the app.
+func (app *appForge) setAuthCookie(w http.ResponseWriter, sess *core.Session) {
+	http.SetCookie(w, app.cookie(app.confL.String("auth.cookie_name", "_forge_auth"), sess.Token, sess.Expiry, true))
+
+	if app.confL.Bool("auth.csrf.enabled", true) {
+		http.SetCookie(w, app.cookie(app.csrfCookieName(), csrfToken(sess.Token), sess.Expiry, false))
+	}
+}
+
+// clearAuthCookie removes the auth and the CSRF cookies.
+func (app *appForge) clearAuthCookie(w http.ResponseWriter) {
+	for _, c := range []*http.Cookie{
+		app.cookie(app.confL.String("auth.cookie_name", "_forge_auth"), "", time.Time{}, true),
+		app.cookie(app.csrfCookieName(), "", time.Time{}, false),
+	} {
+		c.Expires = time.Time{}
+		c.MaxAge = -1
+		http.SetCookie(w, c)
+	}
+}
+
+// checkCSRF requires the CSRF header for unsafe requests that are
+// authenticated by the auth cookie. Requests with the token in headers
+// cannot be forged by other sites and are not checked.
+func (app *appForge) checkCSRF(r *http.Request, token string, fromCookie bool) error {
+	if !fromCookie || !app.confL.Bool("auth.csrf.enabled", true) {
+		return nil
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return nil
+	}
+
+	got := r.Header.Get(app.confL.String("auth.csrf.header", "X-CSRF-Token"))
+	if got == "" || subtle.ConstantTimeCompare([]byte(got), []byte(csrfToken(token))) != 1 {
+		return errors.Forbidden.Coded("invalid_csrf_token").Hintf("csrf token is missing or invalid")
+	}
+	return nil
+}
+
+// cookie returns an auth cookie with all the 'auth.cookie' configs applied.
+func (app *appForge) cookie(name, value string, expires time.Time, httpOnly bool) *http.Cookie {
+	c := app.baseCookie(name, value, app.confL.String("auth.cookie.path", "/"))
+	c.Expires = expires
+	c.HttpOnly = httpOnly
+
+	if maxAge := app.confL.Duration("auth.cookie.max_age", 0); maxAge > 0 {
+		c.MaxAge = int(maxAge.Seconds())
+		c.Expires = time.Now().Add(maxAge)
+	}
+
+	switch strings.ToLower(app.confL.String("auth.cookie.same_site", "lax")) {
+	case "strict":
+		c.SameSite = http.SameSiteStrictMode
+	case "none":
+		c.SameSite = http.SameSiteNoneMode
+		c.Secure = true
+	default:
+		c.SameSite = http.SameSiteLaxMode
+	}
+	return c
+}
+
+// baseCookie returns an http-only cookie with the domain and the secure
+// flag from the 'auth.cookie' configs. All the cookies of forge must be
+// built from this.
+func (app *appForge) baseCookie(name, value, path string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   app.confL.String("auth.cookie.domain", ""),
+		HttpOnly: true,
+		Secure:   app.confL.Bool("auth.cookie.secure", strings.HasPrefix(baseURL(app.confL), "https://")),
+	}
+}
+
+// cookieMode returns true if json login endpoints must set the session
+// cookie too. Redirect based logins (oauth, magic links) always set it.
+func (app *appForge) cookieMode() bool {
+	return app.confL.Bool("auth.cookie.enabled", false)
+}
+
+func (app *appForge) csrfCookieName() string {
+	return app.confL.String("auth.csrf.cookie_name", "_forge_csrf")
+}
+
+func csrfToken(sessToken string) string {
+	return core.HashToken("csrf:" + sessToken)
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"strings"
+	"time"
+
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/strutils"
+)
+
+// APIKeyPrefix is the prefix of all raw API keys. It allows API keys to
+// be told apart from other tokens and to be detected by secret scanners.
+const APIKeyPrefix = "fk_"
+
+// apiKeyVisibleLen is the length of the raw key retained for display.
+const apiKeyVisibleLen = len(APIKeyPrefix) + 8
+
+// APIKey represents a long-lived key that can be used by machines to act
+// on behalf of a user. Only the hash of the key is stored.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	UserID     string     `json:"user_id"`
+	OrgID      string     `json:"org_id,omitempty"`
+	Scopes     []string   `json:"scopes,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// NewAPIKey generates a new API key for the user. The raw value must be
+// shown to the user once while the returned APIKey must be persisted.
+// Scopes restrict the permissions the key can exercise. If no scopes are
+// set, the key carries all the permissions of the user. If ttl is zero,
+// the key never expires.
+func NewAPIKey(userID, name string, scopes []string, ttl time.Duration) (string, APIKey) {
+	raw := APIKeyPrefix + strutils.RandToken(32)
+
+	key := APIKey{
+		ID:        strutils.RandStr(16),
+		Name:      strings.TrimSpace(name),
+		Prefix:    raw[:apiKeyVisibleLen],
+		Hash:      HashToken(raw),
+		UserID:    userID,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+
+	if ttl > 0 {
+		expiresAt := key.CreatedAt.Add(ttl)
+		key.ExpiresAt = &expiresAt
+	}
+	return raw, key
+}
+
+// IsAPIKey returns true if the token looks like a raw API key.
+func IsAPIKey(token string) bool { return strings.HasPrefix(token, APIKeyPrefix) }
+
+// Validate validates the API key and returns error if invalid.
+func (k *APIKey) Validate() error {
+	var errInvalid = errors.InvalidInput.Coded("invalid_api_key")
+
+	if !idPattern.MatchString(k.ID) {
+		return errInvalid.Hintf("invalid id")
+	}
+
+	if k.Name == "" || len(k.Name) > 64 {
+		return errInvalid.Hintf("name must be 1-64 characters long")
+	}
+
+	if k.UserID == "" || k.Hash == "" {
+		return errInvalid.Hintf("user_id and hash must be set")
+	}
+
+	for _, scope := range k.Scopes {
+		if !ValidPerm(scope) {
+			return errInvalid.Hintf("invalid scope '%s'", scope)
+		}
+	}
+	return nil
+}
+
+// Restricted returns true if the key is limited to some scopes or to an
+// org and must not be accepted by routes that do not check them.
+func (k *APIKey) Restricted() bool { return len(k.Scopes) > 0 || k.OrgID != "" }
+
+// Active returns true if the key is neither revoked nor expired.
+func (k *APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
@@ -0,0 +1,37 @@
+package core_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/core"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	t.Parallel()
+
+	raw, key := core.NewAPIKey("bob", "ci", []string{"posts:*"}, time.Hour)
+	require.NoError(t, key.Validate())
+	assert.True(t, core.IsAPIKey(raw))
+	assert.True(t, strings.HasPrefix(raw, key.Prefix))
+	assert.Equal(t, core.HashToken(raw), key.Hash)
+	assert.True(t, key.Active())
+	assert.True(t, key.Restricted())
+
+	_, forever := core.NewAPIKey("bob", "ci", nil, 0)
+	assert.Nil(t, forever.ExpiresAt)
+	assert.False(t, forever.Restricted())
+	forever.OrgID = "acme"
+	assert.True(t, forever.Restricted())
+
+	now := time.Now()
+	key.RevokedAt = &now
+	assert.False(t, key.Active())
+
+	_, invalid := core.NewAPIKey("bob", "ci", []string{"Posts Read"}, 0)
+	assert.Error(t, invalid.Validate())
+}
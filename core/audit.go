@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// AuditEvent represents a security-relevant action recorded in the audit
+// log. ActorID is the user who performed the action and TargetID is the
+// entity (usually a user) the action was performed on.
+type AuditEvent struct {
+	ID         int64     `json:"id"`
+	Action     string    `json:"action"`
+	ActorID    string    `json:"actor_id,omitempty"`
+	TargetID   string    `json:"target_id,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Attribs    M         `json:"attribs,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AuditQuery filters the events listed from the audit log. Empty fields
+// match all events.
+type AuditQuery struct {
+	Action   string
+	ActorID  string
+	TargetID string
+
+	// Before, if set, limits the result to events older than the event
+	// with this ID. It is used as the cursor for pagination.
+	Before int64
+	Limit  int
+}
+
+// Fill sets the fields of the event that are not set from the request
+// context: the acting user, the request ID and the client IP.
+func (ev AuditEvent) Fill(ctx context.Context) AuditEvent {
+	rc := FromCtx(ctx)
+	if ev.ActorID == "" {
+		ev.ActorID = rc.ActorID()
+	}
+	if ev.RequestID == "" {
+		ev.RequestID = rc.RequestID
+	}
+	if ev.RemoteAddr == "" {
+		ev.RemoteAddr = rc.RemoteAddr
+		if host, _, err := net.SplitHostPort(ev.RemoteAddr); err == nil {
+			ev.RemoteAddr = host
+		}
+	}
+	if ev.CreatedAt.IsZero() {
+		ev.CreatedAt = time.Now()
+	}
+	return ev
+}
+
+// Match returns true if the event satisfies the filters of the query.
+// The cursor and the limit are not considered.
+func (q AuditQuery) Match(ev AuditEvent) bool {
+	return (q.Action == "" || q.Action == ev.Action) &&
+		(q.ActorID == "" || q.ActorID == ev.ActorID) &&
+		(q.TargetID == "" || q.TargetID == ev.TargetID)
+}
@@ -0,0 +1,38 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spy16/forge/core"
+)
+
+func TestAuditEvent_Fill(t *testing.T) {
+	t.Parallel()
+
+	ctx := core.NewCtx(context.Background(), core.ReqCtx{
+		RequestID:  "req-1",
+		RemoteAddr: "10.0.0.1:4242",
+		Session: &core.Session{
+			User:  core.User{ID: "bob"},
+			Actor: &core.Actor{ID: "alice"},
+		},
+	})
+
+	ev := core.AuditEvent{Action: "logout"}.Fill(ctx)
+	assert.Equal(t, "alice", ev.ActorID)
+	assert.Equal(t, "req-1", ev.RequestID)
+	assert.Equal(t, "10.0.0.1", ev.RemoteAddr)
+	assert.False(t, ev.CreatedAt.IsZero())
+
+	// explicitly set fields are retained.
+	ev = core.AuditEvent{Action: "login", ActorID: "bob"}.Fill(ctx)
+	assert.Equal(t, "bob", ev.ActorID)
+
+	// events outside requests have no actor.
+	ev = core.AuditEvent{Action: "login"}.Fill(context.Background())
+	assert.Empty(t, ev.ActorID)
+	assert.Empty(t, ev.RemoteAddr)
+}
@@ -12,18 +12,230 @@ type Auth interface {
 	Authenticate(ctx context.Context, token string) (*Session, error)
 }
 
+// PasswordAuth is an Auth implementation that also supports signup and
+// login using password credentials.
+type PasswordAuth interface {
+	Auth
+	Signup(ctx context.Context, email, username, pwd string) (*Session, error)
+	Login(ctx context.Context, key, pwd string) (*Session, error)
+	Logout(ctx context.Context, token string) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, pwd string) (string, error)
+	ChangePassword(ctx context.Context, userID, current, pwd string) error
+
+	// VerifyPassword returns errors.MissingAuth if the password of the
+	// user does not match and errors.Throttled after too many attempts.
+	VerifyPassword(ctx context.Context, userID, pwd string) error
+}
+
 // UserRegistry implementation is responsible for maintaining user
-// data.
+// data. A user can be resolved using any of its auth keys (e.g., the
+// 'email/bob@bobmail.com'). Keys of builtin kinds (id, email, username)
+// are derived from user fields and are always available. Keys of other
+// kinds (e.g., 'phone/...') must be attached explicitly.
 type UserRegistry interface {
+	// Get returns the user that owns the given auth key. Returns
+	// errors.NotFound if no user owns the key.
 	Get(ctx context.Context, key string) (*User, error)
+
+	// Upsert creates or updates the user identified by the user ID.
+	// Returns errors.Conflict if email or username is in use.
 	Upsert(ctx context.Context, u User) (*User, error)
+
+	// Keys returns all the auth keys of the user including the ones
+	// derived from user fields.
+	Keys(ctx context.Context, userID string) ([]UserKey, error)
+
+	// AttachKey attaches a non-builtin auth key to the user. Returns
+	// errors.Conflict if the key is owned by a different user.
+	AttachKey(ctx context.Context, userID string, key UserKey) error
+
+	// DetachKey detaches the non-builtin auth key from the user.
+	DetachKey(ctx context.Context, userID, authKey string) error
+
+	// Purge permanently removes the users deleted (i.e., DeletedAt set)
+	// before the given time along with their keys. Stores that also keep
+	// orgs, api keys, sessions or tokens must remove the ones of the users
+	// as well. Returns the IDs of the removed users.
+	Purge(ctx context.Context, before time.Time) ([]string, error)
+}
+
+// OrgRegistry implementation is responsible for maintaining orgs and
+// the memberships of users in them.
+type OrgRegistry interface {
+	// Get returns the org with given ID or slug. Returns errors.NotFound
+	// if no such org exists.
+	Get(ctx context.Context, idOrSlug string) (*Org, error)
+
+	// Upsert creates or updates the org identified by the org ID. Returns
+	// errors.Conflict if the slug is in use by another org.
+	Upsert(ctx context.Context, org Org) (*Org, error)
+
+	// Delete deletes the org and all its memberships.
+	Delete(ctx context.Context, orgID string) error
+
+	// Member returns the membership of the user in the org. Returns
+	// errors.NotFound if the user is not a member.
+	Member(ctx context.Context, orgID, userID string) (*Membership, error)
+
+	// Members returns all the memberships of the org.
+	Members(ctx context.Context, orgID string) ([]Membership, error)
+
+	// UserOrgs returns all the memberships of the user.
+	UserOrgs(ctx context.Context, userID string) ([]Membership, error)
+
+	// PutMember creates or updates the membership. Returns errors.NotFound
+	// if the org does not exist.
+	PutMember(ctx context.Context, m Membership) error
+
+	// RemoveMember removes the user from the org.
+	RemoveMember(ctx context.Context, orgID, userID string) error
+}
+
+// TokenStore implementation is responsible for maintaining short-lived,
+// single-use tokens (e.g., password reset tokens). Only the hash of the
+// token is stored.
+type TokenStore interface {
+	// Put stores the token.
+	Put(ctx context.Context, tok Token) error
+
+	// Take returns the token with given kind & hash and removes it from
+	// the store. Returns errors.NotFound if the token does not exist or
+	// has expired.
+	Take(ctx context.Context, kind, hash string) (*Token, error)
+
+	// Revoke removes all the tokens of the kind issued to the user.
+	Revoke(ctx context.Context, kind, userID string) error
+}
+
+// APIKeyStore implementation is responsible for maintaining API keys.
+type APIKeyStore interface {
+	// Create stores the new API key.
+	Create(ctx context.Context, key APIKey) error
+
+	// Get returns the API key with given ID. Returns errors.NotFound if
+	// no such key exists.
+	Get(ctx context.Context, id string) (*APIKey, error)
+
+	// Find returns the API key with the given hash. Returns errors.NotFound
+	// if no such key exists.
+	Find(ctx context.Context, hash string) (*APIKey, error)
+
+	// List returns the keys owned by the user (if userID is set) and/or
+	// scoped to the org (if orgID is set), including revoked ones.
+	List(ctx context.Context, userID, orgID string) ([]APIKey, error)
+
+	// Touch sets the last-used time of the key.
+	Touch(ctx context.Context, id string, at time.Time) error
+
+	// Revoke marks the key as revoked.
+	Revoke(ctx context.Context, id string) error
+}
+
+// SessionStore implementation is responsible for tracking the sessions
+// issued by forge so that they can be listed and revoked.
+type SessionStore interface {
+	// Create stores the record of a newly issued session.
+	Create(ctx context.Context, rec SessionRecord) error
+
+	// Get returns the session record with given ID. Returns errors.NotFound
+	// if no such session exists.
+	Get(ctx context.Context, id string) (*SessionRecord, error)
+
+	// List returns the active sessions of the user.
+	List(ctx context.Context, userID string) ([]SessionRecord, error)
+
+	// Touch sets the last-seen time of the session.
+	Touch(ctx context.Context, id string, at time.Time) error
+
+	// Extend sets the expiry time of the session.
+	Extend(ctx context.Context, id string, expiresAt time.Time) error
+
+	// Revoke marks the session as revoked.
+	Revoke(ctx context.Context, id string) error
+
+	// RevokeUser revokes all the active sessions of the user except the
+	// ones with given IDs.
+	RevokeUser(ctx context.Context, userID string, except ...string) error
+}
+
+// AuditLog implementation is responsible for recording security-relevant
+// events. The log is append-only and events are never modified.
+type AuditLog interface {
+	// Append records the event. The ID of the event is assigned by the
+	// log and must increase with every event.
+	Append(ctx context.Context, ev AuditEvent) error
+
+	// List returns the events matching the query, newest first.
+	List(ctx context.Context, q AuditQuery) ([]AuditEvent, error)
+}
+
+// Token represents a single-use token issued for a user.
+type Token struct {
+	Kind      string    `json:"kind"`
+	Hash      string    `json:"hash"`
+	UserID    string    `json:"user_id"`
+	Attribs   M         `json:"attribs,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Mailer implementation is responsible for delivering emails.
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
+
+// Mail represents a plain-text email message.
+type Mail struct {
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	Body    string   `json:"body"`
 }
 
 // Session represents a login-session for the contained user.
 type Session struct {
+	ID     string    `json:"id,omitempty"`
 	User   User      `json:"user"`
 	Token  string    `json:"token"`
 	Expiry time.Time `json:"expiry"`
+
+	// AuthTime is when the user authenticated. It is retained when the
+	// session is refreshed and can be used to require a recent login.
+	AuthTime time.Time `json:"auth_time"`
+
+	// RefreshToken is set when the session was issued along with a
+	// refresh token.
+	RefreshToken string `json:"refresh_token,omitempty"`
+
+	// Partial is set if the user must complete the second factor before
+	// the session can be used. MFA is set if the second factor has been
+	// completed for the session.
+	Partial bool `json:"partial,omitempty"`
+	MFA     bool `json:"mfa,omitempty"`
+
+	// APIKey is set if the session was established using an API key.
+	APIKey *APIKey `json:"api_key,omitempty"`
+
+	// Actor is set if the session was issued to another user (e.g., the
+	// support staff) impersonating the user.
+	Actor *Actor `json:"actor,omitempty"`
+}
+
+// Actor identifies the real user behind an impersonation session.
+type Actor struct {
+	ID    string `json:"id"`
+	Email string `json:"email,omitempty"`
+}
+
+// PasswordHasher hashes and verifies passwords. Hashes must be
+// self-describing so that hashes produced by older algorithms or
+// parameters keep verifying.
+type PasswordHasher interface {
+	Hash(pwd string) (string, error)
+
+	// Verify returns true if the password matches the hash. needsRehash
+	// is true if the hash should be replaced with a new one produced by
+	// Hash (e.g., algorithm or cost has changed).
+	Verify(hash, pwd string) (match, needsRehash bool)
 }
 
 // ConfLoader is responsible for loading configurations during
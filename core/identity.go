@@ -0,0 +1,74 @@
+package core
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/spy16/forge/core/errors"
+)
+
+// UpsertIdentity creates or updates the local user for an identity that
+// was authenticated by an external provider. The local user is resolved
+// using the provider key (e.g., 'firebase/<sub>') first and then using
+// the email if the provider asserts it as verified. The provider key is
+// attached to the user so that the same person logging in via another
+// provider resolves to the same local user.
+//
+// An existing user is linked by email only if the email is verified and
+// the user has no password. Otherwise, anyone who registered the email
+// first (without owning it) would get access to the identity. Such users
+// must log in and link the provider explicitly. The registry is written
+// only if something changed.
+func UpsertIdentity(ctx context.Context, reg UserRegistry, providerKey string, ident User) (*User, error) {
+	kind, _ := SplitAuthKey(providerKey)
+
+	linked := true
+	u, err := reg.Get(ctx, providerKey)
+	if errors.Is(err, errors.NotFound) && ident.Email != "" && ident.VerifiedAt != nil {
+		linked = false
+		u, err = reg.Get(ctx, NewAuthKey(KeyKindEmail, ident.Email))
+		if err == nil && (u.VerifiedAt == nil || u.PwdHash != nil) {
+			return nil, errors.Conflict.Coded("account_exists").
+				Hintf("an account with this email exists, log in and link the provider")
+		}
+	}
+
+	changed := false
+	if err != nil && !errors.Is(err, errors.NotFound) {
+		return nil, err
+	} else if err != nil {
+		newUser := NewUser(kind, "", ident.Email)
+		if !ident.CreatedAt.IsZero() {
+			newUser.CreatedAt = ident.CreatedAt
+		}
+		u, linked, changed = &newUser, false, true
+	}
+
+	if u.Data == nil {
+		u.Data = UserData{}
+	}
+	for k, v := range ident.Data {
+		if v != nil && v != "" && !reflect.DeepEqual(u.Data[k], v) {
+			u.Data[k] = v
+			changed = true
+		}
+	}
+	if u.VerifiedAt == nil && ident.VerifiedAt != nil && ident.Email == u.Email {
+		u.VerifiedAt = ident.VerifiedAt
+		changed = true
+	}
+
+	if changed {
+		if u, err = reg.Upsert(ctx, *u); err != nil {
+			return nil, err
+		}
+	}
+
+	if !linked {
+		key := UserKey{AuthKey: providerKey, Attribs: M{"provider": kind}}
+		if err := reg.AttachKey(ctx, u.ID, key); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
@@ -0,0 +1,108 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/builtins/memstore"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+func TestUpsertIdentity(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	reg := memstore.NewUsers()
+	now := time.Now()
+	createdAt := now.Add(-24 * time.Hour)
+
+	first, err := core.UpsertIdentity(ctx, reg, "firebase/abc", core.User{
+		Data:       core.UserData{"name": "Bob"},
+		Email:      "bob@bobmail.com",
+		CreatedAt:  createdAt,
+		VerifiedAt: &now,
+	})
+	require.NoError(t, err)
+	assert.True(t, createdAt.Equal(first.CreatedAt))
+	assert.NotNil(t, first.VerifiedAt)
+
+	t.Run("SameProvider", func(t *testing.T) {
+		got, err := core.UpsertIdentity(ctx, reg, "firebase/abc", core.User{
+			Data:  core.UserData{"picture": "http://pic"},
+			Email: "bob@bobmail.com",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, first.ID, got.ID)
+		assert.True(t, first.CreatedAt.Equal(got.CreatedAt))
+		assert.Equal(t, core.UserData{"name": "Bob", "picture": "http://pic"}, got.Data)
+	})
+
+	t.Run("LinkByVerifiedEmail", func(t *testing.T) {
+		got, err := core.UpsertIdentity(ctx, reg, "supabase/xyz", core.User{
+			Email:      "bob@bobmail.com",
+			VerifiedAt: &now,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, first.ID, got.ID)
+
+		linked, err := reg.Get(ctx, "supabase/xyz")
+		require.NoError(t, err)
+		assert.Equal(t, first.ID, linked.ID)
+	})
+
+	t.Run("NoWriteIfUnchanged", func(t *testing.T) {
+		before, err := reg.Get(ctx, "firebase/abc")
+		require.NoError(t, err)
+
+		got, err := core.UpsertIdentity(ctx, reg, "firebase/abc", core.User{
+			Data:       core.UserData{"name": "Bob"},
+			Email:      "bob@bobmail.com",
+			VerifiedAt: &now,
+		})
+		require.NoError(t, err)
+		assert.True(t, before.UpdatedAt.Equal(got.UpdatedAt))
+	})
+
+	t.Run("PasswordUserNotLinked", func(t *testing.T) {
+		// an account registered with a password could have been created by
+		// anyone and must not be taken over by the identity.
+		alice := core.NewUser("password", "alice", "alice@bobmail.com")
+		hash := "hash"
+		alice.PwdHash = &hash
+		alice.VerifiedAt = &now
+		_, err := reg.Upsert(ctx, alice)
+		require.NoError(t, err)
+
+		_, err = core.UpsertIdentity(ctx, reg, "supabase/alice", core.User{
+			Email:      "alice@bobmail.com",
+			VerifiedAt: &now,
+		})
+		assert.ErrorIs(t, err, errors.Conflict)
+
+		_, err = reg.Get(ctx, "supabase/alice")
+		assert.ErrorIs(t, err, errors.NotFound)
+	})
+
+	t.Run("UnverifiedUserNotLinked", func(t *testing.T) {
+		_, err := reg.Upsert(ctx, core.NewUser("magic_link", "carol", "carol@bobmail.com"))
+		require.NoError(t, err)
+
+		_, err = core.UpsertIdentity(ctx, reg, "supabase/carol", core.User{
+			Email:      "carol@bobmail.com",
+			VerifiedAt: &now,
+		})
+		assert.ErrorIs(t, err, errors.Conflict)
+	})
+
+	t.Run("UnverifiedEmailNotLinked", func(t *testing.T) {
+		_, err := core.UpsertIdentity(ctx, reg, "github/123", core.User{
+			Email: "bob@bobmail.com",
+		})
+		assert.ErrorIs(t, err, errors.Conflict)
+	})
+}
@@ -27,7 +27,7 @@ func fromCtx(ctx context.Context) core.M {
 }
 
 func reqCtxMap(rc core.ReqCtx) core.M {
-	return map[string]any{
+	fields := map[string]any{
 		"path":        rc.Path,
 		"route":       rc.Route,
 		"method":      rc.Method,
@@ -35,4 +35,16 @@ func reqCtxMap(rc core.ReqCtx) core.M {
 		"remote_addr": rc.RemoteAddr,
 		"request_id":  rc.RequestID,
 	}
+
+	if rc.Session != nil {
+		fields["user_id"] = rc.Session.User.ID
+		if rc.Impersonating() {
+			fields["actor_id"] = rc.Session.Actor.ID
+		}
+	}
+
+	if rc.Org != nil {
+		fields["org_id"] = rc.Org.ID
+	}
+	return fields
 }
@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/log"
+	"github.com/spy16/forge/core/strutils"
+)
+
+// Log implements core.Mailer by logging the mails instead of delivering
+// them. Useful for local development. Mails carry secrets (verification
+// and login links) and hence the body is logged only if ShowBody is set.
+type Log struct {
+	ShowBody bool
+}
+
+func (l Log) Send(ctx context.Context, mail core.Mail) error {
+	fields := core.M{
+		"mail.to":      mail.To,
+		"mail.subject": mail.Subject,
+	}
+	if l.ShowBody {
+		fields["mail.body"] = mail.Body
+	}
+	log.Info(ctx, "mail sent to log sink", fields)
+	return nil
+}
+
+// File implements core.Mailer by writing every mail as a '.eml' file in
+// the directory. Useful for local development and tests.
+type File struct {
+	Dir  string
+	From string
+}
+
+func (f *File) Send(_ context.Context, mail core.Mail) error {
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return errors.InternalIssue.CausedBy(err)
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strutils.RandStr(6))
+	if err := os.WriteFile(filepath.Join(f.Dir, name), compose(f.From, mail), 0o644); err != nil {
+		return errors.InternalIssue.CausedBy(err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+// SMTP implements core.Mailer by delivering mails through an SMTP server.
+// Authentication is done only if the username is set.
+type SMTP struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (m *SMTP) Send(_ context.Context, mail core.Mail) error {
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return errors.InternalIssue.CausedBy(err).Hintf("invalid smtp addr")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	if err := smtp.SendMail(m.Addr, auth, m.From, mail.To, compose(m.From, mail)); err != nil {
+		return errors.InternalIssue.CausedBy(err).Hintf("failed to send mail")
+	}
+	return nil
+}
+
+// compose renders the mail as an RFC 5322 message.
+func compose(from string, mail core.Mail) []byte {
+	clean := strings.NewReplacer("\r", "", "\n", "")
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", clean.Replace(from))
+	fmt.Fprintf(&buf, "To: %s\r\n", clean.Replace(strings.Join(mail.To, ", ")))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", clean.Replace(mail.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(mail.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/strutils"
+	"github.com/spy16/forge/core/totp"
+)
+
+const (
+	attrMFA = "mfa"
+
+	recoveryCodeCount = 10
+	mfaMaxFailures    = 5
+	mfaLockout        = 5 * time.Minute
+)
+
+var errBadMFACode = errors.InvalidInput.Coded("invalid_mfa_code")
+
+// MFA represents the second-factor settings of a user. It is kept in the
+// user attributes and hence never exposed via the user JSON. Only hashes
+// of the recovery codes are stored.
+type MFA struct {
+	Secret        string     `json:"secret"`
+	EnabledAt     *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodes []string   `json:"recovery_codes,omitempty"`
+	LastStep      int64      `json:"last_step,omitempty"`
+	Failures      int        `json:"failures,omitempty"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// MFA returns the second-factor settings of the user. Returns nil if the
+// user has not started enrolment.
+func (u *User) MFA() *MFA {
+	raw, found := u.Attributes[attrMFA]
+	if !found || raw == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+
+	var m MFA
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil
+	}
+	return &m
+}
+
+// SetMFA sets the second-factor settings of the user. Passing nil removes
+// the settings.
+func (u *User) SetMFA(m *MFA) {
+	if m == nil {
+		delete(u.Attributes, attrMFA)
+		return
+	}
+
+	// stored in generic form so that the attributes look the same before
+	// and after a round-trip through the user registry.
+	var generic map[string]any
+	b, _ := json.Marshal(m)
+	_ = json.Unmarshal(b, &generic)
+
+	if u.Attributes == nil {
+		u.Attributes = map[string]any{}
+	}
+	u.Attributes[attrMFA] = generic
+}
+
+// MFAEnabled returns true if the user has completed the MFA enrolment.
+func (u *User) MFAEnabled() bool {
+	m := u.MFA()
+	return m != nil && m.EnabledAt != nil
+}
+
+// NewRecoveryCodes generates a new set of recovery codes. The raw codes
+// must be shown to the user once while the hashes must be stored.
+func NewRecoveryCodes() (raw, hashes []string) {
+	charset := strutils.CharsetLower + strutils.CharsetNums
+	for i := 0; i < recoveryCodeCount; i++ {
+		code := strutils.RandCode(5, charset) + "-" + strutils.RandCode(5, charset)
+		raw = append(raw, code)
+		hashes = append(hashes, HashToken(code))
+	}
+	return raw, hashes
+}
+
+// Verify checks the code against the TOTP secret and the recovery codes.
+// TOTP codes cannot be replayed and recovery codes are single-use. After
+// too many failed attempts, verification is locked for a while. The MFA
+// state is updated in all the cases and must be persisted by the caller.
+func (m *MFA) Verify(code string, now time.Time) error {
+	if m.LockedUntil != nil && now.Before(*m.LockedUntil) {
+		return errors.Throttled.Coded("mfa_locked").Hintf("too many failed attempts, retry later")
+	}
+	m.LockedUntil = nil
+
+	code = strings.ToLower(strings.TrimSpace(code))
+	if step, ok := totp.Validate(m.Secret, code, now); ok && step > m.LastStep {
+		m.LastStep = step
+		m.Failures = 0
+		return nil
+	}
+
+	hash := HashToken(code)
+	for i, stored := range m.RecoveryCodes {
+		if stored == hash {
+			m.RecoveryCodes = append(m.RecoveryCodes[:i:i], m.RecoveryCodes[i+1:]...)
+			m.Failures = 0
+			return nil
+		}
+	}
+
+	m.Failures++
+	if m.Failures >= mfaMaxFailures {
+		lockedUntil := now.Add(mfaLockout)
+		m.LockedUntil = &lockedUntil
+		m.Failures = 0
+	}
+	return errBadMFACode.Hintf("code is invalid or already used")
+}
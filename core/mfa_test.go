@@ -0,0 +1,62 @@
+package core_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/totp"
+)
+
+func TestUser_MFA(t *testing.T) {
+	t.Parallel()
+
+	u := core.NewUser("", "bob", "bob@example.com")
+	assert.Nil(t, u.MFA())
+	assert.False(t, u.MFAEnabled())
+
+	now := time.Now()
+	u.SetMFA(&core.MFA{Secret: "ABCDEF"})
+	assert.False(t, u.MFAEnabled())
+
+	u.SetMFA(&core.MFA{Secret: "ABCDEF", EnabledAt: &now})
+	assert.True(t, u.MFAEnabled())
+	assert.Equal(t, "ABCDEF", u.MFA().Secret)
+
+	u.SetMFA(nil)
+	assert.Nil(t, u.MFA())
+}
+
+func TestMFA_Verify(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	raw, hashes := core.NewRecoveryCodes()
+	require.Len(t, raw, 10)
+
+	m := &core.MFA{Secret: totp.NewSecret(), RecoveryCodes: hashes}
+
+	code, err := totp.Code(m.Secret, totp.Step(now))
+	require.NoError(t, err)
+	assert.NoError(t, m.Verify(code, now))
+
+	// codes cannot be replayed.
+	assert.ErrorIs(t, m.Verify(code, now), errors.InvalidInput)
+
+	// recovery codes are single use.
+	assert.NoError(t, m.Verify(strings.ToUpper(raw[0]), now))
+	assert.ErrorIs(t, m.Verify(raw[0], now), errors.InvalidInput)
+	assert.Len(t, m.RecoveryCodes, 9)
+
+	// too many failures lock the verification.
+	for i := 0; i < 4; i++ {
+		assert.ErrorIs(t, m.Verify("000000", now), errors.InvalidInput)
+	}
+	assert.ErrorIs(t, m.Verify(raw[1], now), errors.Throttled)
+	assert.NoError(t, m.Verify(raw[1], now.Add(10*time.Minute)))
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/strutils"
+)
+
+// Org member roles in the increasing order of privileges. Admins can
+// manage members and invites. Owners can also manage admins, owners and
+// delete the org.
+const (
+	OrgRoleMember = "member"
+	OrgRoleAdmin  = "admin"
+	OrgRoleOwner  = "owner"
+)
+
+var (
+	slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,38}[a-z0-9]$`)
+	orgRoleRank = map[string]int{OrgRoleMember: 1, OrgRoleAdmin: 2, OrgRoleOwner: 3}
+)
+
+// Org represents an organization (i.e., a tenant) that users can be
+// members of.
+type Org struct {
+	ID        string    `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Data      M         `json:"data,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Membership represents the membership of a user in an org.
+type Membership struct {
+	OrgID     string    `json:"org_id"`
+	UserID    string    `json:"user_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewOrg returns a new org value with sensible defaults set.
+func NewOrg(slug, name string) Org {
+	now := time.Now()
+	return Org{
+		ID:        strutils.RandStr(16),
+		Slug:      strings.ToLower(strings.TrimSpace(slug)),
+		Name:      strings.TrimSpace(name),
+		Data:      M{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Validate validates the org object and returns error if invalid.
+func (o *Org) Validate() error {
+	var errInvalid = errors.InvalidInput.Coded("invalid_org")
+
+	if !idPattern.MatchString(o.ID) {
+		return errInvalid.Hintf("invalid id")
+	}
+
+	if !slugPattern.MatchString(o.Slug) {
+		return errInvalid.Hintf("slug must match '%s'", slugPattern)
+	}
+
+	if o.Name == "" {
+		return errInvalid.Hintf("name must not be empty")
+	}
+	return nil
+}
+
+// Validate validates the membership and returns error if invalid.
+func (m *Membership) Validate() error {
+	var errInvalid = errors.InvalidInput.Coded("invalid_membership")
+
+	if m.OrgID == "" || m.UserID == "" {
+		return errInvalid.Hintf("org_id and user_id must be set")
+	}
+
+	if !ValidOrgRole(m.Role) {
+		return errInvalid.Hintf("role must be one of %s, %s, %s", OrgRoleMember, OrgRoleAdmin, OrgRoleOwner)
+	}
+	return nil
+}
+
+// HasRole returns true if the member's role is same as or higher than
+// the given role.
+func (m *Membership) HasRole(role string) bool {
+	return m != nil && orgRoleRank[m.Role] >= orgRoleRank[role] && ValidOrgRole(role)
+}
+
+// ValidOrgRole returns true if the role is a known org member role.
+func ValidOrgRole(role string) bool {
+	_, ok := orgRoleRank[role]
+	return ok
+}
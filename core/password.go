@@ -0,0 +1,185 @@
+package core
+
+import (
+	_ "embed"
+	"strings"
+	"unicode"
+
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/pwdhash"
+)
+
+// maxPasswordBytes is the max length of passwords bcrypt can handle.
+// Bytes beyond this are silently ignored by bcrypt.
+const maxPasswordBytes = 72
+
+// Password policy rule codes.
+const (
+	RuleMinLength     = "min_length"
+	RuleMaxLength     = "max_length"
+	RuleRequireUpper  = "require_upper"
+	RuleRequireLower  = "require_lower"
+	RuleRequireDigit  = "require_digit"
+	RuleRequireSymbol = "require_symbol"
+	RuleDenyCommon    = "deny_common"
+	RuleDenyUserInfo  = "deny_user_info"
+)
+
+//go:embed data/common_passwords.txt
+var commonPasswordsList string
+
+var commonPasswords = parseCommonPasswords(commonPasswordsList)
+
+// DefaultPasswordPolicy is the policy used when none is configured.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:    8,
+	MaxLength:    maxPasswordBytes,
+	DenyCommon:   true,
+	DenyUserInfo: true,
+}
+
+// DefaultPasswordHasher is used by HashPassword and CheckPassword. It
+// produces bcrypt hashes and verifies both bcrypt and argon2id hashes.
+var DefaultPasswordHasher PasswordHasher = pwdhash.Default()
+
+// PasswordPolicy represents the rules a password must satisfy.
+type PasswordPolicy struct {
+	MinLength     int  `json:"min_length"`
+	MaxLength     int  `json:"max_length"`
+	RequireUpper  bool `json:"require_upper"`
+	RequireLower  bool `json:"require_lower"`
+	RequireDigit  bool `json:"require_digit"`
+	RequireSymbol bool `json:"require_symbol"`
+	DenyCommon    bool `json:"deny_common"`
+	DenyUserInfo  bool `json:"deny_user_info"`
+}
+
+// PasswordPolicyFromConfig loads the password policy from 'auth.password'
+// config keys. DefaultPasswordPolicy values are used for unset keys.
+func PasswordPolicyFromConfig(confL ConfLoader) PasswordPolicy {
+	def := DefaultPasswordPolicy
+	return PasswordPolicy{
+		MinLength:     confL.Int("auth.password.min_length", def.MinLength),
+		MaxLength:     confL.Int("auth.password.max_length", def.MaxLength),
+		RequireUpper:  confL.Bool("auth.password.require_upper", def.RequireUpper),
+		RequireLower:  confL.Bool("auth.password.require_lower", def.RequireLower),
+		RequireDigit:  confL.Bool("auth.password.require_digit", def.RequireDigit),
+		RequireSymbol: confL.Bool("auth.password.require_symbol", def.RequireSymbol),
+		DenyCommon:    confL.Bool("auth.password.deny_common", def.DenyCommon),
+		DenyUserInfo:  confL.Bool("auth.password.deny_user_info", def.DenyUserInfo),
+	}
+}
+
+// PasswordHasherFromConfig creates the password hasher from 'auth.password'
+// config keys. 'hasher' selects the algorithm for new hashes (bcrypt or
+// argon2id). Hashes produced by the other algorithm keep verifying and
+// are reported as needing a rehash.
+func PasswordHasherFromConfig(confL ConfLoader) (PasswordHasher, error) {
+	bc := &pwdhash.Bcrypt{
+		Cost: confL.Int("auth.password.bcrypt_cost", pwdhash.DefaultBcryptCost),
+	}
+
+	def := pwdhash.DefaultArgon2id()
+	a2 := &pwdhash.Argon2id{
+		Time:    uint32(confL.Int("auth.password.argon2.time", int(def.Time))),
+		Memory:  uint32(confL.Int("auth.password.argon2.memory", int(def.Memory))),
+		Threads: uint8(confL.Int("auth.password.argon2.threads", int(def.Threads))),
+		KeyLen:  def.KeyLen,
+		SaltLen: def.SaltLen,
+	}
+
+	switch algo := confL.String("auth.password.hasher", "bcrypt"); algo {
+	case "bcrypt":
+		return &pwdhash.Hasher{Primary: bc, Others: []pwdhash.Algorithm{a2}}, nil
+
+	case "argon2id":
+		return &pwdhash.Hasher{Primary: a2, Others: []pwdhash.Algorithm{bc}}, nil
+
+	default:
+		return nil, errors.InvalidInput.Hintf("unknown auth.password.hasher '%s'", algo)
+	}
+}
+
+// Check validates the password against the policy. User is used for the
+// user-info rule and can be nil. Returns errors.InvalidInput with codes
+// of all the violated rules under 'violations' attribute.
+func (p PasswordPolicy) Check(pwd string, u *User) error {
+	var violations []string
+
+	maxLen := p.MaxLength
+	if maxLen <= 0 || maxLen > maxPasswordBytes {
+		maxLen = maxPasswordBytes
+	}
+
+	if len([]rune(pwd)) < p.MinLength {
+		violations = append(violations, RuleMinLength)
+	}
+	if len(pwd) > maxLen {
+		violations = append(violations, RuleMaxLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, ch := range pwd {
+		switch {
+		case unicode.IsUpper(ch):
+			hasUpper = true
+		case unicode.IsLower(ch):
+			hasLower = true
+		case unicode.IsDigit(ch):
+			hasDigit = true
+		case unicode.IsPunct(ch) || unicode.IsSymbol(ch) || unicode.IsSpace(ch):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, RuleRequireUpper)
+	}
+	if p.RequireLower && !hasLower {
+		violations = append(violations, RuleRequireLower)
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, RuleRequireDigit)
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, RuleRequireSymbol)
+	}
+
+	lowered := strings.ToLower(pwd)
+	if p.DenyCommon && commonPasswords[lowered] {
+		violations = append(violations, RuleDenyCommon)
+	}
+	if p.DenyUserInfo && u != nil && containsUserInfo(lowered, *u) {
+		violations = append(violations, RuleDenyUserInfo)
+	}
+
+	if len(violations) > 0 {
+		return errors.InvalidInput.Coded("weak_password", M{
+			"violations": violations,
+			"policy":     p,
+		}).Hintf("password violates %s", strings.Join(violations, ", "))
+	}
+	return nil
+}
+
+func containsUserInfo(lowerPwd string, u User) bool {
+	localPart, _, _ := strings.Cut(u.Email, "@")
+
+	for _, info := range []string{u.Username, u.Email, localPart} {
+		info = strings.ToLower(strings.TrimSpace(info))
+		if len(info) >= 3 && strings.Contains(lowerPwd, info) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCommonPasswords(list string) map[string]bool {
+	res := map[string]bool{}
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			res[strings.ToLower(line)] = true
+		}
+	}
+	return res
+}
@@ -0,0 +1,68 @@
+package core_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	t.Parallel()
+
+	strict := core.PasswordPolicy{
+		MinLength:     10,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		DenyCommon:    true,
+		DenyUserInfo:  true,
+	}
+	bob := core.NewUser("", "bobby", "bob.smith@bobmail.com")
+
+	table := []struct {
+		title  string
+		policy core.PasswordPolicy
+		pwd    string
+		want   []string
+	}{
+		{title: "DefaultValid", policy: core.DefaultPasswordPolicy, pwd: "correct horse"},
+		{title: "DefaultShort", policy: core.DefaultPasswordPolicy, pwd: "abc", want: []string{core.RuleMinLength}},
+		{title: "DefaultCommon", policy: core.DefaultPasswordPolicy, pwd: "Password123", want: []string{core.RuleDenyCommon}},
+		{title: "DefaultUsername", policy: core.DefaultPasswordPolicy, pwd: "iambobby!!", want: []string{core.RuleDenyUserInfo}},
+		{title: "DefaultEmailLocal", policy: core.DefaultPasswordPolicy, pwd: "x-Bob.Smith-x", want: []string{core.RuleDenyUserInfo}},
+		{title: "TooLong", policy: core.DefaultPasswordPolicy, pwd: strings.Repeat("a", 73), want: []string{core.RuleMaxLength}},
+		{title: "StrictValid", policy: strict, pwd: "Tr0ub4dor&3x"},
+		{
+			title:  "StrictViolations",
+			policy: strict,
+			pwd:    "lowercase only",
+			want:   []string{core.RuleRequireUpper, core.RuleRequireDigit},
+		},
+		{
+			title:  "StrictNoSymbol",
+			policy: strict,
+			pwd:    "Tr0ub4dor3x",
+			want:   []string{core.RuleRequireSymbol},
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.title, func(t *testing.T) {
+			err := tt.policy.Check(tt.pwd, &bob)
+			if len(tt.want) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, errors.InvalidInput)
+			e := errors.E(err)
+			assert.Equal(t, "weak_password", e.Code)
+			assert.Equal(t, tt.want, e.Attribs["violations"])
+		})
+	}
+}
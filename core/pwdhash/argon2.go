@@ -0,0 +1,107 @@
+package pwdhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+
+	"github.com/spy16/forge/core/errors"
+)
+
+const argon2Prefix = "$argon2id$"
+
+// Argon2id implements the argon2id algorithm. Hashes are encoded in the
+// PHC string format: $argon2id$v=19$m=<KiB>,t=<time>,p=<threads>$<salt>$<key>
+type Argon2id struct {
+	Time    uint32
+	Memory  uint32 // in KiB
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+// DefaultArgon2id returns argon2id with the parameters recommended by
+// RFC 9106 for memory constrained environments.
+func DefaultArgon2id() *Argon2id {
+	return &Argon2id{
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 2,
+		KeyLen:  32,
+		SaltLen: 16,
+	}
+}
+
+func (a *Argon2id) Hash(pwd string) (string, error) {
+	salt := make([]byte, a.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.InternalIssue.CausedBy(err)
+	}
+
+	key := argon2.IDKey([]byte(pwd), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix, argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *Argon2id) Owns(hash string) bool { return strings.HasPrefix(hash, argon2Prefix) }
+
+func (a *Argon2id) Verify(hash, pwd string) bool {
+	params, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return false
+	}
+
+	other := argon2.IDKey([]byte(pwd), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+func (a *Argon2id) Outdated(hash string) bool {
+	params, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.Time != a.Time ||
+		params.Memory != a.Memory ||
+		params.Threads != a.Threads ||
+		uint32(len(key)) != a.KeyLen ||
+		uint32(len(salt)) != a.SaltLen
+}
+
+func decodeArgon2(hash string) (*Argon2id, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, nil, err
+	} else if version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	var params Argon2id
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return nil, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return &params, salt, key, nil
+}
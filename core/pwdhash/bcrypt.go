@@ -0,0 +1,54 @@
+package pwdhash
+
+import (
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/spy16/forge/core/errors"
+)
+
+// DefaultBcryptCost is the cost used when none is configured.
+const DefaultBcryptCost = 12
+
+// Bcrypt implements the bcrypt algorithm. Passwords longer than 72 bytes
+// are rejected.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b *Bcrypt) Hash(pwd string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), b.cost())
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return "", errors.InvalidInput.Coded("weak_password").Hintf("password must be at most 72 bytes")
+		}
+		return "", errors.InternalIssue.CausedBy(err)
+	}
+	return string(hash), nil
+}
+
+func (b *Bcrypt) Owns(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Bcrypt) Verify(hash, pwd string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pwd)) == nil
+}
+
+func (b *Bcrypt) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != b.cost()
+}
+
+func (b *Bcrypt) cost() int {
+	if b.Cost <= 0 {
+		return DefaultBcryptCost
+	}
+	return b.Cost
+}
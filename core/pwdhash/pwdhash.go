@@ -0,0 +1,63 @@
+package pwdhash
+
+import (
+	"github.com/spy16/forge/core/errors"
+)
+
+// Algorithm implements a single password hashing algorithm. Hashes must
+// be self-describing (i.e., carry the algorithm and its parameters) so
+// that they keep verifying when the configuration changes.
+type Algorithm interface {
+	// Hash returns the hash of the password using current parameters.
+	Hash(pwd string) (string, error)
+
+	// Owns returns true if the hash was produced by this algorithm.
+	Owns(hash string) bool
+
+	// Verify returns true if the password matches the hash.
+	Verify(hash, pwd string) bool
+
+	// Outdated returns true if the hash was produced with parameters
+	// different from the current ones.
+	Outdated(hash string) bool
+}
+
+// Hasher implements core.PasswordHasher. New hashes are produced using
+// the primary algorithm while hashes produced by any of the algorithms
+// can be verified.
+type Hasher struct {
+	Primary Algorithm
+	Others  []Algorithm
+}
+
+// Default returns a hasher that produces bcrypt hashes with cost 12 and
+// verifies both bcrypt and argon2id hashes.
+func Default() *Hasher {
+	return &Hasher{
+		Primary: &Bcrypt{Cost: DefaultBcryptCost},
+		Others:  []Algorithm{DefaultArgon2id()},
+	}
+}
+
+func (h *Hasher) Hash(pwd string) (string, error) {
+	if pwd == "" {
+		return "", errors.InvalidInput.Coded("weak_password").Hintf("password must not be empty")
+	}
+	return h.Primary.Hash(pwd)
+}
+
+// Verify returns true if the password matches the hash. needsRehash is
+// true if the hash was produced by a non-primary algorithm or with
+// outdated parameters.
+func (h *Hasher) Verify(hash, pwd string) (match, needsRehash bool) {
+	if h.Primary.Owns(hash) {
+		return h.Primary.Verify(hash, pwd), h.Primary.Outdated(hash)
+	}
+
+	for _, algo := range h.Others {
+		if algo.Owns(hash) {
+			return algo.Verify(hash, pwd), true
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,107 @@
+package pwdhash_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/pwdhash"
+)
+
+func TestHasher(t *testing.T) {
+	t.Parallel()
+
+	bc := &pwdhash.Bcrypt{Cost: 4}
+	a2 := &pwdhash.Argon2id{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16}
+
+	bcHash, err := bc.Hash("s3cr3t-pwd")
+	require.NoError(t, err)
+	a2Hash, err := a2.Hash("s3cr3t-pwd")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(a2Hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	table := []struct {
+		title       string
+		hasher      *pwdhash.Hasher
+		hash        string
+		pwd         string
+		match       bool
+		needsRehash bool
+	}{
+		{
+			title:  "BcryptPrimary",
+			hasher: &pwdhash.Hasher{Primary: bc, Others: []pwdhash.Algorithm{a2}},
+			hash:   bcHash,
+			pwd:    "s3cr3t-pwd",
+			match:  true,
+		},
+		{
+			title:       "BcryptCostChanged",
+			hasher:      &pwdhash.Hasher{Primary: &pwdhash.Bcrypt{Cost: 5}},
+			hash:        bcHash,
+			pwd:         "s3cr3t-pwd",
+			match:       true,
+			needsRehash: true,
+		},
+		{
+			title:  "Argon2Primary",
+			hasher: &pwdhash.Hasher{Primary: a2},
+			hash:   a2Hash,
+			pwd:    "s3cr3t-pwd",
+			match:  true,
+		},
+		{
+			title:       "Argon2ParamsChanged",
+			hasher:      &pwdhash.Hasher{Primary: &pwdhash.Argon2id{Time: 2, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16}},
+			hash:        a2Hash,
+			pwd:         "s3cr3t-pwd",
+			match:       true,
+			needsRehash: true,
+		},
+		{
+			title:       "OtherAlgorithm",
+			hasher:      &pwdhash.Hasher{Primary: a2, Others: []pwdhash.Algorithm{bc}},
+			hash:        bcHash,
+			pwd:         "s3cr3t-pwd",
+			match:       true,
+			needsRehash: true,
+		},
+		{
+			title:       "WrongPassword",
+			hasher:      &pwdhash.Hasher{Primary: a2},
+			hash:        a2Hash,
+			pwd:         "wrong-pwd",
+			match:       false,
+			needsRehash: false,
+		},
+		{
+			title:  "UnknownAlgorithm",
+			hasher: &pwdhash.Hasher{Primary: a2},
+			hash:   bcHash,
+			pwd:    "s3cr3t-pwd",
+			match:  false,
+		},
+	}
+
+	for _, tt := range table {
+		tt := tt
+		t.Run(tt.title, func(t *testing.T) {
+			match, needsRehash := tt.hasher.Verify(tt.hash, tt.pwd)
+			assert.Equal(t, tt.match, match)
+			assert.Equal(t, tt.needsRehash, needsRehash)
+		})
+	}
+}
+
+func TestBcrypt_Hash(t *testing.T) {
+	t.Parallel()
+
+	_, err := (&pwdhash.Bcrypt{Cost: 4}).Hash(strings.Repeat("x", 73))
+	assert.ErrorIs(t, err, errors.InvalidInput)
+
+	_, err = pwdhash.Default().Hash("")
+	assert.ErrorIs(t, err, errors.InvalidInput)
+}
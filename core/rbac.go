@@ -0,0 +1,66 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+)
+
+// PermAll grants all permissions when assigned to a role or user.
+const PermAll = "*"
+
+var (
+	rolePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+	permPattern = regexp.MustCompile(`^(\*|[a-z0-9_.-]+(:[a-z0-9_.-]+)*(:\*)?)$`)
+)
+
+// RolePerms returns the permissions granted by the given role.
+type RolePerms func(role string) []string
+
+// RolePermsFromConfig returns RolePerms that looks up the permissions of
+// a role from 'auth.roles.<role>' config key. Config is consulted on each
+// call so that policy changes are picked up without code changes.
+func RolePermsFromConfig(confL ConfLoader) RolePerms {
+	return func(role string) []string {
+		return confL.Strings("auth.roles."+role, nil)
+	}
+}
+
+// Granted returns all the permissions granted to the user either directly
+// or via the roles assigned to the user.
+func (u *User) Granted(rolePerms RolePerms) []string {
+	granted := append([]string(nil), u.Permissions...)
+	if rolePerms != nil {
+		for _, role := range u.Roles {
+			granted = append(granted, rolePerms(role)...)
+		}
+	}
+	return granted
+}
+
+// MissingPerms returns the required permissions that are not covered by
+// the granted ones. A granted permission ending with ':*' covers all the
+// permissions with the same prefix (e.g., 'users:*' covers 'users:read').
+func MissingPerms(granted []string, required ...string) []string {
+	var missing []string
+	for _, perm := range required {
+		if !permCovered(granted, perm) {
+			missing = append(missing, perm)
+		}
+	}
+	return missing
+}
+
+// ValidPerm returns true if the permission is well-formed. Permissions are
+// lowercase, colon-separated segments with an optional '*' at the end.
+func ValidPerm(perm string) bool { return permPattern.MatchString(perm) }
+
+func permCovered(granted []string, perm string) bool {
+	for _, g := range granted {
+		if g == PermAll || g == perm {
+			return true
+		} else if strings.HasSuffix(g, "*") && strings.HasPrefix(perm, strings.TrimSuffix(g, "*")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package core_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spy16/forge/core"
+)
+
+func TestMissingPerms(t *testing.T) {
+	t.Parallel()
+
+	rolePerms := func(role string) []string {
+		return map[string][]string{
+			"admin":  {core.PermAll},
+			"editor": {"posts:*", "users:read"},
+		}[role]
+	}
+
+	table := []struct {
+		title    string
+		user     core.User
+		required []string
+		want     []string
+	}{
+		{
+			title:    "NoGrants",
+			user:     core.User{},
+			required: []string{"posts:read"},
+			want:     []string{"posts:read"},
+		},
+		{
+			title:    "Admin",
+			user:     core.User{Roles: []string{"admin"}},
+			required: []string{"posts:read", "users:delete"},
+		},
+		{
+			title:    "PrefixWildcard",
+			user:     core.User{Roles: []string{"editor"}},
+			required: []string{"posts:write", "users:read", "users:delete"},
+			want:     []string{"users:delete"},
+		},
+		{
+			title:    "DirectPermission",
+			user:     core.User{Roles: []string{"unknown"}, Permissions: []string{"users:delete"}},
+			required: []string{"users:delete"},
+		},
+	}
+
+	for _, tt := range table {
+		tt := tt
+		t.Run(tt.title, func(t *testing.T) {
+			got := core.MissingPerms(tt.user.Granted(rolePerms), tt.required...)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -14,6 +14,11 @@ type ReqCtx struct {
 	Session    *Session
 	RequestID  string
 	RemoteAddr string
+	UserAgent  string
+
+	// Org and Member are set when the route is scoped to an org.
+	Org    *Org
+	Member *Membership
 }
 
 func (rc ReqCtx) IsZero() bool { return rc == (ReqCtx{}) }
@@ -21,6 +26,21 @@ func (rc ReqCtx) IsZero() bool { return rc == (ReqCtx{}) }
 // Authenticated returns true if rc contains authenticated user.
 func (rc ReqCtx) Authenticated() bool { return rc.Session != nil }
 
+// Impersonating returns true if the session is being used by another
+// user impersonating the session user.
+func (rc ReqCtx) Impersonating() bool { return rc.Session != nil && rc.Session.Actor != nil }
+
+// ActorID returns the ID of the user really performing the request. It
+// is the impersonator if impersonating and the session user otherwise.
+func (rc ReqCtx) ActorID() string {
+	if rc.Session == nil {
+		return ""
+	} else if rc.Session.Actor != nil {
+		return rc.Session.Actor.ID
+	}
+	return rc.Session.User.ID
+}
+
 // NewCtx returns a new Go context with given reqCtx injected.
 func NewCtx(ctx context.Context, reqCtx ReqCtx) context.Context {
 	return context.WithValue(ctx, ReqCtxKey, reqCtx)
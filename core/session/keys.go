@@ -0,0 +1,99 @@
+package session
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/spy16/forge/core/errors"
+)
+
+// Supported signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+const minSecretLen = 32
+
+// Key represents a named key used for signing and verifying session
+// tokens.
+type Key struct {
+	ID  string
+	Alg string
+
+	secret []byte
+	priv   ed25519.PrivateKey
+}
+
+// NewHMACKey returns a HS256 key with the given secret.
+func NewHMACKey(kid string, secret []byte) (Key, error) {
+	if len(secret) < minSecretLen {
+		return Key{}, errors.InvalidInput.Hintf("secret for key '%s' must be at least %d bytes", kid, minSecretLen)
+	}
+	return Key{ID: kid, Alg: AlgHS256, secret: secret}, nil
+}
+
+// NewEdDSAKey returns an EdDSA key from the given ed25519 seed or the
+// full private key.
+func NewEdDSAKey(kid string, material []byte) (Key, error) {
+	switch len(material) {
+	case ed25519.SeedSize:
+		return Key{ID: kid, Alg: AlgEdDSA, priv: ed25519.NewKeyFromSeed(material)}, nil
+
+	case ed25519.PrivateKeySize:
+		return Key{ID: kid, Alg: AlgEdDSA, priv: ed25519.PrivateKey(material)}, nil
+
+	default:
+		return Key{}, errors.InvalidInput.Hintf("invalid ed25519 key size for key '%s'", kid)
+	}
+}
+
+// ParseKey parses a key spec of the form '<kid>:<alg>:<base64-material>'.
+// For HS256, material is the secret. For EdDSA, material is the ed25519
+// seed or private key.
+func ParseKey(spec string) (Key, error) {
+	parts := strings.SplitN(strings.TrimSpace(spec), ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return Key{}, errors.InvalidInput.Hintf("key spec must be '<kid>:<alg>:<base64>'")
+	}
+
+	material, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Key{}, errors.InvalidInput.CausedBy(err).Hintf("invalid material for key '%s'", parts[0])
+	}
+
+	switch parts[1] {
+	case AlgHS256:
+		return NewHMACKey(parts[0], material)
+
+	case AlgEdDSA:
+		return NewEdDSAKey(parts[0], material)
+
+	default:
+		return Key{}, errors.InvalidInput.Hintf("unsupported alg '%s' for key '%s'", parts[1], parts[0])
+	}
+}
+
+func (k Key) method() jwt.SigningMethod {
+	if k.Alg == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodHS256
+}
+
+func (k Key) signingKey() any {
+	if k.Alg == AlgEdDSA {
+		return k.priv
+	}
+	return k.secret
+}
+
+func (k Key) verifyKey() any {
+	if k.Alg == AlgEdDSA {
+		return k.priv.Public()
+	}
+	return k.secret
+}
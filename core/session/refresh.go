@@ -0,0 +1,165 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/log"
+)
+
+const (
+	tokenKindRefresh     = "refresh"
+	tokenKindRefreshUsed = "refresh_used"
+
+	defaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+var (
+	errBadRefresh = errors.MissingAuth.Coded("invalid_refresh_token")
+	errReused     = errors.MissingAuth.Coded("refresh_token_reused")
+)
+
+// Refresher issues refresh tokens for the sessions of the issuer and
+// exchanges them for new access/refresh pairs. Refresh tokens are single
+// use and rotated on every refresh. All the refresh tokens of a session
+// form a family that lives as long as the session record in the store.
+// Revoking the session invalidates the family and reusing an already
+// rotated token revokes the session. The issuer must have a store set.
+type Refresher struct {
+	Issuer *Issuer
+	Tokens core.TokenStore
+	Users  core.UserRegistry
+	TTL    time.Duration
+}
+
+// Attach issues a refresh token for the session and extends the session
+// to the lifetime of the refresh token. The raw token is set on the
+// session.
+func (rf *Refresher) Attach(ctx context.Context, sess *core.Session) error {
+	if rf.Issuer.store == nil {
+		return errors.Unsupported.Hintf("refresh tokens require a session store")
+	} else if sess.Partial || sess.Actor != nil {
+		return errors.InvalidInput.Hintf("refresh tokens cannot be issued for partial or impersonation sessions")
+	}
+
+	raw, expiresAt, err := rf.issue(ctx, sess.ID, sess.User.ID, sess.MFA)
+	if err != nil {
+		return err
+	}
+	sess.RefreshToken = raw
+
+	if expiresAt.Before(sess.Expiry) {
+		expiresAt = sess.Expiry
+	}
+	return rf.Issuer.store.Extend(ctx, sess.ID, expiresAt)
+}
+
+// Refresh exchanges the refresh token for a new access token of the same
+// session and a new refresh token. The user is re-fetched so that the
+// new token reflects the latest user details.
+func (rf *Refresher) Refresh(ctx context.Context, raw string) (*core.Session, error) {
+	if rf.Issuer.store == nil {
+		return nil, errors.Unsupported.Hintf("refresh tokens require a session store")
+	}
+
+	hash := core.HashToken(raw)
+	tok, err := rf.Tokens.Take(ctx, tokenKindRefresh, hash)
+	if err != nil {
+		if errors.Is(err, errors.NotFound) {
+			return nil, rf.checkReuse(ctx, hash)
+		}
+		return nil, err
+	}
+	sessionID, _ := tok.Attribs["session_id"].(string)
+	mfa, _ := tok.Attribs["mfa"].(bool)
+
+	// remember the rotated token to detect reuse.
+	used := core.Token{
+		Kind:      tokenKindRefreshUsed,
+		Hash:      tok.Hash,
+		UserID:    tok.UserID,
+		Attribs:   core.M{"session_id": sessionID},
+		ExpiresAt: tok.ExpiresAt,
+	}
+	if err := rf.Tokens.Put(ctx, used); err != nil {
+		return nil, err
+	}
+
+	rec, err := rf.Issuer.store.Get(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, errors.NotFound) {
+			return nil, errBadRefresh.Hintf("session not found")
+		}
+		return nil, err
+	} else if rec.RevokedAt != nil {
+		return nil, errBadRefresh.Hintf("session revoked")
+	}
+
+	u, err := rf.Users.Get(ctx, core.NewAuthKey(core.KeyKindID, tok.UserID))
+	if err != nil {
+		if errors.Is(err, errors.NotFound) {
+			_ = rf.Issuer.store.Revoke(ctx, sessionID)
+			return nil, errBadRefresh.Hintf("user no longer exists")
+		}
+		return nil, err
+	}
+
+	// the session record is created on login.
+	sess, err := rf.Issuer.mint(core.Session{ID: sessionID, User: *u, MFA: mfa, AuthTime: rec.CreatedAt}, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	newRaw, expiresAt, err := rf.issue(ctx, sessionID, u.ID, mfa)
+	if err != nil {
+		return nil, err
+	}
+	sess.RefreshToken = newRaw
+
+	if err := rf.Issuer.store.Extend(ctx, sessionID, expiresAt); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// checkReuse revokes the session if the token was already rotated. The
+// returned error is always non-nil.
+func (rf *Refresher) checkReuse(ctx context.Context, hash string) error {
+	used, err := rf.Tokens.Take(ctx, tokenKindRefreshUsed, hash)
+	if err != nil {
+		if errors.Is(err, errors.NotFound) {
+			return errBadRefresh.Hintf("unknown or expired refresh token")
+		}
+		return err
+	}
+
+	// keep the marker so that further reuse is detected too.
+	_ = rf.Tokens.Put(ctx, *used)
+
+	sessionID, _ := used.Attribs["session_id"].(string)
+	log.Warn(ctx, "refresh token reuse detected, revoking session", core.M{
+		"user_id":    used.UserID,
+		"session_id": sessionID,
+	})
+
+	if err := rf.Issuer.store.Revoke(ctx, sessionID); err != nil && !errors.Is(err, errors.NotFound) {
+		return err
+	}
+	return errReused.Hintf("refresh token was already used")
+}
+
+func (rf *Refresher) issue(ctx context.Context, sessionID, userID string, mfa bool) (string, time.Time, error) {
+	ttl := rf.TTL
+	if ttl <= 0 {
+		ttl = defaultRefreshTTL
+	}
+
+	raw, tok := core.NewToken(tokenKindRefresh, userID, ttl)
+	tok.Attribs = core.M{"session_id": sessionID, "mfa": mfa}
+	if err := rf.Tokens.Put(ctx, tok); err != nil {
+		return "", time.Time{}, err
+	}
+	return raw, tok.ExpiresAt, nil
+}
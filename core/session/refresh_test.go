@@ -0,0 +1,131 @@
+package session_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/builtins/memstore"
+	"github.com/spy16/forge/builtins/sqlstore"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/session"
+)
+
+func TestRefresher(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*session.Refresher, *core.Session) {
+		k1, _ := session.NewHMACKey("k1", secret)
+		iss, err := session.New("", time.Minute, "k1", k1)
+		require.NoError(t, err)
+		iss.SetStore(memstore.NewSessions())
+
+		users := memstore.NewUsers()
+		u, err := users.Upsert(ctx, core.NewUser("", "bob", "bob@bobmail.com"))
+		require.NoError(t, err)
+
+		rf := &session.Refresher{
+			Issuer: iss,
+			Tokens: memstore.NewTokens(),
+			Users:  users,
+			TTL:    time.Hour,
+		}
+
+		sess, err := iss.Issue(ctx, *u)
+		require.NoError(t, err)
+		require.NoError(t, rf.Attach(ctx, sess))
+		require.NotEmpty(t, sess.RefreshToken)
+		return rf, sess
+	}
+
+	t.Run("Rotation", func(t *testing.T) {
+		rf, sess := setup(t)
+
+		next, err := rf.Refresh(ctx, sess.RefreshToken)
+		require.NoError(t, err)
+		assert.Equal(t, sess.ID, next.ID)
+		assert.NotEqual(t, sess.RefreshToken, next.RefreshToken)
+
+		// the time of the login is retained.
+		got, err := rf.Issuer.Authenticate(ctx, next.Token)
+		assert.NoError(t, err)
+		assert.True(t, sess.AuthTime.Equal(got.AuthTime))
+
+		next2, err := rf.Refresh(ctx, next.RefreshToken)
+		require.NoError(t, err)
+		assert.Equal(t, sess.ID, next2.ID)
+	})
+
+	t.Run("Reuse", func(t *testing.T) {
+		rf, sess := setup(t)
+
+		next, err := rf.Refresh(ctx, sess.RefreshToken)
+		require.NoError(t, err)
+
+		// reusing the rotated token revokes the whole family.
+		_, err = rf.Refresh(ctx, sess.RefreshToken)
+		assert.ErrorIs(t, err, errors.MissingAuth)
+
+		_, err = rf.Refresh(ctx, next.RefreshToken)
+		assert.ErrorIs(t, err, errors.MissingAuth)
+
+		_, err = rf.Issuer.Authenticate(ctx, next.Token)
+		assert.ErrorIs(t, err, errors.MissingAuth)
+	})
+
+	t.Run("Parallel", func(t *testing.T) {
+		rf, sess := setup(t)
+
+		st, err := sqlstore.Open(sqlstore.DriverSQLite, filepath.Join(t.TempDir(), "forge.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = st.Close() })
+		require.NoError(t, st.Migrate(ctx))
+
+		rf.Tokens = st.Tokens()
+		require.NoError(t, rf.Attach(ctx, sess))
+
+		// only one of the concurrent refreshes with the same token wins.
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		refreshed := 0
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := rf.Refresh(ctx, sess.RefreshToken)
+				if err == nil {
+					mu.Lock()
+					refreshed++
+					mu.Unlock()
+				} else {
+					assert.ErrorIs(t, err, errors.MissingAuth)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 1, refreshed)
+	})
+
+	t.Run("RevokedSession", func(t *testing.T) {
+		rf, sess := setup(t)
+
+		require.NoError(t, rf.Issuer.Revoke(ctx, sess.Token))
+		_, err := rf.Refresh(ctx, sess.RefreshToken)
+		assert.ErrorIs(t, err, errors.MissingAuth)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		rf, _ := setup(t)
+
+		_, err := rf.Refresh(ctx, "unknown")
+		assert.ErrorIs(t, err, errors.MissingAuth)
+	})
+}
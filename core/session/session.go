@@ -0,0 +1,403 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/log"
+	"github.com/spy16/forge/core/strutils"
+)
+
+const (
+	defaultTTL    = 24 * time.Hour
+	defaultIssuer = "forge"
+
+	// touchInterval limits how often the last-seen time of a session
+	// is updated in the store.
+	touchInterval = time.Minute
+
+	// partialTTL is the time users have to complete the second factor.
+	partialTTL = 5 * time.Minute
+
+	// impersonationTTL caps the lifetime of impersonation sessions.
+	impersonationTTL = time.Hour
+)
+
+// Issuer mints and verifies forge-signed session tokens. Tokens are
+// verified locally using the configured keys and hence no round-trip
+// to any external service is required. Multiple keys can be active at
+// once to support rotation, but only one of them is used for signing.
+// If a session store is set, sessions are tracked in it and revocations
+// are persisted there instead of being held in-memory.
+type Issuer struct {
+	name    string
+	ttl     time.Duration
+	keys    map[string]Key
+	signKey Key
+	store   core.SessionStore
+
+	mu           sync.Mutex
+	revoked      map[string]time.Time // session-id -> expiry
+	revokedUsers map[string]time.Time // user-id -> revoked-at
+}
+
+// New returns a new issuer that signs using the key identified by signKID
+// and verifies tokens signed by any of the given keys.
+func New(name string, ttl time.Duration, signKID string, keys ...Key) (*Issuer, error) {
+	if name == "" {
+		name = defaultIssuer
+	}
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+
+	iss := &Issuer{
+		name:         name,
+		ttl:          ttl,
+		keys:         map[string]Key{},
+		revoked:      map[string]time.Time{},
+		revokedUsers: map[string]time.Time{},
+	}
+	for _, k := range keys {
+		if _, dup := iss.keys[k.ID]; dup {
+			return nil, errors.InvalidInput.Hintf("duplicate key id '%s'", k.ID)
+		}
+		iss.keys[k.ID] = k
+	}
+
+	signKey, found := iss.keys[signKID]
+	if !found {
+		return nil, errors.InvalidInput.Hintf("signing key '%s' not found", signKID)
+	}
+	iss.signKey = signKey
+
+	return iss, nil
+}
+
+// FromConfig initialises the issuer using keys from the config loader.
+// If no keys are configured, an ephemeral key is generated and all the
+// tokens become invalid on restart.
+func FromConfig(confL core.ConfLoader) (*Issuer, error) {
+	var keys []Key
+	for _, spec := range confL.Strings("session.keys", nil) {
+		k, err := ParseKey(spec)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	if len(keys) == 0 {
+		log.Warn(context.Background(), "no session keys configured, using an ephemeral key")
+
+		secret := strutils.RandToken(minSecretLen)
+		k, err := NewHMACKey("ephemeral", []byte(secret))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return New(
+		confL.String("session.issuer", defaultIssuer),
+		confL.Duration("session.ttl", defaultTTL),
+		confL.String("session.signing_key", keys[0].ID),
+		keys...,
+	)
+}
+
+// SetStore sets the store used to track the issued sessions. Tokens of
+// sessions not found in the store are rejected.
+func (iss *Issuer) SetStore(store core.SessionStore) { iss.store = store }
+
+// Name returns the issuer name set as the 'iss' claim of the tokens.
+func (iss *Issuer) Name() string { return iss.name }
+
+// Issue mints a new session for the given user. If the user has MFA
+// enabled, a short-lived partial session is returned which can only be
+// used to complete the second factor (see IssueMFA). If a store is set,
+// full sessions are recorded along with the client details from the
+// request context.
+func (iss *Issuer) Issue(ctx context.Context, u core.User) (*core.Session, error) {
+	if u.MFAEnabled() {
+		return iss.mint(core.Session{ID: strutils.RandToken(16), User: u, Partial: true}, time.Now())
+	}
+	return iss.issue(ctx, core.Session{User: u})
+}
+
+// IssueMFA mints a new session for the user that has completed the second
+// factor.
+func (iss *Issuer) IssueMFA(ctx context.Context, u core.User) (*core.Session, error) {
+	return iss.issue(ctx, core.Session{User: u, MFA: true})
+}
+
+// Impersonate mints a session of the user for the actor. The actor is
+// carried in the token so that it is known for every request made using
+// the session. The second factor of the user is not required and the MFA
+// flag must reflect the session of the actor. Impersonation sessions live
+// for an hour at most.
+func (iss *Issuer) Impersonate(ctx context.Context, u core.User, actor core.Actor, mfa bool) (*core.Session, error) {
+	return iss.issue(ctx, core.Session{User: u, Actor: &actor, MFA: mfa})
+}
+
+func (iss *Issuer) issue(ctx context.Context, sess core.Session) (*core.Session, error) {
+	issuedAt := time.Now()
+
+	sess.ID = strutils.RandToken(16)
+	minted, err := iss.mint(sess, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if iss.store != nil {
+		rc := core.FromCtx(ctx)
+		remoteAddr := rc.RemoteAddr
+		if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+			remoteAddr = host
+		}
+
+		rec := core.SessionRecord{
+			ID:         sess.ID,
+			UserID:     sess.User.ID,
+			UserAgent:  rc.UserAgent,
+			RemoteAddr: remoteAddr,
+			CreatedAt:  issuedAt,
+			LastSeenAt: issuedAt,
+			ExpiresAt:  minted.Expiry,
+		}
+		if err := iss.store.Create(ctx, rec); err != nil {
+			return nil, err
+		}
+	}
+
+	return minted, nil
+}
+
+// Authenticate verifies the token and restores the session from it.
+// If a store is set, the session must be active in the store. The user
+// in the session is the snapshot taken when the token was minted and
+// must be reloaded to reflect later changes (forge does this in its
+// Authenticate middleware).
+func (iss *Issuer) Authenticate(ctx context.Context, token string) (*core.Session, error) {
+	claims, err := iss.parse(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// partial sessions are short-lived and not recorded in the store.
+	if iss.store != nil && !claims.Partial {
+		if err := iss.checkStore(ctx, claims.ID); err != nil {
+			return nil, err
+		}
+	} else if iss.isRevoked(claims) {
+		return nil, errors.MissingAuth.Hintf("session revoked")
+	}
+
+	u := claims.User
+	u.ID = claims.Subject
+	sess := &core.Session{
+		ID:      claims.ID,
+		User:    u,
+		Token:   token,
+		Expiry:  claims.ExpiresAt.Time,
+		Partial: claims.Partial,
+		MFA:     claims.MFA,
+	}
+	if claims.AuthTime != nil {
+		sess.AuthTime = claims.AuthTime.Time
+	} else if claims.IssuedAt != nil {
+		sess.AuthTime = claims.IssuedAt.Time
+	}
+	if claims.Act != nil {
+		sess.Actor = &core.Actor{ID: claims.Act.Subject, Email: claims.Act.Email}
+	}
+	return sess, nil
+}
+
+// Revoke invalidates the session identified by the token. Without a
+// store, revocations are held in-memory until the token expires.
+func (iss *Issuer) Revoke(ctx context.Context, token string) error {
+	claims, err := iss.parse(token)
+	if err != nil {
+		return err
+	}
+
+	if iss.store != nil && !claims.Partial {
+		return iss.store.Revoke(ctx, claims.ID)
+	}
+
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range iss.revoked {
+		if exp.Before(now) {
+			delete(iss.revoked, id)
+		}
+	}
+	iss.revoked[claims.ID] = claims.ExpiresAt.Time
+	return nil
+}
+
+// RevokeUser invalidates all the sessions of the user issued so far.
+// Without a store, revocations are kept in memory only and hence are lost
+// on restart and not shared between replicas.
+func (iss *Issuer) RevokeUser(ctx context.Context, userID string) error {
+	if iss.store != nil {
+		return iss.store.RevokeUser(ctx, userID)
+	}
+
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	// sessions issued before now-ttl have expired anyway.
+	now := time.Now()
+	for id, revokedAt := range iss.revokedUsers {
+		if revokedAt.Add(iss.ttl).Before(now) {
+			delete(iss.revokedUsers, id)
+		}
+	}
+	iss.revokedUsers[userID] = now
+	return nil
+}
+
+// checkStore ensures the session is active in the store and updates its
+// last-seen time at most once per touchInterval.
+func (iss *Issuer) checkStore(ctx context.Context, id string) error {
+	rec, err := iss.store.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, errors.NotFound) {
+			return errors.MissingAuth.Hintf("session not found")
+		}
+		return err
+	} else if !rec.Active() {
+		return errors.MissingAuth.Hintf("session revoked")
+	}
+
+	if now := time.Now(); now.Sub(rec.LastSeenAt) > touchInterval {
+		if err := iss.store.Touch(ctx, id, now); err != nil {
+			log.Warn(ctx, "failed to update session last-seen time", core.M{"session_id": id, "error": err.Error()})
+		}
+	}
+	return nil
+}
+
+// mint signs a new token for the session. ID, user and the MFA flags of
+// the session must be set.
+func (iss *Issuer) mint(sess core.Session, issuedAt time.Time) (*core.Session, error) {
+	now := issuedAt.Truncate(time.Second)
+
+	ttl := iss.ttl
+	if sess.Partial {
+		ttl = partialTTL
+	} else if sess.Actor != nil && ttl > impersonationTTL {
+		ttl = impersonationTTL
+	}
+	sess.User = sess.User.Clone(true)
+	sess.Expiry = now.Add(ttl)
+	if sess.AuthTime.IsZero() {
+		sess.AuthTime = now
+	}
+	sess.AuthTime = sess.AuthTime.Truncate(time.Second)
+
+	claims := tokClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sess.ID,
+			Issuer:    iss.name,
+			Subject:   sess.User.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(sess.Expiry),
+		},
+		User:       sess.User,
+		IssuedAtMs: issuedAt.UnixMilli(),
+		Partial:    sess.Partial,
+		MFA:        sess.MFA,
+		AuthTime:   jwt.NewNumericDate(sess.AuthTime),
+	}
+	if sess.Actor != nil {
+		claims.Act = &actClaim{Subject: sess.Actor.ID, Email: sess.Actor.Email}
+	}
+
+	tok := jwt.NewWithClaims(iss.signKey.method(), claims)
+	tok.Header["kid"] = iss.signKey.ID
+
+	signed, err := tok.SignedString(iss.signKey.signingKey())
+	if err != nil {
+		return nil, errors.InternalIssue.CausedBy(err)
+	}
+	sess.Token = signed
+
+	return &sess, nil
+}
+
+func (iss *Issuer) isRevoked(claims *tokClaims) bool {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	if _, found := iss.revoked[claims.ID]; found {
+		return true
+	}
+
+	revokedAt, found := iss.revokedUsers[claims.Subject]
+	return found && claims.IssuedAtMs <= revokedAt.UnixMilli()
+}
+
+func (iss *Issuer) parse(token string) (*tokClaims, error) {
+	var claims tokClaims
+	_, err := jwt.ParseWithClaims(token, &claims, iss.keyFunc,
+		jwt.WithIssuer(iss.name),
+		jwt.WithValidMethods([]string{AlgHS256, AlgEdDSA}),
+	)
+	if err != nil {
+		return nil, errors.MissingAuth.CausedBy(err).Hintf("%s", err)
+	}
+	return &claims, nil
+}
+
+func (iss *Issuer) keyFunc(token *jwt.Token) (any, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid kid=%v", token.Header["kid"])
+	}
+
+	k, found := iss.keys[kid]
+	if !found {
+		return nil, fmt.Errorf("unknown kid=%s", kid)
+	} else if token.Method.Alg() != k.Alg {
+		return nil, fmt.Errorf("alg mismatch for kid=%s", kid)
+	}
+	return k.verifyKey(), nil
+}
+
+type tokClaims struct {
+	jwt.RegisteredClaims
+
+	User core.User `json:"usr"`
+
+	// 'iat' has only second precision. this is used to compare against
+	// user-level revocations.
+	IssuedAtMs int64 `json:"iat_ms"`
+
+	Partial bool `json:"partial,omitempty"`
+	MFA     bool `json:"mfa,omitempty"`
+
+	// AuthTime is the time of the login (as in OIDC) and is retained
+	// across refreshes unlike 'iat'.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+
+	// Act identifies the actor of impersonation sessions (RFC 8693).
+	Act *actClaim `json:"act,omitempty"`
+}
+
+type actClaim struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+}
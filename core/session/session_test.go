@@ -0,0 +1,227 @@
+package session_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/builtins/memstore"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/session"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestIssuer_IssueAndAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	hmacKey, err := session.NewHMACKey("k1", secret)
+	require.NoError(t, err)
+
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	edKey, err := session.NewEdDSAKey("k2", priv)
+	require.NoError(t, err)
+
+	u := core.NewUser("password", "bob", "bob@bobmail.com")
+	for _, kid := range []string{"k1", "k2"} {
+		t.Run(kid, func(t *testing.T) {
+			iss, err := session.New("forge", time.Hour, kid, hmacKey, edKey)
+			require.NoError(t, err)
+
+			sess, err := iss.Issue(context.Background(), u)
+			require.NoError(t, err)
+			assert.NotEmpty(t, sess.Token)
+			assert.Nil(t, sess.User.VerifyToken)
+
+			got, err := iss.Authenticate(context.Background(), sess.Token)
+			require.NoError(t, err)
+			assert.Equal(t, sess.ID, got.ID)
+			assert.Equal(t, u.ID, got.User.ID)
+			assert.Equal(t, u.Email, got.User.Email)
+			assert.True(t, sess.Expiry.Equal(got.Expiry))
+			assert.True(t, sess.AuthTime.Equal(got.AuthTime))
+		})
+	}
+}
+
+func TestIssuer_Rotation(t *testing.T) {
+	t.Parallel()
+
+	k1, _ := session.NewHMACKey("k1", secret)
+	k2, _ := session.NewHMACKey("k2", []byte("fedcba9876543210fedcba9876543210"))
+
+	oldIss, err := session.New("forge", time.Hour, "k1", k1)
+	require.NoError(t, err)
+	sess, err := oldIss.Issue(context.Background(), core.NewUser("", "", "bob@bobmail.com"))
+	require.NoError(t, err)
+
+	// k2 signs new tokens, k1 still verifies old ones.
+	rotated, err := session.New("forge", time.Hour, "k2", k1, k2)
+	require.NoError(t, err)
+	_, err = rotated.Authenticate(context.Background(), sess.Token)
+	assert.NoError(t, err)
+
+	// k1 retired.
+	retired, err := session.New("forge", time.Hour, "k2", k2)
+	require.NoError(t, err)
+	_, err = retired.Authenticate(context.Background(), sess.Token)
+	assert.ErrorIs(t, err, errors.MissingAuth)
+}
+
+func TestIssuer_Revoke(t *testing.T) {
+	t.Parallel()
+
+	k1, _ := session.NewHMACKey("k1", secret)
+	iss, err := session.New("", 0, "k1", k1)
+	require.NoError(t, err)
+
+	sess, err := iss.Issue(context.Background(), core.NewUser("", "", "bob@bobmail.com"))
+	require.NoError(t, err)
+
+	require.NoError(t, iss.Revoke(context.Background(), sess.Token))
+	_, err = iss.Authenticate(context.Background(), sess.Token)
+	assert.ErrorIs(t, err, errors.MissingAuth)
+}
+
+func TestIssuer_RevokeUser(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	k1, _ := session.NewHMACKey("k1", secret)
+	iss, err := session.New("", 0, "k1", k1)
+	require.NoError(t, err)
+
+	u := core.NewUser("", "", "bob@bobmail.com")
+	oldSess, err := iss.Issue(ctx, u)
+	require.NoError(t, err)
+
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, iss.RevokeUser(ctx, u.ID))
+	time.Sleep(2 * time.Millisecond)
+
+	_, err = iss.Authenticate(ctx, oldSess.Token)
+	assert.ErrorIs(t, err, errors.MissingAuth)
+
+	// sessions issued after revocation are valid.
+	newSess, err := iss.Issue(ctx, u)
+	require.NoError(t, err)
+	_, err = iss.Authenticate(ctx, newSess.Token)
+	assert.NoError(t, err)
+}
+
+func TestIssuer_Store(t *testing.T) {
+	t.Parallel()
+
+	k1, _ := session.NewHMACKey("k1", secret)
+	iss, err := session.New("", 0, "k1", k1)
+	require.NoError(t, err)
+
+	store := memstore.NewSessions()
+	iss.SetStore(store)
+
+	ctx := core.NewCtx(context.Background(), core.ReqCtx{
+		RemoteAddr: "10.0.0.1:4321",
+		UserAgent:  "curl/8.0",
+	})
+
+	u := core.NewUser("", "", "bob@bobmail.com")
+	s1, err := iss.Issue(ctx, u)
+	require.NoError(t, err)
+	s2, err := iss.Issue(ctx, u)
+	require.NoError(t, err)
+
+	rec, err := store.Get(ctx, s1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, u.ID, rec.UserID)
+	assert.Equal(t, "10.0.0.1", rec.RemoteAddr)
+	assert.Equal(t, "curl/8.0", rec.UserAgent)
+
+	// revocation in the store takes effect immediately.
+	require.NoError(t, store.Revoke(ctx, s1.ID))
+	_, err = iss.Authenticate(ctx, s1.Token)
+	assert.ErrorIs(t, err, errors.MissingAuth)
+	_, err = iss.Authenticate(ctx, s2.Token)
+	assert.NoError(t, err)
+
+	require.NoError(t, iss.RevokeUser(ctx, u.ID))
+	_, err = iss.Authenticate(ctx, s2.Token)
+	assert.ErrorIs(t, err, errors.MissingAuth)
+
+	// tokens of sessions unknown to the store are rejected.
+	other, err := session.New("", 0, "k1", k1)
+	require.NoError(t, err)
+	s3, err := other.Issue(ctx, u)
+	require.NoError(t, err)
+	_, err = iss.Authenticate(ctx, s3.Token)
+	assert.ErrorIs(t, err, errors.MissingAuth)
+}
+
+func TestIssuer_Impersonate(t *testing.T) {
+	t.Parallel()
+
+	k1, _ := session.NewHMACKey("k1", secret)
+	iss, err := session.New("", 24*time.Hour, "k1", k1)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	u := core.NewUser("", "bob", "bob@bobmail.com")
+	u.SetMFA(&core.MFA{Secret: "secret", EnabledAt: &u.CreatedAt})
+
+	sess, err := iss.Impersonate(ctx, u, core.Actor{ID: "admin1", Email: "admin@forge.dev"}, true)
+	require.NoError(t, err)
+	assert.False(t, sess.Partial, "second factor of the user is not required")
+	assert.True(t, sess.Expiry.Before(time.Now().Add(time.Hour+time.Second)))
+
+	got, err := iss.Authenticate(ctx, sess.Token)
+	require.NoError(t, err)
+	assert.Equal(t, u.ID, got.User.ID)
+	require.NotNil(t, got.Actor)
+	assert.Equal(t, "admin1", got.Actor.ID)
+	assert.Equal(t, "admin@forge.dev", got.Actor.Email)
+	assert.True(t, got.MFA)
+
+	normal, err := iss.IssueMFA(ctx, u)
+	require.NoError(t, err)
+	got, err = iss.Authenticate(ctx, normal.Token)
+	require.NoError(t, err)
+	assert.Nil(t, got.Actor)
+}
+
+func TestParseKey(t *testing.T) {
+	t.Parallel()
+
+	enc := base64.StdEncoding.EncodeToString
+
+	table := []struct {
+		spec    string
+		wantAlg string
+		wantErr bool
+	}{
+		{spec: "k1:HS256:" + enc(secret), wantAlg: session.AlgHS256},
+		{spec: "k1:EdDSA:" + enc(secret), wantAlg: session.AlgEdDSA},
+		{spec: "k1:HS256:" + enc([]byte("short")), wantErr: true},
+		{spec: "k1:RS256:" + enc(secret), wantErr: true},
+		{spec: "k1:HS256", wantErr: true},
+		{spec: "k1:HS256:not-base64!", wantErr: true},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.spec, func(t *testing.T) {
+			k, err := session.ParseKey(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "k1", k.ID)
+			assert.Equal(t, tt.wantAlg, k.Alg)
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package core
+
+import "time"
+
+// SessionRecord represents a forge-issued session tracked in the session
+// store. Records allow sessions to be listed and revoked before expiry.
+type SessionRecord struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	RemoteAddr string     `json:"remote_addr,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active returns true if the session is neither revoked nor expired.
+func (rec *SessionRecord) Active() bool {
+	return rec.RevokedAt == nil && time.Now().Before(rec.ExpiresAt)
+}
@@ -1,6 +1,9 @@
 package strutils
 
 import (
+	cryptorand "crypto/rand"
+	"encoding/base64"
+	"math/big"
 	"math/rand"
 )
 
@@ -27,3 +30,31 @@ func RandStr(n int, charset ...string) string {
 	}
 	return string(s)
 }
+
+// RandToken returns a URL-safe random token generated from 'n' bytes of
+// cryptographically secure randomness. Use this for secrets such as
+// session tokens instead of RandStr.
+func RandToken(n int) string {
+	b := make([]byte, n)
+	if _, err := cryptorand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// RandCode returns a random string of length 'n' with characters picked
+// from the charset using cryptographically secure randomness. Use this
+// for secrets that must be typed by users.
+func RandCode(n int, charset string) string {
+	max := big.NewInt(int64(len(charset)))
+
+	s := make([]byte, n)
+	for i := range s {
+		idx, err := cryptorand.Int(cryptorand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		s[i] = charset[idx.Int64()]
+	}
+	return string(s)
+}
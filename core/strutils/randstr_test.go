@@ -21,3 +21,19 @@ func TestRandStr(t *testing.T) {
 		assert.Equal(t, "aaaaaaaaaa", val)
 	})
 }
+
+func TestRandToken(t *testing.T) {
+	t.Parallel()
+
+	a, b := strutils.RandToken(32), strutils.RandToken(32)
+	assert.Len(t, a, 43)
+	assert.NotEqual(t, a, b)
+}
+
+func TestRandCode(t *testing.T) {
+	t.Parallel()
+
+	assert.Len(t, strutils.RandCode(10, strutils.CharsetNums), 10)
+	assert.Equal(t, "aaaaa", strutils.RandCode(5, "a"))
+	assert.Regexp(t, `^[0-9]{8}$`, strutils.RandCode(8, strutils.CharsetNums))
+}
@@ -0,0 +1,29 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/spy16/forge/core/strutils"
+)
+
+// NewToken generates a new single-use token of the given kind. The raw
+// value must be delivered to the user while the returned Token value
+// (which holds only the hash) must be persisted in the TokenStore.
+func NewToken(kind, userID string, ttl time.Duration) (string, Token) {
+	raw := strutils.RandToken(32)
+	return raw, Token{
+		Kind:      kind,
+		Hash:      HashToken(raw),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+}
+
+// HashToken returns the hash of the raw token value to be used for
+// storage and lookup.
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
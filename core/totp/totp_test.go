@@ -0,0 +1,67 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/core/totp"
+)
+
+// RFC 6238 Appendix B test vectors (SHA1), truncated to 6 digits.
+func TestCode(t *testing.T) {
+	t.Parallel()
+
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	table := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, want := range table {
+		got, err := totp.Code(secret, totp.Step(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "time=%d", unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	secret := totp.NewSecret()
+	now := time.Now()
+
+	code, err := totp.Code(secret, totp.Step(now.Add(-totp.Period)))
+	require.NoError(t, err)
+
+	step, ok := totp.Validate(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, totp.Step(now)-1, step)
+
+	_, ok = totp.Validate(secret, code, now.Add(3*totp.Period))
+	assert.False(t, ok)
+
+	_, ok = totp.Validate(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	t.Parallel()
+
+	u, err := url.Parse(totp.URI("Forge", "bob@example.com", "ABCDEF"))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/Forge:bob@example.com", u.Path)
+	assert.Equal(t, "ABCDEF", u.Query().Get("secret"))
+	assert.Equal(t, "Forge", u.Query().Get("issuer"))
+}
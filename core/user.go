@@ -1,16 +1,22 @@
 package core
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
-
 	"github.com/spy16/forge/core/errors"
 	"github.com/spy16/forge/core/strutils"
 )
 
+const (
+	defaultVerifyTTL = 24 * time.Hour
+	maxClaimLen      = 1024
+)
+
 var (
 	idPattern       = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
 	usernamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]+[A-Za-z0-9]$`)
@@ -27,6 +33,9 @@ type User struct {
 	UpdatedAt   time.Time      `json:"updated_at"`
 	VerifiedAt  *time.Time     `json:"verified_at,omitempty"`
 	VerifyToken *string        `json:"verify_token,omitempty"`
+	DeletedAt   *time.Time     `json:"deleted_at,omitempty"`
+	Roles       []string       `json:"roles,omitempty"`
+	Permissions []string       `json:"permissions,omitempty"`
 	Attributes  map[string]any `json:"-"`
 }
 
@@ -34,6 +43,53 @@ type User struct {
 // Refer https://openid.net/specs/openid-connect-core-1_0.html#StandardClaims
 type UserData map[string]any
 
+// ProfileClaims are the standard claims that users can set in their data.
+// Claims derived from the user fields (sub, email etc.) are not included.
+var ProfileClaims = map[string]bool{
+	"name": true, "given_name": true, "family_name": true, "middle_name": true,
+	"nickname": true, "preferred_username": true, "profile": true, "picture": true,
+	"website": true, "gender": true, "birthdate": true, "zoneinfo": true,
+	"locale": true, "phone_number": true, "address": true,
+}
+
+// Patch applies the changes to the profile claims in the data. Claims
+// set to null are removed. Returns errors.InvalidInput if a claim is not
+// one of ProfileClaims or has an invalid value.
+func (d UserData) Patch(changes map[string]any) error {
+	errInvalid := errors.InvalidInput.Coded("invalid_user_data")
+
+	for claim, val := range changes {
+		if !ProfileClaims[claim] {
+			return errInvalid.Hintf("claim '%s' cannot be set", claim)
+		}
+
+		var valid bool
+		switch v := val.(type) {
+		case nil:
+			valid = true
+		case string:
+			valid = claim != "address" && len(v) <= maxClaimLen
+		case map[string]any:
+			valid = claim == "address"
+		}
+
+		if !valid && claim == "address" {
+			return errInvalid.Hintf("claim 'address' must be an object")
+		} else if !valid {
+			return errInvalid.Hintf("claim '%s' must be a string of at most %d chars", claim, maxClaimLen)
+		}
+	}
+
+	for claim, val := range changes {
+		if val == nil {
+			delete(d, claim)
+		} else {
+			d[claim] = val
+		}
+	}
+	return nil
+}
+
 // Validate validates the user object and returns error if invalid.
 func (u *User) Validate() error {
 	var errInvalid = errors.InvalidInput.Coded("invalid_user")
@@ -49,9 +105,30 @@ func (u *User) Validate() error {
 	if !strutils.IsValidEmail(u.Email) {
 		return errInvalid.Hintf("invalid email")
 	}
+
+	for _, role := range u.Roles {
+		if !rolePattern.MatchString(role) {
+			return errInvalid.Hintf("invalid role '%s'", role)
+		}
+	}
+
+	for _, perm := range u.Permissions {
+		if !ValidPerm(perm) {
+			return errInvalid.Hintf("invalid permission '%s'", perm)
+		}
+	}
 	return nil
 }
 
+// AuthKeys returns the auth keys derived from the user fields.
+func (u *User) AuthKeys() []string {
+	return []string{
+		NewAuthKey(KeyKindID, u.ID),
+		NewAuthKey(KeyKindEmail, u.Email),
+		NewAuthKey(KeyKindUsername, u.Username),
+	}
+}
+
 // Clone returns a deep-clone of the user.
 func (u *User) Clone(safe bool) User {
 	cloned := User{
@@ -62,6 +139,14 @@ func (u *User) Clone(safe bool) User {
 		CreatedAt:  u.CreatedAt,
 		UpdatedAt:  u.UpdatedAt,
 		VerifiedAt: u.VerifiedAt,
+		DeletedAt:  u.DeletedAt,
+	}
+
+	if u.Roles != nil {
+		cloned.Roles = append([]string{}, u.Roles...)
+	}
+	if u.Permissions != nil {
+		cloned.Permissions = append([]string{}, u.Permissions...)
 	}
 
 	for k, v := range u.Data {
@@ -71,6 +156,12 @@ func (u *User) Clone(safe bool) User {
 	if !safe {
 		cloned.PwdHash = u.PwdHash
 		cloned.VerifyToken = u.VerifyToken
+		if u.Attributes != nil {
+			cloned.Attributes = map[string]any{}
+			for k, v := range u.Attributes {
+				cloned.Attributes[k] = v
+			}
+		}
 	}
 
 	return cloned
@@ -83,32 +174,55 @@ func NewUser(kind, username, email string) User {
 	}
 
 	now := time.Now()
-	token := strutils.RandStr(10)
-
-	return User{
-		ID:          strutils.RandStr(16),
-		Data:        map[string]any{},
-		Email:       email,
-		Username:    username,
-		CreatedAt:   now,
-		UpdatedAt:   now,
-		VerifiedAt:  nil,
-		VerifyToken: &token,
+	u := User{
+		ID:         strutils.RandStr(16),
+		Data:       map[string]any{},
+		Email:      email,
+		Username:   username,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		VerifiedAt: nil,
 	}
+	u.NewVerifyToken(defaultVerifyTTL)
+	return u
 }
 
-// HashPassword hashes and returns the PwdHash value.
-func HashPassword(pwd string) (string, error) {
-	if !strongPassword(pwd) {
-		return "", errors.InvalidInput.Hintf("password is not strong enough")
+// NewVerifyToken generates and sets a new email verification token that
+// expires after the given duration. The returned token must be sent to
+// the user's email for verification.
+func (u *User) NewVerifyToken(ttl time.Duration) string {
+	token := fmt.Sprintf("%s.%d", strutils.RandToken(24), time.Now().Add(ttl).Unix())
+	u.VerifyToken = &token
+	return token
+}
+
+// Verify marks the user's email as verified if the given token matches
+// the verification token and has not expired. Token is single-use.
+func (u *User) Verify(token string) error {
+	errInvalid := errors.InvalidInput.Coded("invalid_token")
+
+	if u.VerifyToken == nil || subtle.ConstantTimeCompare([]byte(*u.VerifyToken), []byte(token)) != 1 {
+		return errInvalid.Hintf("token mismatch")
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), 12)
+	expiry, err := strconv.ParseInt(token[strings.LastIndex(token, ".")+1:], 10, 64)
 	if err != nil {
-		return "", errors.InternalIssue.CausedBy(err)
+		return errInvalid.Hintf("malformed token")
+	} else if time.Now().Unix() > expiry {
+		return errors.InvalidInput.Coded("token_expired").Hintf("verification token expired")
 	}
 
-	return string(hash), nil
+	now := time.Now()
+	u.VerifiedAt = &now
+	u.VerifyToken = nil
+	return nil
+}
+
+// HashPassword hashes the password using DefaultPasswordHasher and returns
+// the PwdHash value. Password should be checked against a PasswordPolicy
+// before hashing.
+func HashPassword(pwd string) (string, error) {
+	return DefaultPasswordHasher.Hash(pwd)
 }
 
 // CheckPassword returns true if the given password matches the hashed
@@ -118,11 +232,6 @@ func CheckPassword(hash *string, pwd string) bool {
 	if hash == nil {
 		return false
 	}
-	err := bcrypt.CompareHashAndPassword([]byte(*hash), []byte(pwd))
-	return err == nil
-}
-
-func strongPassword(pwd string) bool {
-	// TODO: add more logic here.
-	return len(pwd) >= 8
+	match, _ := DefaultPasswordHasher.Verify(*hash, pwd)
+	return match
 }
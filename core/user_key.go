@@ -19,6 +19,8 @@ const (
 
 var keyKindPattern = regexp.MustCompile(`^[A-Za-z_]+$`)
 
+var builtinKinds = []string{KeyKindID, KeyKindEmail, KeyKindUsername}
+
 // UserKey represents login-key of a user with any additional
 // attributes.
 type UserKey struct {
@@ -32,11 +34,26 @@ func NewAuthKey(kind, value string) string {
 }
 
 // SplitAuthKey splits the given key-id into its kind and actual value.
+// Kind is empty if the key has no kind prefix.
 func SplitAuthKey(key string) (kind, value string) {
 	parts := strings.SplitN(key, keyIDSeparator, 2)
+	if len(parts) == 1 {
+		return "", parts[0]
+	}
 	return parts[0], parts[1]
 }
 
+// IsBuiltinKind returns true if keys of the given kind are derived
+// from user fields and cannot be attached or detached explicitly.
+func IsBuiltinKind(kind string) bool {
+	for _, k := range builtinKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
 // ValidateAuthKey checks the validity of the login-key.
 func ValidateAuthKey(key string) error {
 	kind, val := SplitAuthKey(key)
@@ -45,9 +62,22 @@ func ValidateAuthKey(key string) error {
 		return errors.InvalidInput.Coded("invalid_kind")
 	}
 
-	if len(strings.TrimSpace(val)) != len(val) {
+	if val == "" || len(strings.TrimSpace(val)) != len(val) {
 		return errors.InvalidInput.Coded("invalid_value")
 	}
 
 	return nil
 }
+
+// ValidateAttachableKey checks the validity of the login-key and also
+// ensures it is not of a builtin kind.
+func ValidateAttachableKey(key string) error {
+	if err := ValidateAuthKey(key); err != nil {
+		return err
+	}
+
+	if kind, _ := SplitAuthKey(key); IsBuiltinKind(kind) {
+		return errors.InvalidInput.Coded("builtin_kind").Hintf("keys of kind '%s' are derived from user fields", kind)
+	}
+	return nil
+}
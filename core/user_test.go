@@ -0,0 +1,69 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+)
+
+func TestUser_Verify(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Valid", func(t *testing.T) {
+		u := core.NewUser("", "bob", "bob@bobmail.com")
+		token := u.NewVerifyToken(time.Hour)
+
+		require.NoError(t, u.Verify(token))
+		assert.NotNil(t, u.VerifiedAt)
+		assert.Nil(t, u.VerifyToken)
+
+		// single-use.
+		assert.ErrorIs(t, u.Verify(token), errors.InvalidInput)
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		u := core.NewUser("", "bob", "bob@bobmail.com")
+		u.NewVerifyToken(time.Hour)
+
+		assert.ErrorIs(t, u.Verify("foo.123"), errors.InvalidInput)
+		assert.Nil(t, u.VerifiedAt)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		u := core.NewUser("", "bob", "bob@bobmail.com")
+		token := u.NewVerifyToken(-time.Minute)
+
+		err := u.Verify(token)
+		assert.ErrorIs(t, err, errors.InvalidInput)
+		assert.Equal(t, "token_expired", errors.E(err).Code)
+	})
+}
+
+func TestUserData_Patch(t *testing.T) {
+	t.Parallel()
+
+	data := core.UserData{"name": "Bob", "picture": "https://bobmail.com/bob.png"}
+	require.NoError(t, data.Patch(map[string]any{
+		"name":    "Bob Builder",
+		"picture": nil,
+		"address": map[string]any{"country": "IN"},
+	}))
+	assert.Equal(t, core.UserData{"name": "Bob Builder", "address": map[string]any{"country": "IN"}}, data)
+
+	for _, changes := range []map[string]any{
+		{"email": "alice@bobmail.com"},
+		{"roles": "admin"},
+		{"name": 42},
+		{"address": "somewhere"},
+		{"locale": map[string]any{"lang": "en"}},
+	} {
+		assert.ErrorIs(t, data.Patch(changes), errors.InvalidInput)
+	}
+	// invalid changes are not applied partially.
+	assert.Equal(t, "Bob Builder", data["name"])
+}
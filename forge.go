@@ -1,16 +1,21 @@
 package forge
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
 	"github.com/spy16/forge/core"
 	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/log"
 	"github.com/spy16/forge/core/servio"
+	"github.com/spy16/forge/core/session"
 )
 
 const defRoutePrefix = "/forge"
@@ -42,10 +47,18 @@ func Forge(name string, opts ...Option) (chi.Router, error) {
 		forger.SetRouter(nil)
 	}
 
+	if err := forger.migrate(context.Background()); err != nil {
+		return nil, err
+	}
+
 	if err := forger.setupRoutes(); err != nil {
 		return nil, err
 	}
 
+	if forger.purgeCtx != nil && forger.users != nil {
+		go forger.purgeLoop(forger.purgeCtx)
+	}
+
 	if err := forger.post(forger); err != nil {
 		return nil, err
 	}
@@ -60,17 +73,46 @@ type appForge struct {
 	pre  func(preCtx PreContext) error
 	post func(postCtx PostContext) error
 
+	// purgeCtx is set to run the purge of deleted users.
+	purgeCtx context.Context
+
 	// dependencies. set during pre-event. used during post.
-	chi   chi.Router
-	auth  core.Auth
-	confL core.ConfLoader
+	chi       chi.Router
+	auth      core.Auth
+	users     core.UserRegistry
+	orgs      core.OrgRegistry
+	tokens    core.TokenStore
+	apiKeys   core.APIKeyStore
+	mailer    core.Mailer
+	sessions  *session.Issuer
+	sessStore core.SessionStore
+	auditLog  core.AuditLog
+	refresher *session.Refresher
+	confL     core.ConfLoader
+	mfaLocks  userLocks
 }
 
-func (app *appForge) Auth() core.Auth          { return app.auth }
-func (app *appForge) Router() chi.Router       { return app.chi }
-func (app *appForge) Configs() core.ConfLoader { return app.confL }
-
-func (app *appForge) SetAuth(auth core.Auth) { app.auth = auth }
+func (app *appForge) Auth() core.Auth                 { return app.auth }
+func (app *appForge) Users() core.UserRegistry        { return app.users }
+func (app *appForge) Orgs() core.OrgRegistry          { return app.orgs }
+func (app *appForge) Tokens() core.TokenStore         { return app.tokens }
+func (app *appForge) APIKeys() core.APIKeyStore       { return app.apiKeys }
+func (app *appForge) Sessions() *session.Issuer       { return app.sessions }
+func (app *appForge) SessionStore() core.SessionStore { return app.sessStore }
+func (app *appForge) AuditLog() core.AuditLog         { return app.auditLog }
+func (app *appForge) Mailer() core.Mailer             { return app.mailer }
+func (app *appForge) Router() chi.Router              { return app.chi }
+func (app *appForge) Configs() core.ConfLoader        { return app.confL }
+
+func (app *appForge) SetAuth(auth core.Auth)               { app.auth = auth }
+func (app *appForge) SetUsers(reg core.UserRegistry)       { app.users = reg }
+func (app *appForge) SetOrgs(reg core.OrgRegistry)         { app.orgs = reg }
+func (app *appForge) SetTokens(ts core.TokenStore)         { app.tokens = ts }
+func (app *appForge) SetAPIKeys(ks core.APIKeyStore)       { app.apiKeys = ks }
+func (app *appForge) SetMailer(m core.Mailer)              { app.mailer = m }
+func (app *appForge) SetSessions(iss *session.Issuer)      { app.sessions = iss }
+func (app *appForge) SetSessionStore(ss core.SessionStore) { app.sessStore = ss }
+func (app *appForge) SetAuditLog(al core.AuditLog)         { app.auditLog = al }
 func (app *appForge) SetRouter(r chi.Router) {
 	if r == nil {
 		r = newChi()
@@ -87,32 +129,34 @@ func (app *appForge) SetRouter(r chi.Router) {
 }
 
 // Authenticate middleware can be included to restrict access to
-// authenticated users only.
-func (app *appForge) Authenticate() Middleware {
-	errAuth := errors.MissingAuth
+// authenticated users only. Options can be passed to restrict further.
+func (app *appForge) Authenticate(opts ...AuthOption) Middleware {
 	cookieName := app.confL.String("auth.cookie_name", "_forge_auth")
 
+	var ao authOpts
+	for _, opt := range opts {
+		opt(&ao)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// auth module is not enabled. all authenticated routes are inaccessible.
-			if app.auth == nil {
-				servio.JSONErr(w, r, errAuth.Hintf("auth module is disabled"))
+			session, err := app.sessionFrom(r, cookieName)
+			if err != nil {
+				servio.JSONErr(w, r, err)
 				return
 			}
 
-			token := extractToken(r, cookieName)
-			if token == "" {
-				servio.JSONErr(w, r, errAuth.Hintf("invalid token"))
+			token, fromCookie := extractToken(r, cookieName)
+			if err := app.checkCSRF(r, token, fromCookie); err != nil {
+				servio.JSONErr(w, r, err)
 				return
 			}
 
-			session, err := app.auth.Authenticate(r.Context(), token)
-			if err != nil {
-				if errors.OneOf(err, []error{errors.NotFound, errors.InvalidInput, errors.MissingAuth}) {
-					servio.JSONErr(w, r, errAuth.Hintf("invalid token"))
-				} else {
-					servio.JSONErr(w, r, errors.InternalIssue.CausedBy(err))
-				}
+			if err := app.reloadUser(r.Context(), session); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			} else if err := app.checkSession(session, ao); err != nil {
+				servio.JSONErr(w, r, err)
 				return
 			}
 
@@ -121,42 +165,384 @@ func (app *appForge) Authenticate() Middleware {
 			rc.Session = session
 			ctx = core.NewCtx(ctx, rc)
 
+			if slot, ok := ctx.Value(sessionSlotKey{}).(*sessionSlot); ok {
+				slot.sess = session
+			}
+
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// sessionFrom restores the session from the token in the request.
+func (app *appForge) sessionFrom(r *http.Request, cookieName string) (*core.Session, error) {
+	errAuth := errors.MissingAuth
+
+	token, _ := extractToken(r, cookieName)
+	if token == "" {
+		return nil, errAuth.Hintf("invalid token")
+	}
+
+	var session *core.Session
+	var err error
+	if core.IsAPIKey(token) {
+		session, err = app.authenticateAPIKey(r.Context(), token)
+	} else if app.auth == nil {
+		// auth module is not enabled. all authenticated routes are inaccessible.
+		return nil, errAuth.Hintf("auth module is disabled")
+	} else {
+		session, err = app.auth.Authenticate(r.Context(), token)
+	}
+
+	if err != nil {
+		if errors.OneOf(err, []error{errors.NotFound, errors.InvalidInput, errors.MissingAuth}) {
+			return nil, errAuth.Hintf("invalid token")
+		} else if errors.OneOf(err, []error{errors.Conflict, errors.Forbidden}) {
+			// e.g., the identity cannot be linked to an existing account.
+			return nil, err
+		}
+		return nil, errors.InternalIssue.CausedBy(err)
+	}
+	return session, nil
+}
+
+// Authorize middleware restricts access to users that have all the given
+// permissions either directly or via their roles. For API key sessions,
+// the permissions must also be within the scopes of the key. Must be used
+// after the Authenticate middleware (with AllowRestrictedKeys to accept
+// scoped keys).
+func (app *appForge) Authorize(perms ...string) Middleware {
+	rolePerms := core.RolePermsFromConfig(app.confL)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rc := core.FromCtx(r.Context())
+			if !rc.Authenticated() {
+				servio.JSONErr(w, r, errors.MissingAuth.Hintf("not authenticated"))
+				return
+			}
+
+			// the session user is reloaded by Authenticate and hence
+			// reflects the current roles and permissions.
+			missing := core.MissingPerms(rc.Session.User.Granted(rolePerms), perms...)
+			if key := rc.Session.APIKey; key != nil && len(key.Scopes) > 0 && len(missing) == 0 {
+				missing = core.MissingPerms(key.Scopes, perms...)
+			}
+
+			if len(missing) > 0 {
+				servio.JSONErr(w, r, errors.Forbidden.
+					Coded("missing_permissions", core.M{"missing": missing}).
+					Hintf("missing permissions: %s", strings.Join(missing, ", ")))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ResolveOrg middleware resolves the active org of the request and sets
+// it in the request context along with the membership of the current
+// user. Org is resolved using the sources listed in 'orgs.sources' (path,
+// header, subdomain) in order. Must be used after Authenticate.
+func (app *appForge) ResolveOrg() Middleware {
+	sources := app.confL.Strings("orgs.sources", []string{"path", "header", "subdomain"})
+	header := app.confL.String("orgs.header", "X-Forge-Org")
+	domain := strings.Trim(app.confL.String("orgs.domain", ""), ".")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.orgs == nil {
+				servio.JSONErr(w, r, errors.Unsupported.Hintf("orgs are not enabled"))
+				return
+			}
+
+			rc := core.FromCtx(r.Context())
+			if !rc.Authenticated() {
+				servio.JSONErr(w, r, errors.MissingAuth.Hintf("not authenticated"))
+				return
+			}
+
+			// org-scoped api keys are restricted to their org.
+			keyOrgID := ""
+			if rc.Session.APIKey != nil {
+				keyOrgID = rc.Session.APIKey.OrgID
+			}
+
+			orgKey := extractOrg(r, sources, header, domain)
+			if orgKey == "" {
+				orgKey = keyOrgID
+			}
+
+			if orgKey == "" {
+				servio.JSONErr(w, r, errors.InvalidInput.Coded("org_required").Hintf("org is not specified"))
+				return
+			}
+
+			org, err := app.orgs.Get(r.Context(), orgKey)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			member, err := app.orgs.Member(r.Context(), org.ID, rc.Session.User.ID)
+			if err == nil && keyOrgID != "" && keyOrgID != org.ID {
+				err = errors.NotFound
+			}
+
+			if err != nil {
+				if errors.Is(err, errors.NotFound) {
+					// do not reveal the existence of the org to non-members.
+					err = errors.NotFound.Hintf("org '%s' not found", orgKey)
+				}
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			rc.Org = org
+			rc.Member = member
+			next.ServeHTTP(w, r.WithContext(core.NewCtx(r.Context(), rc)))
+		})
+	}
+}
+
+// authenticateAPIKey restores the session of the user that owns the API
+// key. Last-used time of the key is updated at most once a minute.
+func (app *appForge) authenticateAPIKey(ctx context.Context, raw string) (*core.Session, error) {
+	if app.apiKeys == nil || app.users == nil {
+		return nil, errors.MissingAuth.Hintf("api keys are not enabled")
+	}
+
+	key, err := app.apiKeys.Find(ctx, core.HashToken(raw))
+	if err != nil {
+		return nil, err
+	} else if !key.Active() {
+		return nil, errors.MissingAuth.Hintf("api key is revoked or expired")
+	}
+
+	u, err := app.users.Get(ctx, core.NewAuthKey(core.KeyKindID, key.UserID))
+	if err != nil {
+		return nil, err
+	} else if u.DeletedAt != nil {
+		return nil, errors.MissingAuth.Hintf("user account is deleted")
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > time.Minute {
+		if err := app.apiKeys.Touch(ctx, key.ID, now); err != nil {
+			log.Warn(ctx, "failed to update api key usage", core.M{"api_key_id": key.ID, "error": err.Error()})
+		}
+		key.LastUsedAt = &now
+	}
+
+	sess := &core.Session{
+		ID:     key.ID,
+		User:   u.Clone(true),
+		APIKey: key,
+	}
+	if key.ExpiresAt != nil {
+		sess.Expiry = *key.ExpiresAt
+	}
+	return sess, nil
+}
+
+func (app *appForge) checkSession(sess *core.Session, ao authOpts) error {
+	if sess.Partial && !ao.allowPartial {
+		return errors.MissingAuth.Coded("mfa_pending").Hintf("second factor is not completed")
+	}
+
+	if ao.requireMFA && !sess.MFA {
+		return errors.Forbidden.Coded("mfa_required").Hintf("second factor is required")
+	}
+
+	if key := sess.APIKey; key != nil && key.Restricted() && !ao.allowRestricted {
+		return errors.Forbidden.Coded("api_key_restricted").Hintf("api key is restricted and not allowed here")
+	}
+
+	if ao.requireVerified && sess.User.VerifiedAt == nil {
+		return errors.Forbidden.Coded("unverified_email").Hintf("email is not verified")
+	}
+	return nil
+}
+
+// reloadUser replaces the user in the session (e.g., the snapshot from
+// the token) with the stored user so that changes to the roles and the
+// removal of the user apply to the sessions issued earlier. Partial
+// sessions of deleted users are allowed so that the login can complete
+// and cancel the deletion.
+func (app *appForge) reloadUser(ctx context.Context, sess *core.Session) error {
+	if app.users == nil {
+		return nil
+	}
+
+	u, err := app.users.Get(ctx, core.NewAuthKey(core.KeyKindID, sess.User.ID))
+	if err != nil {
+		if errors.Is(err, errors.NotFound) {
+			return errors.MissingAuth.Hintf("user no longer exists")
+		}
+		return err
+	} else if u.DeletedAt != nil && !sess.Partial {
+		return errors.MissingAuth.Hintf("user no longer exists")
+	}
+
+	sess.User = u.Clone(true)
+	return nil
+}
+
 func (app *appForge) setupRoutes() error {
+	providers, err := app.oauthProviders()
+	if err != nil {
+		return err
+	}
+	app.refresher = app.newRefresher()
+
+	rp, err := app.relyingParty()
+	if err != nil {
+		return err
+	}
+
 	app.chi.Route(defRoutePrefix, func(r chi.Router) {
 		r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
 			servio.JSON(w, r, http.StatusNoContent, nil)
 		})
 
-		// authenticated routes.
-		r.Group(func(r chi.Router) {
-			r.Use(app.Authenticate())
+		r.Route("/auth", func(r chi.Router) {
+			if pwdAuth, ok := findAuth[core.PasswordAuth](app.auth); ok {
+				app.passwordRoutes(r, pwdAuth)
+			}
 
-			r.Get("/me", func(w http.ResponseWriter, r *http.Request) {
-				rc := core.FromCtx(r.Context())
-				servio.JSON(w, r, 200, rc.Session.User)
-			})
+			if app.users != nil && app.mailer != nil {
+				app.verifyRoutes(r)
+			}
+
+			if ma := app.magicLink(); ma != nil {
+				r.Route("/magic-link", func(r chi.Router) { app.magicLinkRoutes(r, ma) })
+			}
+
+			if app.refresher != nil {
+				app.refreshRoutes(r)
+			}
+
+			if app.sessions != nil && app.users != nil && app.confL.Bool("auth.mfa.enabled", true) {
+				r.Route("/mfa", app.mfaRoutes)
+			}
 		})
+
+		if app.orgs != nil {
+			r.Route("/orgs", app.orgRoutes)
+		}
+
+		if app.apiKeys != nil && app.users != nil {
+			r.Route("/api-keys", app.apiKeyRoutes)
+		}
+
+		if app.sessStore != nil {
+			r.Route("/sessions", app.sessionRoutes)
+		}
+
+		if len(providers) > 0 {
+			r.Route("/oauth", func(r chi.Router) { app.oauthRoutes(r, providers) })
+		}
+
+		if rp != nil {
+			r.Route("/webauthn", func(r chi.Router) { app.webauthnRoutes(r, rp) })
+		}
+
+		r.Route("/admin", func(r chi.Router) {
+			if app.sessions != nil && app.users != nil && app.confL.Bool("auth.impersonation.enabled", true) {
+				r.Route("/impersonate", app.impersonateRoutes)
+			}
+
+			if app.auditLog != nil {
+				r.Route("/audit", app.auditRoutes)
+			}
+		})
+
+		r.Route("/me", app.meRoutes)
 	})
 	return nil
 }
 
-func extractToken(r *http.Request, cookieName string) string {
-	var token string
+// migrate runs schema migrations of the modules that need them.
+func (app *appForge) migrate(ctx context.Context) error {
+	type migrator interface {
+		Migrate(ctx context.Context) error
+	}
+
+	for _, module := range []any{app.users, app.orgs, app.tokens, app.apiKeys, app.sessStore, app.auditLog} {
+		if m, ok := module.(migrator); ok {
+			if err := m.Migrate(ctx); err != nil {
+				return errors.InternalIssue.CausedBy(err).Hintf("migration failed")
+			}
+		}
+	}
+	return nil
+}
+
+// findAuth returns the first auth module that implements T. Composite auth
+// modules exposing 'Unwrap() []core.Auth' are searched depth-first.
+func findAuth[T any](auth core.Auth) (T, bool) {
+	if found, ok := auth.(T); ok {
+		return found, true
+	}
+
+	if composite, ok := auth.(interface{ Unwrap() []core.Auth }); ok {
+		for _, inner := range composite.Unwrap() {
+			if found, ok := findAuth[T](inner); ok {
+				return found, true
+			}
+		}
+	}
+
+	var zero T
+	return zero, false
+}
+
+// extractToken returns the token from the headers or the auth cookie and
+// whether it came from the cookie.
+func extractToken(r *http.Request, cookieName string) (string, bool) {
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		return strings.TrimSpace(apiKey), false
+	}
+
 	const bearerPrefix = "Bearer "
 	if authH := r.Header.Get("Authorization"); strings.HasPrefix(authH, bearerPrefix) {
-		return strings.TrimPrefix(authH, bearerPrefix)
-	} else {
-		authCookie, err := r.Cookie(cookieName)
-		if err == nil && authCookie != nil {
-			token = authCookie.Value
+		return strings.TrimPrefix(authH, bearerPrefix), false
+	}
+
+	authCookie, err := r.Cookie(cookieName)
+	if err != nil || authCookie == nil {
+		return "", false
+	}
+	return strings.TrimSpace(authCookie.Value), true
+}
+
+func extractOrg(r *http.Request, sources []string, header, domain string) string {
+	for _, src := range sources {
+		var orgKey string
+		switch src {
+		case "path":
+			orgKey = chi.URLParam(r, "org")
+
+		case "header":
+			orgKey = r.Header.Get(header)
+
+		case "subdomain":
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+
+			if domain != "" && strings.HasSuffix(host, "."+domain) {
+				orgKey = strings.TrimSuffix(host, "."+domain)
+			}
+		}
+
+		if orgKey = strings.TrimSpace(orgKey); orgKey != "" {
+			return orgKey
 		}
 	}
-	return strings.TrimSpace(token)
+	return ""
 }
 
 func newChi() chi.Router {
@@ -0,0 +1,67 @@
+package forge_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge"
+	"github.com/spy16/forge/builtins/memstore"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/session"
+)
+
+func TestAuthenticate_reloadsUser(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conf := testConf{"webauthn.enabled": false}
+	users := memstore.NewUsers()
+
+	var iss *session.Issuer
+	app, err := forge.Forge("forgetest",
+		forge.WithConfLoader(conf),
+		forge.WithPreHook(func(app forge.PreContext) error {
+			var err error
+			if iss, err = session.FromConfig(conf); err != nil {
+				return err
+			}
+			app.SetSessions(iss)
+			app.SetAuth(iss)
+			app.SetUsers(users)
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+
+	u := core.NewUser("", "bob", "bob@bobmail.com")
+	u.Roles = []string{"admin"}
+	bob, err := users.Upsert(ctx, u)
+	require.NoError(t, err)
+
+	sess, err := iss.Issue(ctx, *bob)
+	require.NoError(t, err)
+
+	rec := doRequest(app, sess.Token, http.MethodGet, "/forge/me", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), `"admin"`)
+
+	// changes after the token was issued apply to the session.
+	bob.Roles = nil
+	_, err = users.Upsert(ctx, *bob)
+	require.NoError(t, err)
+	rec = doRequest(app, sess.Token, http.MethodGet, "/forge/me", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NotContains(t, rec.Body.String(), `"admin"`)
+
+	now := time.Now()
+	bob.DeletedAt = &now
+	_, err = users.Upsert(ctx, *bob)
+	require.NoError(t, err)
+	rec = doRequest(app, sess.Token, http.MethodGet, "/forge/me", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
+}
@@ -1,6 +1,7 @@
 package forge
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -21,6 +22,7 @@ func extractReqCtx() core.Middleware {
 				Session:    nil,
 				RequestID:  middleware.GetReqID(r.Context()),
 				RemoteAddr: r.RemoteAddr,
+				UserAgent:  r.UserAgent(),
 			}
 
 			ctx := core.NewCtx(r.Context(), rc)
@@ -29,13 +31,28 @@ func extractReqCtx() core.Middleware {
 	}
 }
 
+type sessionSlotKey struct{}
+
+// sessionSlot carries the session established by inner middlewares back
+// to the request logger so that the request line is tagged with it.
+type sessionSlot struct{ sess *core.Session }
+
 func requestLogger() core.Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			t := time.Now()
 
+			slot := &sessionSlot{}
+			ctx := context.WithValue(r.Context(), sessionSlotKey{}, slot)
+
 			rwc := &servio.ResponseWriterCapture{ResponseWriter: w}
-			next.ServeHTTP(rwc, r)
+			next.ServeHTTP(rwc, r.WithContext(ctx))
+
+			if slot.sess != nil {
+				rc := core.FromCtx(ctx)
+				rc.Session = slot.sess
+				r = r.WithContext(core.NewCtx(ctx, rc))
+			}
 
 			status := rwc.Status
 			fields := core.M{
@@ -0,0 +1,361 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spy16/forge/builtins/chain"
+	"github.com/spy16/forge/builtins/firebase"
+	"github.com/spy16/forge/builtins/memstore"
+	"github.com/spy16/forge/builtins/oidc"
+	"github.com/spy16/forge/builtins/password"
+	"github.com/spy16/forge/builtins/sqlstore"
+	"github.com/spy16/forge/builtins/supabase"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/log"
+	"github.com/spy16/forge/core/mailer"
+	"github.com/spy16/forge/core/session"
+)
+
+// initModules initialises the builtin modules using configs only.
+func initModules(app PreContext) error {
+	confL := app.Configs()
+
+	var st *sqlstore.Store
+	if confL.String("db.driver", "") != "" {
+		var err error
+		if st, err = openStore(confL); err != nil {
+			return err
+		}
+	}
+
+	users, err := newUserRegistry(confL, st)
+	if err != nil {
+		return err
+	}
+	app.SetUsers(users)
+
+	if confL.Bool("orgs.enabled", true) {
+		var orgs core.OrgRegistry = memstore.NewOrgs()
+		if st != nil {
+			orgs = st.Orgs()
+		}
+		app.SetOrgs(orgs)
+	}
+
+	var tokens core.TokenStore = memstore.NewTokens()
+	if st != nil {
+		tokens = st.Tokens()
+	}
+	app.SetTokens(tokens)
+
+	if confL.Bool("api_keys.enabled", true) {
+		var apiKeys core.APIKeyStore = memstore.NewAPIKeys()
+		if st != nil {
+			apiKeys = st.APIKeys()
+		}
+		app.SetAPIKeys(apiKeys)
+	}
+
+	auditLog, err := newAuditLog(confL, st)
+	if err != nil {
+		return err
+	}
+	app.SetAuditLog(auditLog)
+
+	sender, err := newMailer(confL)
+	if err != nil {
+		return err
+	}
+	app.SetMailer(sender)
+
+	deps := &authDeps{
+		confL:  confL,
+		users:  users,
+		tokens: tokens,
+		mailer: sender,
+	}
+
+	// in-memory tracking rejects all sessions after a restart. so it is
+	// enabled by default only when the sessions are kept in the db.
+	if confL.Bool("session.track", st != nil) {
+		var store core.SessionStore = memstore.NewSessions()
+		if st != nil {
+			store = st.Sessions()
+		} else {
+			log.Warn(context.Background(), "sessions are tracked in-memory, all sessions are lost on restart")
+		}
+		deps.sessStore = store
+	}
+
+	auth, err := newAuth(confL, confL.String("auth.module", "password"), deps)
+	if err != nil {
+		return err
+	}
+	app.SetAuth(auth)
+
+	// oauth login issues forge sessions.
+	if len(confL.Strings("oauth.providers", nil)) > 0 {
+		if _, err := deps.sessions(); err != nil {
+			return err
+		}
+	}
+	if deps.issuer != nil {
+		app.SetSessions(deps.issuer)
+		app.SetSessionStore(deps.sessStore)
+	}
+
+	return nil
+}
+
+type authDeps struct {
+	confL     core.ConfLoader
+	users     core.UserRegistry
+	tokens    core.TokenStore
+	mailer    core.Mailer
+	sessStore core.SessionStore
+	issuer    *session.Issuer
+}
+
+// sessions returns the session issuer shared by all the modules that
+// issue forge sessions. It is created on first use.
+func (deps *authDeps) sessions() (*session.Issuer, error) {
+	if deps.issuer == nil {
+		issuer, err := session.FromConfig(deps.confL)
+		if err != nil {
+			return nil, err
+		}
+		if deps.sessStore != nil {
+			issuer.SetStore(deps.sessStore)
+		}
+		deps.issuer = issuer
+	}
+	return deps.issuer, nil
+}
+
+// newAuth creates the auth module with given name. Returns nil auth for
+// the 'none' module.
+func newAuth(confL core.ConfLoader, module string, deps *authDeps) (core.Auth, error) {
+	switch module {
+	case "password":
+		return newPasswordAuth(confL, deps)
+
+	case "session":
+		// accepts forge sessions only (e.g., issued by oauth login).
+		return deps.sessions()
+
+	case "firebase":
+		return &firebase.Auth{
+			Users:     deps.users,
+			ProjectID: confL.String("auth.firebase.project_id", ""),
+		}, nil
+
+	case "supabase":
+		return &supabase.Auth{
+			Users:     deps.users,
+			APIKey:    confL.String("auth.supabase.api_key", ""),
+			ProjectID: confL.String("auth.supabase.project_id", ""),
+		}, nil
+
+	case "oidc":
+		return newOIDCAuth(confL, deps)
+
+	case "chain":
+		return newChainAuth(confL, deps)
+
+	case "none":
+		// auth disabled. all authenticated routes are inaccessible.
+		return nil, nil
+
+	default:
+		return nil, errors.InvalidInput.Hintf("unknown auth module '%s'", module)
+	}
+}
+
+// newChainAuth creates a chain of the auth modules listed in 'auth.chain'.
+// Tokens are dispatched to the modules by their issuer where known.
+func newChainAuth(confL core.ConfLoader, deps *authDeps) (core.Auth, error) {
+	ch := &chain.Auth{}
+
+	for _, module := range confL.Strings("auth.chain", nil) {
+		var backend chain.Backend
+		switch module {
+		case "password", "session":
+			issuer, err := deps.sessions()
+			if err != nil {
+				return nil, err
+			}
+			backend = chain.Backend{Match: chain.Issuer(issuer.Name())}
+
+		case "firebase":
+			projectID := confL.String("auth.firebase.project_id", "")
+			backend = chain.Backend{Match: chain.Issuer("https://securetoken.google.com/" + projectID)}
+
+		case "supabase":
+			projectID := confL.String("auth.supabase.project_id", "")
+			backend = chain.Backend{Match: chain.Issuer(fmt.Sprintf("https://%s.supabase.co/auth/v1", projectID))}
+
+		case "oidc":
+			backend = chain.Backend{Match: chain.Issuer(confL.String("auth.oidc.issuer", ""))}
+
+		default:
+			return nil, errors.InvalidInput.Hintf("auth module '%s' cannot be chained", module)
+		}
+
+		if backend.Auth == nil {
+			auth, err := newAuth(confL, module, deps)
+			if err != nil {
+				return nil, err
+			}
+			backend.Auth = auth
+		}
+		backend.Name = module
+		ch.Backends = append(ch.Backends, backend)
+	}
+
+	if len(ch.Backends) == 0 {
+		return nil, errors.InvalidInput.Hintf("auth.chain must list at least one module")
+	}
+	return ch, nil
+}
+
+func newOIDCAuth(confL core.ConfLoader, deps *authDeps) (*oidc.Auth, error) {
+	issuer := confL.String("auth.oidc.issuer", "")
+	if issuer == "" {
+		return nil, errors.InvalidInput.Hintf("auth.oidc.issuer is not configured")
+	}
+
+	// without an audience, tokens issued to any client of the provider
+	// would be accepted.
+	audience := confL.Strings("auth.oidc.audience", nil)
+	if len(audience) == 0 {
+		return nil, errors.InvalidInput.Hintf("auth.oidc.audience is not configured")
+	}
+
+	var claims map[string]string
+	if mappings := confL.Strings("auth.oidc.claims", nil); len(mappings) > 0 {
+		claims = map[string]string{}
+		for _, mapping := range mappings {
+			field, claim, ok := strings.Cut(mapping, "=")
+			if !ok || field == "" || claim == "" {
+				return nil, errors.InvalidInput.Hintf("auth.oidc.claims entry '%s' must be of the form 'field=claim'", mapping)
+			}
+			claims[field] = claim
+		}
+	}
+
+	return &oidc.Auth{
+		IssuerURL: issuer,
+		Audience:  audience,
+		Leeway:    confL.Duration("auth.oidc.leeway", time.Minute),
+		Claims:    claims,
+		Provider:  confL.String("auth.oidc.provider", "oidc"),
+		Users:     deps.users,
+	}, nil
+}
+
+func newPasswordAuth(confL core.ConfLoader, deps *authDeps) (*password.Auth, error) {
+	issuer, err := deps.sessions()
+	if err != nil {
+		return nil, err
+	}
+
+	hasher, err := core.PasswordHasherFromConfig(confL)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := core.PasswordPolicyFromConfig(confL)
+	return &password.Auth{
+		Users:    deps.users,
+		Policy:   &policy,
+		Hasher:   hasher,
+		Tokens:   deps.tokens,
+		Mailer:   deps.mailer,
+		Sessions: issuer,
+		ResetURL: confL.String("auth.reset.url", baseURL(confL)+"/reset-password"),
+		ResetTTL: confL.Duration("auth.reset.ttl", 30*time.Minute),
+	}, nil
+}
+
+func newUserRegistry(confL core.ConfLoader, st *sqlstore.Store) (core.UserRegistry, error) {
+	switch store := confL.String("users.store", "memory"); store {
+	case "memory":
+		return memstore.NewUsers(), nil
+
+	case "file":
+		return memstore.OpenUsers(confL.String("users.file", "forge_users.json"))
+
+	case "sql":
+		if st == nil {
+			return nil, errors.InvalidInput.Hintf("db.driver is not configured")
+		}
+		return st.Users(), nil
+
+	default:
+		return nil, errors.InvalidInput.Hintf("unknown users.store '%s'", store)
+	}
+}
+
+func newAuditLog(confL core.ConfLoader, st *sqlstore.Store) (core.AuditLog, error) {
+	switch store := confL.String("audit.store", "memory"); store {
+	case "memory":
+		return memstore.NewAuditLog(), nil
+
+	case "file":
+		return memstore.OpenAuditLog(confL.String("audit.file", "forge_audit.jsonl"))
+
+	case "sql":
+		if st == nil {
+			return nil, errors.InvalidInput.Hintf("db.driver is not configured")
+		}
+		return st.AuditLog(), nil
+
+	case "none":
+		return nil, nil
+
+	default:
+		return nil, errors.InvalidInput.Hintf("unknown audit.store '%s'", store)
+	}
+}
+
+func newMailer(confL core.ConfLoader) (core.Mailer, error) {
+	from := confL.String("mailer.from", "forge@localhost")
+
+	switch kind := confL.String("mailer.kind", "none"); kind {
+	case "log":
+		return mailer.Log{ShowBody: confL.Bool("mailer.log_body", false)}, nil
+
+	case "file":
+		return &mailer.File{Dir: confL.String("mailer.dir", "mails"), From: from}, nil
+
+	case "smtp":
+		return &mailer.SMTP{
+			Addr:     confL.String("mailer.smtp.addr", "localhost:25"),
+			From:     from,
+			Username: confL.String("mailer.smtp.username", ""),
+			Password: confL.String("mailer.smtp.password", ""),
+		}, nil
+
+	case "none":
+		return nil, nil
+
+	default:
+		return nil, errors.InvalidInput.Hintf("unknown mailer.kind '%s'", kind)
+	}
+}
+
+func baseURL(confL core.ConfLoader) string {
+	return strings.TrimSuffix(confL.String("base_url", "http://localhost:8080"), "/")
+}
+
+func openStore(confL core.ConfLoader) (*sqlstore.Store, error) {
+	driver := confL.String("db.driver", "")
+	if driver == "" {
+		return nil, errors.InvalidInput.Hintf("db.driver is not configured")
+	}
+	return sqlstore.Open(driver, confL.String("db.dsn", ""))
+}
@@ -1,9 +1,12 @@
 package forge
 
 import (
+	"context"
+
 	"github.com/go-chi/chi/v5"
 
 	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/session"
 	"github.com/spy16/forge/core/vipercfg"
 )
 
@@ -11,15 +14,34 @@ import (
 type PreContext interface {
 	Configs() core.ConfLoader
 	SetAuth(auth core.Auth)
+	SetUsers(reg core.UserRegistry)
+	SetOrgs(reg core.OrgRegistry)
+	SetTokens(ts core.TokenStore)
+	SetAPIKeys(ks core.APIKeyStore)
+	SetMailer(m core.Mailer)
+	SetSessions(iss *session.Issuer)
+	SetSessionStore(ss core.SessionStore)
+	SetAuditLog(al core.AuditLog)
 	SetRouter(r chi.Router)
 }
 
 // PostContext is the app state after fully initialised.
 type PostContext interface {
 	Auth() core.Auth
+	Users() core.UserRegistry
+	Orgs() core.OrgRegistry
+	Tokens() core.TokenStore
+	APIKeys() core.APIKeyStore
+	Mailer() core.Mailer
+	Sessions() *session.Issuer
+	SessionStore() core.SessionStore
+	AuditLog() core.AuditLog
 	Router() chi.Router
 	Configs() core.ConfLoader
-	Authenticate() Middleware
+	Authenticate(opts ...AuthOption) Middleware
+	Authorize(perms ...string) Middleware
+	ResolveOrg() Middleware
+	Audit(ctx context.Context, ev core.AuditEvent)
 }
 
 // Option can be passed to Forge() to control the forging process.
@@ -67,6 +89,52 @@ func WithPostHook(hook func(app PostContext) error) Option {
 	}
 }
 
+// WithPurge can be used to run the periodic purge of the deleted accounts
+// past their grace period. The purge stops when the context is done.
+func WithPurge(ctx context.Context) Option {
+	return func(app *appForge) error {
+		app.purgeCtx = ctx
+		return nil
+	}
+}
+
+// AuthOption can be passed to Authenticate() to further restrict access
+// to the routes.
+type AuthOption func(opts *authOpts)
+
+type authOpts struct {
+	requireVerified bool
+	requireMFA      bool
+	allowRestricted bool
+
+	// allowPartial accepts sessions with the second factor pending. used
+	// only by the routes that complete the second factor.
+	allowPartial bool
+}
+
+// RequireVerified restricts access to users with verified email.
+func RequireVerified() AuthOption {
+	return func(opts *authOpts) { opts.requireVerified = true }
+}
+
+// RequireMFA restricts access to sessions for which the second factor has
+// been completed. Users without MFA enabled are rejected as well.
+func RequireMFA() AuthOption {
+	return func(opts *authOpts) { opts.requireMFA = true }
+}
+
+// AllowRestrictedKeys accepts API keys limited to scopes or to an org.
+// Such keys are rejected by default since only Authorize checks scopes
+// and only ResolveOrg checks the org. Routes using this option must use
+// them as well.
+func AllowRestrictedKeys() AuthOption {
+	return func(opts *authOpts) { opts.allowRestricted = true }
+}
+
+func allowPartial() AuthOption {
+	return func(opts *authOpts) { opts.allowPartial = true }
+}
+
 func withDefaults(opts []Option) []Option {
 	return append([]Option{
 		WithConfLoader(nil),
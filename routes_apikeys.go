@@ -0,0 +1,153 @@
+package forge
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/servio"
+)
+
+func (app *appForge) apiKeyRoutes(r chi.Router) {
+	r.Use(app.Authenticate(), denyAPIKeys)
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		rc := core.FromCtx(r.Context())
+		keys, err := app.apiKeys.List(r.Context(), rc.Session.User.ID, "")
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		if keys == nil {
+			keys = []core.APIKey{}
+		}
+		servio.JSON(w, r, http.StatusOK, keys)
+	})
+
+	r.With(denyImpersonation).Post("/", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name      string   `json:"name"`
+			Org       string   `json:"org"`
+			Scopes    []string `json:"scopes"`
+			ExpiresIn string   `json:"expires_in"`
+		}
+		if err := servio.BindJSON(r, &req); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		var ttl time.Duration
+		if req.ExpiresIn != "" {
+			var err error
+			if ttl, err = time.ParseDuration(req.ExpiresIn); err != nil || ttl <= 0 {
+				servio.JSONErr(w, r, errors.InvalidInput.Hintf("expires_in must be a positive duration"))
+				return
+			}
+		}
+
+		if maxTTL := app.confL.Duration("api_keys.max_ttl", 0); maxTTL > 0 && (ttl == 0 || ttl > maxTTL) {
+			servio.JSONErr(w, r, errors.InvalidInput.Hintf("expires_in must be at most %s", maxTTL))
+			return
+		}
+
+		rc := core.FromCtx(r.Context())
+		raw, key := core.NewAPIKey(rc.Session.User.ID, req.Name, req.Scopes, ttl)
+
+		if req.Org != "" {
+			org, err := app.orgAdminOf(r, req.Org)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+			key.OrgID = org.ID
+		}
+
+		if err := app.apiKeys.Create(r.Context(), key); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		app.Audit(r.Context(), core.AuditEvent{
+			Action:   "api_key.create",
+			TargetID: key.UserID,
+			Attribs:  core.M{"key_id": key.ID, "org_id": key.OrgID, "scopes": key.Scopes},
+		})
+
+		servio.JSON(w, r, http.StatusCreated, core.M{
+			"key":     raw,
+			"api_key": key,
+		})
+	})
+
+	r.With(denyImpersonation).Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		rc := core.FromCtx(r.Context())
+
+		key, err := app.apiKeys.Get(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		// keys of an org can also be revoked by the org admins.
+		if key.UserID != rc.Session.User.ID {
+			if key.OrgID == "" {
+				servio.JSONErr(w, r, errors.NotFound.Hintf("api key not found"))
+				return
+			} else if _, err := app.orgAdminOf(r, key.OrgID); err != nil {
+				servio.JSONErr(w, r, errors.NotFound.Hintf("api key not found"))
+				return
+			}
+		}
+
+		if err := app.apiKeys.Revoke(r.Context(), key.ID); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		app.Audit(r.Context(), core.AuditEvent{
+			Action:   "api_key.revoke",
+			TargetID: key.UserID,
+			Attribs:  core.M{"key_id": key.ID, "org_id": key.OrgID},
+		})
+		servio.JSON(w, r, http.StatusNoContent, nil)
+	})
+}
+
+// orgAdminOf returns the org if the current user is an admin of it.
+func (app *appForge) orgAdminOf(r *http.Request, orgKey string) (*core.Org, error) {
+	if app.orgs == nil {
+		return nil, errors.Unsupported.Hintf("orgs are not enabled")
+	}
+
+	org, err := app.orgs.Get(r.Context(), orgKey)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := app.orgs.Member(r.Context(), org.ID, core.FromCtx(r.Context()).Session.User.ID)
+	if err != nil {
+		if errors.Is(err, errors.NotFound) {
+			err = errors.NotFound.Hintf("org '%s' not found", orgKey)
+		}
+		return nil, err
+	} else if !m.HasRole(core.OrgRoleAdmin) {
+		return nil, errOrgRole.Hintf("only admins can manage api keys of the org")
+	}
+	return org, nil
+}
+
+// denyAPIKeys rejects requests authenticated using API keys so that keys
+// cannot be used to mint or revoke other keys.
+func denyAPIKeys(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rc := core.FromCtx(r.Context()); rc.Session != nil && rc.Session.APIKey != nil {
+			servio.JSONErr(w, r, errors.Forbidden.Coded("api_key_not_allowed").Hintf("not allowed using api keys"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
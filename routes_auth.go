@@ -0,0 +1,130 @@
+package forge
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/log"
+	"github.com/spy16/forge/core/servio"
+)
+
+func (app *appForge) passwordRoutes(r chi.Router, pa core.PasswordAuth) {
+	type credentials struct {
+		Email    string `json:"email"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	r.Post("/signup", func(w http.ResponseWriter, r *http.Request) {
+		var creds credentials
+		if err := servio.BindJSON(r, &creds); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		sess, err := pa.Signup(r.Context(), creds.Email, creds.Username, creds.Password)
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		} else if err := app.completeLogin(w, r, sess); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		app.Audit(r.Context(), core.AuditEvent{
+			Action:   "signup",
+			ActorID:  sess.User.ID,
+			TargetID: sess.User.ID,
+			Attribs:  core.M{"method": "password", "session_id": sess.ID},
+		})
+
+		if app.users != nil && app.mailer != nil {
+			if err := app.sendVerification(r.Context(), sess.User.ID); err != nil {
+				log.Warn(r.Context(), "failed to send verification mail", core.M{"error": err.Error()})
+			}
+		}
+		servio.JSON(w, r, http.StatusCreated, sess)
+	})
+
+	r.Post("/login", func(w http.ResponseWriter, r *http.Request) {
+		var creds credentials
+		if err := servio.BindJSON(r, &creds); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		key := creds.Email
+		if key == "" {
+			key = creds.Username
+		}
+
+		sess, err := pa.Login(r.Context(), key, creds.Password)
+		if err != nil {
+			app.auditLoginFailure(r.Context(), "", "password", err, core.M{"key": key})
+			servio.JSONErr(w, r, err)
+			return
+		} else if err := app.completeLogin(w, r, sess); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		app.onLogin(r.Context(), sess, "password")
+		servio.JSON(w, r, http.StatusOK, sess)
+	})
+
+	r.Post("/password/forgot", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email string `json:"email"`
+		}
+		if err := servio.BindJSON(r, &req); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		if err := pa.ForgotPassword(r.Context(), req.Email); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+		servio.JSON(w, r, http.StatusNoContent, nil)
+	})
+
+	r.Post("/password/reset", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+		if err := servio.BindJSON(r, &req); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		userID, err := pa.ResetPassword(r.Context(), req.Token, req.Password)
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		app.Audit(r.Context(), core.AuditEvent{Action: "password.reset", TargetID: userID})
+		servio.JSON(w, r, http.StatusNoContent, nil)
+	})
+
+	r.With(app.Authenticate()).Post("/logout", func(w http.ResponseWriter, r *http.Request) {
+		rc := core.FromCtx(r.Context())
+		if err := pa.Logout(r.Context(), rc.Session.Token); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+		// revoking the session invalidates its refresh tokens as well.
+		app.clearRefreshCookie(w)
+		app.clearAuthCookie(w)
+
+		app.Audit(r.Context(), core.AuditEvent{
+			Action:   "logout",
+			TargetID: rc.Session.User.ID,
+			Attribs:  core.M{"session_id": rc.Session.ID},
+		})
+		servio.JSON(w, r, http.StatusNoContent, nil)
+	})
+}
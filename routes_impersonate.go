@@ -0,0 +1,104 @@
+package forge
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/servio"
+)
+
+const permImpersonate = "users:impersonate"
+
+var errImpersonating = errors.Forbidden.Coded("impersonation_not_allowed").Hintf("not allowed while impersonating")
+
+func (app *appForge) impersonateRoutes(r chi.Router) {
+	rolePerms := core.RolePermsFromConfig(app.confL)
+
+	// start impersonating the target user. the session is issued to the
+	// actor and carries the actor identity in it.
+	r.With(app.Authenticate(), denyAPIKeys, denyImpersonation, app.Authorize(permImpersonate)).
+		Post("/", func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				UserID string `json:"user_id"`
+				Email  string `json:"email"`
+				Reason string `json:"reason"`
+			}
+			if err := servio.BindJSON(r, &req); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			key := core.NewAuthKey(core.KeyKindID, strings.TrimSpace(req.UserID))
+			if req.UserID == "" {
+				key = core.NewAuthKey(core.KeyKindEmail, strings.TrimSpace(req.Email))
+			}
+
+			target, err := app.users.Get(r.Context(), key)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			rc := core.FromCtx(r.Context())
+			actor := rc.Session.User
+			if target.ID == actor.ID {
+				servio.JSONErr(w, r, errors.InvalidInput.Hintf("cannot impersonate yourself"))
+				return
+			} else if len(core.MissingPerms(target.Granted(rolePerms), permImpersonate)) == 0 {
+				// would allow escalating to the privileges of the target.
+				servio.JSONErr(w, r, errors.Forbidden.Coded("privileged_target").Hintf("cannot impersonate users who can impersonate"))
+				return
+			}
+
+			sess, err := app.sessions.Impersonate(r.Context(), *target, core.Actor{ID: actor.ID, Email: actor.Email}, rc.Session.MFA)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			app.Audit(r.Context(), core.AuditEvent{
+				Action:   "impersonation.start",
+				ActorID:  actor.ID,
+				TargetID: target.ID,
+				Attribs:  core.M{"session_id": sess.ID, "reason": req.Reason},
+			})
+			servio.JSON(w, r, http.StatusCreated, sess)
+		})
+
+	// stop impersonating. must be called with the impersonation session.
+	r.With(app.Authenticate()).Delete("/", func(w http.ResponseWriter, r *http.Request) {
+		rc := core.FromCtx(r.Context())
+		if !rc.Impersonating() {
+			servio.JSONErr(w, r, errors.InvalidInput.Coded("not_impersonating").Hintf("session is not an impersonation"))
+			return
+		}
+
+		if err := app.sessions.Revoke(r.Context(), rc.Session.Token); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		app.Audit(r.Context(), core.AuditEvent{
+			Action:   "impersonation.stop",
+			TargetID: rc.Session.User.ID,
+			Attribs:  core.M{"session_id": rc.Session.ID},
+		})
+		servio.JSON(w, r, http.StatusNoContent, nil)
+	})
+}
+
+// denyImpersonation rejects requests made using impersonation sessions so
+// that sensitive actions are performed only by the users themselves.
+func denyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if core.FromCtx(r.Context()).Impersonating() {
+			servio.JSONErr(w, r, errImpersonating)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
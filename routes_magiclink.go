@@ -0,0 +1,150 @@
+package forge
+
+import (
+	"html/template"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/forge/builtins/magiclink"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/servio"
+)
+
+var magicLinkPage = template.Must(template.New("magic_link").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Log in</title></head>
+<body>
+<form method="post">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Continue to log in</button>
+</form>
+</body>
+</html>
+`))
+
+// magicLink returns the passwordless email login if it is enabled. It
+// needs users, tokens, a mailer and sessions.
+func (app *appForge) magicLink() *magiclink.Auth {
+	if !app.confL.Bool("auth.magic_link.enabled", true) {
+		return nil
+	} else if app.users == nil || app.tokens == nil || app.mailer == nil || app.sessions == nil {
+		return nil
+	}
+
+	return &magiclink.Auth{
+		Users:    app.users,
+		Tokens:   app.tokens,
+		Mailer:   app.mailer,
+		Sessions: app.sessions,
+		LinkURL:  app.confL.String("auth.magic_link.url", baseURL(app.confL)+defRoutePrefix+"/auth/magic-link/verify"),
+		TTL:      app.confL.Duration("auth.magic_link.ttl", 15*time.Minute),
+		Cooldown: app.confL.Duration("auth.magic_link.cooldown", time.Minute),
+		Signup:   app.confL.Bool("auth.magic_link.signup", true),
+	}
+}
+
+func (app *appForge) magicLinkRoutes(r chi.Router, ma *magiclink.Auth) {
+	defRedirect := app.confL.String("auth.magic_link.redirect_url", "/")
+
+	// mail a login link and code. always succeeds for valid emails so that
+	// registered emails are not revealed.
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email    string `json:"email"`
+			Redirect string `json:"redirect"`
+		}
+		if err := servio.BindJSON(r, &req); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		if req.Redirect != "" && !app.isSafeRedirect(req.Redirect) {
+			servio.JSONErr(w, r, errors.InvalidInput.Hintf("redirect must be a path or a url on the same origin"))
+			return
+		}
+
+		if err := ma.Send(r.Context(), req.Email, req.Redirect); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+		servio.JSON(w, r, http.StatusNoContent, nil)
+	})
+
+	// the link from the mail renders a page that posts the token back.
+	// the token is not redeemed on GET since mail scanners and previews
+	// follow the links.
+	r.Get("/verify", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		_ = magicLinkPage.Execute(w, r.URL.Query().Get("token"))
+	})
+
+	// redeem the token of the link or the code for a session. the form
+	// post from the link page sets the session as cookie and redirects.
+	r.Post("/verify", func(w http.ResponseWriter, r *http.Request) {
+		if isFormPost(r) {
+			sess, redirect, err := ma.RedeemLink(r.Context(), r.PostFormValue("token"))
+			if err != nil {
+				app.auditLoginFailure(r.Context(), "", "magic_link", err, nil)
+				servio.JSONErr(w, r, err)
+				return
+			} else if err := app.attachRefresh(w, r, sess); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			app.setAuthCookie(w, sess)
+			app.onLogin(r.Context(), sess, "magic_link")
+
+			if redirect == "" {
+				redirect = defRedirect
+			}
+			http.Redirect(w, r, redirect, http.StatusFound)
+			return
+		}
+
+		var req struct {
+			Token string `json:"token"`
+			Email string `json:"email"`
+			Code  string `json:"code"`
+		}
+		if err := servio.BindJSON(r, &req); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		var sess *core.Session
+		var err error
+		method := "magic_link"
+		if req.Token != "" {
+			sess, _, err = ma.RedeemLink(r.Context(), req.Token)
+		} else if req.Email != "" && req.Code != "" {
+			method = "magic_code"
+			sess, err = ma.RedeemCode(r.Context(), req.Email, req.Code)
+		} else {
+			err = errors.InvalidInput.Hintf("either token or email and code must be set")
+		}
+
+		if err != nil {
+			app.auditLoginFailure(r.Context(), "", method, err, core.M{"email": req.Email})
+			servio.JSONErr(w, r, err)
+			return
+		} else if err := app.completeLogin(w, r, sess); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		app.onLogin(r.Context(), sess, method)
+		servio.JSON(w, r, http.StatusOK, sess)
+	})
+}
+
+func isFormPost(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/x-www-form-urlencoded"
+}
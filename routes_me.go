@@ -0,0 +1,391 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/log"
+	"github.com/spy16/forge/core/servio"
+	"github.com/spy16/forge/core/strutils"
+)
+
+const tokenKindEmailChange = "email_change"
+
+const emailChangeMailBody = `Hello %s,
+
+Please confirm the new email of your account by visiting the link below:
+
+%s
+
+The link expires at %s. If you did not request this, ignore this email.
+`
+
+const emailChangedMailBody = `Hello %s,
+
+The email of your account was changed to %s. If you did not make this
+change, contact support immediately.
+`
+
+var (
+	errBadPassword = errors.Forbidden.Coded("invalid_password").Hintf("password does not match")
+	errEmailTaken  = errors.Conflict.Coded("email_taken").Hintf("email is already registered")
+)
+
+func (app *appForge) meRoutes(r chi.Router) {
+	r.Use(app.Authenticate())
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		rc := core.FromCtx(r.Context())
+		servio.JSON(w, r, 200, rc.Session.User)
+	})
+
+	if app.users == nil {
+		return
+	}
+
+	// update the username and the profile claims in the user data. claims
+	// set to null are removed.
+	r.With(denyAPIKeys).Patch("/", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Username *string       `json:"username"`
+			Data     core.UserData `json:"data"`
+		}
+		if err := servio.BindJSON(r, &req); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		u, err := app.currentUser(r)
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		var changed []string
+		if req.Username != nil {
+			u.Username = strings.TrimSpace(*req.Username)
+			changed = append(changed, "username")
+		}
+		if u.Data == nil {
+			u.Data = core.UserData{}
+		}
+		if err := u.Data.Patch(req.Data); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+		for claim := range req.Data {
+			changed = append(changed, "data."+claim)
+		}
+
+		if err := u.Validate(); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		updated, err := app.users.Upsert(r.Context(), *u)
+		if err != nil {
+			if errors.Is(err, errors.Conflict) {
+				err = errors.Conflict.Coded("username_taken").Hintf("username is already registered")
+			}
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		app.Audit(r.Context(), core.AuditEvent{
+			Action:   "profile.update",
+			TargetID: u.ID,
+			Attribs:  core.M{"fields": changed},
+		})
+		servio.JSON(w, r, http.StatusOK, updated.Clone(true))
+	})
+
+	// request an email change. the new email is applied only once it is
+	// confirmed using the link mailed to it.
+	r.With(denyAPIKeys, denyImpersonation).Post("/email", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+		if err := servio.BindJSON(r, &req); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		u, err := app.currentUser(r)
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		} else if err := app.confirmIdentity(r, u, req.Password); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		email := strings.TrimSpace(req.Email)
+		if !strutils.IsValidEmail(email) {
+			servio.JSONErr(w, r, errors.InvalidInput.Hintf("invalid email"))
+			return
+		} else if strings.EqualFold(email, u.Email) {
+			servio.JSONErr(w, r, errors.InvalidInput.Hintf("email is unchanged"))
+			return
+		} else if app.tokens == nil || app.mailer == nil {
+			servio.JSONErr(w, r, errors.Unsupported.Hintf("email change needs tokens and a mailer"))
+			return
+		}
+
+		if _, err := app.users.Get(r.Context(), core.NewAuthKey(core.KeyKindEmail, email)); err == nil {
+			servio.JSONErr(w, r, errEmailTaken)
+			return
+		} else if !errors.Is(err, errors.NotFound) {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		ttl := app.confL.Duration("auth.verify.ttl", 24*time.Hour)
+		raw, tok := core.NewToken(tokenKindEmailChange, u.ID, ttl)
+		// the session requesting the change is kept when the change is
+		// applied.
+		tok.Attribs = core.M{"email": email, "session_id": core.FromCtx(r.Context()).Session.ID}
+		if err := app.tokens.Put(r.Context(), tok); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		link := fmt.Sprintf("%s%s/auth/verify/email?%s",
+			baseURL(app.confL),
+			defRoutePrefix,
+			url.Values{"token": {raw}}.Encode(),
+		)
+		if err := app.mailer.Send(r.Context(), core.Mail{
+			To:      []string{email},
+			Subject: "Confirm your new email",
+			Body:    fmt.Sprintf(emailChangeMailBody, u.Username, link, tok.ExpiresAt.Format(time.RFC1123)),
+		}); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		app.Audit(r.Context(), core.AuditEvent{
+			Action:   "email.change_requested",
+			TargetID: u.ID,
+			Attribs:  core.M{"new_email": email},
+		})
+		servio.JSON(w, r, http.StatusAccepted, core.M{"pending_email": email})
+	})
+
+	// change the password. other sessions of the user are revoked.
+	if pa, ok := findAuth[core.PasswordAuth](app.auth); ok {
+		r.With(denyAPIKeys, denyImpersonation).Post("/password", func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				CurrentPassword string `json:"current_password"`
+				Password        string `json:"password"`
+			}
+			if err := servio.BindJSON(r, &req); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			rc := core.FromCtx(r.Context())
+			if err := pa.ChangePassword(r.Context(), rc.Session.User.ID, req.CurrentPassword, req.Password); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			if app.sessStore != nil {
+				if err := app.sessStore.RevokeUser(r.Context(), rc.Session.User.ID, rc.Session.ID); err != nil {
+					log.Warn(r.Context(), "failed to revoke sessions", core.M{"error": err.Error()})
+				}
+			}
+
+			app.Audit(r.Context(), core.AuditEvent{
+				Action:   "password.change",
+				TargetID: rc.Session.User.ID,
+			})
+			servio.JSON(w, r, http.StatusNoContent, nil)
+		})
+	}
+
+	// delete the account. the account is removed permanently after the
+	// grace period and logging in before that cancels the deletion.
+	r.With(denyAPIKeys, denyImpersonation).Delete("/", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := servio.BindJSON(r, &req); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		u, err := app.currentUser(r)
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		} else if err := app.confirmIdentity(r, u, req.Password); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		now := time.Now()
+		u.DeletedAt = &now
+		if _, err := app.users.Upsert(r.Context(), *u); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		if app.sessions != nil {
+			if err := app.sessions.RevokeUser(r.Context(), u.ID); err != nil {
+				log.Warn(r.Context(), "failed to revoke sessions", core.M{"error": err.Error()})
+			}
+		}
+		app.clearRefreshCookie(w)
+		app.clearAuthCookie(w)
+
+		purgeAt := now.Add(app.gracePeriod())
+		app.Audit(r.Context(), core.AuditEvent{
+			Action:   "account.delete",
+			TargetID: u.ID,
+			Attribs:  core.M{"purge_at": purgeAt},
+		})
+
+		servio.JSON(w, r, http.StatusOK, core.M{"purge_at": purgeAt})
+	})
+}
+
+func (app *appForge) gracePeriod() time.Duration {
+	return app.confL.Duration("users.delete.grace_period", 30*24*time.Hour)
+}
+
+// purgeLoop purges the accounts past their grace period every
+// 'users.delete.purge_interval' until the context is done.
+func (app *appForge) purgeLoop(ctx context.Context) {
+	interval := app.confL.Duration("users.delete.purge_interval", time.Hour)
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.purgeUsers(ctx, time.Now().Add(-app.gracePeriod()))
+		}
+	}
+}
+
+// purgeUsers removes the accounts deleted before the given time along with
+// their org memberships, api keys and sessions. Failures are logged and
+// the purge is retried on the next run.
+func (app *appForge) purgeUsers(ctx context.Context, before time.Time) {
+	purged, err := app.users.Purge(ctx, before)
+	if err != nil {
+		log.Warn(ctx, "failed to purge deleted users", core.M{"error": err.Error()})
+		return
+	}
+
+	for _, id := range purged {
+		// sql stores remove these along with the user. others are cleaned
+		// up here.
+		if err := app.purgeUserData(ctx, id); err != nil {
+			log.Warn(ctx, "failed to purge data of deleted user", core.M{"user_id": id, "error": err.Error()})
+		}
+		app.Audit(ctx, core.AuditEvent{Action: "account.purge", TargetID: id})
+	}
+}
+
+func (app *appForge) purgeUserData(ctx context.Context, userID string) error {
+	if app.orgs != nil {
+		memberships, err := app.orgs.UserOrgs(ctx, userID)
+		if err != nil {
+			return err
+		}
+		for _, m := range memberships {
+			if err := app.orgs.RemoveMember(ctx, m.OrgID, userID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if app.apiKeys != nil {
+		keys, err := app.apiKeys.List(ctx, userID, "")
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if key.RevokedAt != nil {
+				continue
+			} else if err := app.apiKeys.Revoke(ctx, key.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if app.sessStore != nil {
+		return app.sessStore.RevokeUser(ctx, userID)
+	}
+	return nil
+}
+
+// restoreUser cancels the pending deletion of the session user. It is
+// called on login.
+func (app *appForge) restoreUser(ctx context.Context, sess *core.Session) {
+	if app.users == nil || sess.Partial || sess.User.DeletedAt == nil {
+		return
+	}
+
+	u, err := app.users.Get(ctx, core.NewAuthKey(core.KeyKindID, sess.User.ID))
+	if err == nil {
+		u.DeletedAt = nil
+		_, err = app.users.Upsert(ctx, *u)
+	}
+	if err != nil {
+		log.Warn(ctx, "failed to restore deleted user", core.M{"error": err.Error()})
+		return
+	}
+
+	sess.User.DeletedAt = nil
+	app.Audit(ctx, core.AuditEvent{
+		Action:   "account.restore",
+		ActorID:  sess.User.ID,
+		TargetID: sess.User.ID,
+	})
+}
+
+// confirmIdentity requires the password of the user for sensitive changes.
+// The password is verified by the password module and failures are
+// audited. Users without a password (e.g., oauth or passkey users) must
+// have logged in (or completed the second factor) recently instead.
+func (app *appForge) confirmIdentity(r *http.Request, u *core.User, pwd string) error {
+	if pa, ok := findAuth[core.PasswordAuth](app.auth); ok && u.PwdHash != nil {
+		err := pa.VerifyPassword(r.Context(), u.ID, pwd)
+		if err == nil {
+			return nil
+		} else if errors.OneOf(err, []error{errors.MissingAuth, errors.Throttled}) {
+			app.Audit(r.Context(), core.AuditEvent{
+				Action:   "reauth.failed",
+				ActorID:  u.ID,
+				TargetID: u.ID,
+				Attribs:  core.M{"reason": errors.E(err).Code},
+			})
+			if errors.Is(err, errors.MissingAuth) {
+				return errBadPassword
+			}
+		}
+		return err
+	}
+
+	maxAge := app.confL.Duration("users.reauth_max_age", 10*time.Minute)
+	if authTime := core.FromCtx(r.Context()).Session.AuthTime; time.Since(authTime) > maxAge {
+		return errors.Forbidden.Coded("reauth_required").Hintf("log in again to confirm this change")
+	}
+	return nil
+}
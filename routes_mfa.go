@@ -0,0 +1,268 @@
+package forge
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/servio"
+	"github.com/spy16/forge/core/totp"
+)
+
+var (
+	errMFANotEnabled = errors.Conflict.Coded("mfa_not_enabled").Hintf("mfa is not enabled")
+	errMFAEnabled    = errors.Conflict.Coded("mfa_already_enabled").Hintf("mfa is already enabled")
+)
+
+func (app *appForge) mfaRoutes(r chi.Router) {
+	cookieName := app.confL.String("auth.cookie_name", "_forge_auth")
+	issuerName := app.confL.String("auth.mfa.issuer", app.name)
+
+	type codeReq struct {
+		Code string `json:"code"`
+	}
+
+	// complete the second factor of a partial session (or step-up a full
+	// session) using a TOTP or recovery code. impersonation sessions cannot
+	// be stepped up as the second factor is of the user.
+	r.With(app.Authenticate(allowPartial()), denyAPIKeys, denyImpersonation).Post("/verify", func(w http.ResponseWriter, r *http.Request) {
+		var req codeReq
+		if err := servio.BindJSON(r, &req); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		rc := core.FromCtx(r.Context())
+		defer app.mfaLocks.lock(rc.Session.User.ID)()
+
+		u, err := app.verifyMFA(r.Context(), rc.Session.User.ID, req.Code)
+		if err != nil {
+			app.auditLoginFailure(r.Context(), rc.Session.User.ID, "mfa", err, nil)
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		sess, err := app.sessions.IssueMFA(r.Context(), *u)
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		} else if err := app.attachRefresh(w, r, sess); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		if rc.Session.Partial {
+			// partial sessions are single use.
+			_ = app.sessions.Revoke(r.Context(), rc.Session.Token)
+		}
+
+		// keep cookie-authenticated clients on the cookie.
+		if _, fromCookie := extractToken(r, cookieName); app.cookieMode() || fromCookie {
+			app.setAuthCookie(w, sess)
+		}
+
+		app.onLogin(r.Context(), sess, "mfa")
+		servio.JSON(w, r, http.StatusOK, sess)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(app.Authenticate(), denyAPIKeys, denyImpersonation)
+
+		// start the enrolment. the secret must be added to an authenticator
+		// app and confirmed with a code.
+		r.Post("/totp", func(w http.ResponseWriter, r *http.Request) {
+			defer app.mfaLocks.lock(core.FromCtx(r.Context()).Session.User.ID)()
+
+			u, err := app.currentUser(r)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			} else if u.MFAEnabled() {
+				servio.JSONErr(w, r, errMFAEnabled)
+				return
+			}
+
+			secret := totp.NewSecret()
+			u.SetMFA(&core.MFA{Secret: secret})
+			if _, err := app.users.Upsert(r.Context(), *u); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			servio.JSON(w, r, http.StatusOK, core.M{
+				"secret": secret,
+				"uri":    totp.URI(issuerName, u.Email, secret),
+			})
+		})
+
+		// confirm the enrolment and generate the recovery codes.
+		r.Post("/totp/confirm", func(w http.ResponseWriter, r *http.Request) {
+			var req codeReq
+			if err := servio.BindJSON(r, &req); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			defer app.mfaLocks.lock(core.FromCtx(r.Context()).Session.User.ID)()
+
+			u, err := app.currentUser(r)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			m := u.MFA()
+			if m == nil {
+				servio.JSONErr(w, r, errors.Conflict.Coded("mfa_not_enrolling").Hintf("mfa enrolment is not started"))
+				return
+			} else if m.EnabledAt != nil {
+				servio.JSONErr(w, r, errMFAEnabled)
+				return
+			}
+
+			now := time.Now()
+			verifyErr := m.Verify(req.Code, now)
+
+			var codes []string
+			if verifyErr == nil {
+				codes, m.RecoveryCodes = core.NewRecoveryCodes()
+				m.EnabledAt = &now
+			}
+
+			u.SetMFA(m)
+			if _, err := app.users.Upsert(r.Context(), *u); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			} else if verifyErr != nil {
+				servio.JSONErr(w, r, verifyErr)
+				return
+			}
+			servio.JSON(w, r, http.StatusOK, core.M{"recovery_codes": codes})
+		})
+
+		r.Delete("/totp", func(w http.ResponseWriter, r *http.Request) {
+			var req codeReq
+			if err := servio.BindJSON(r, &req); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			userID := core.FromCtx(r.Context()).Session.User.ID
+			defer app.mfaLocks.lock(userID)()
+
+			u, err := app.verifyMFA(r.Context(), userID, req.Code)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			u.SetMFA(nil)
+			if _, err := app.users.Upsert(r.Context(), *u); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+			servio.JSON(w, r, http.StatusNoContent, nil)
+		})
+
+		// replace the recovery codes.
+		r.Post("/recovery-codes", func(w http.ResponseWriter, r *http.Request) {
+			var req codeReq
+			if err := servio.BindJSON(r, &req); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			userID := core.FromCtx(r.Context()).Session.User.ID
+			defer app.mfaLocks.lock(userID)()
+
+			u, err := app.verifyMFA(r.Context(), userID, req.Code)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			m := u.MFA()
+			var codes []string
+			codes, m.RecoveryCodes = core.NewRecoveryCodes()
+			u.SetMFA(m)
+			if _, err := app.users.Upsert(r.Context(), *u); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+			servio.JSON(w, r, http.StatusOK, core.M{"recovery_codes": codes})
+		})
+	})
+}
+
+// verifyMFA verifies the code against the MFA settings of the user. The
+// updated MFA state is persisted whether or not the code is valid. The
+// caller must hold the MFA lock of the user so that concurrent attempts
+// cannot lose the failure count or replay a code.
+func (app *appForge) verifyMFA(ctx context.Context, userID, code string) (*core.User, error) {
+	u, err := app.users.Get(ctx, core.NewAuthKey(core.KeyKindID, userID))
+	if err != nil {
+		return nil, err
+	} else if !u.MFAEnabled() {
+		return nil, errMFANotEnabled
+	}
+
+	m := u.MFA()
+	verifyErr := m.Verify(code, time.Now())
+	u.SetMFA(m)
+
+	saved, err := app.users.Upsert(ctx, *u)
+	if err != nil {
+		return nil, err
+	} else if verifyErr != nil {
+		return nil, verifyErr
+	}
+	return saved, nil
+}
+
+// userLocks serializes the read-modify-write of per-user state (e.g., MFA
+// failure counts) within the process.
+type userLocks struct {
+	mu    sync.Mutex
+	locks map[string]*userLock
+}
+
+type userLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the user and returns the func to unlock.
+func (ul *userLocks) lock(userID string) func() {
+	ul.mu.Lock()
+	if ul.locks == nil {
+		ul.locks = map[string]*userLock{}
+	}
+	l, found := ul.locks[userID]
+	if !found {
+		l = &userLock{}
+		ul.locks[userID] = l
+	}
+	l.refs++
+	ul.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		ul.mu.Lock()
+		defer ul.mu.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(ul.locks, userID)
+		}
+	}
+}
+
+func (app *appForge) currentUser(r *http.Request) (*core.User, error) {
+	rc := core.FromCtx(r.Context())
+	return app.users.Get(r.Context(), core.NewAuthKey(core.KeyKindID, rc.Session.User.ID))
+}
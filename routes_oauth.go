@@ -0,0 +1,259 @@
+package forge
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/forge/builtins/oauth"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/servio"
+	"github.com/spy16/forge/core/strutils"
+)
+
+const (
+	tokenKindOAuthState = "oauth_state"
+	oauthStateCookie    = "_forge_oauth_state"
+	oauthStateTTL       = 10 * time.Minute
+)
+
+var (
+	providerNamePattern = regexp.MustCompile(`^[A-Za-z_]+$`)
+
+	errOAuthState = errors.InvalidInput.Coded("invalid_state")
+)
+
+// oauthProviders loads the providers listed in 'oauth.providers'. Config
+// of each provider is read from 'oauth.<name>' on top of the preset for
+// well-known providers.
+func (app *appForge) oauthProviders() (map[string]*oauth.Provider, error) {
+	names := app.confL.Strings("oauth.providers", nil)
+	if len(names) == 0 {
+		return nil, nil
+	} else if app.sessions == nil || app.users == nil || app.tokens == nil {
+		return nil, errors.InvalidInput.Hintf("oauth login requires sessions, users and tokens to be set")
+	}
+
+	providers := map[string]*oauth.Provider{}
+	for _, name := range names {
+		if !providerNamePattern.MatchString(name) {
+			return nil, errors.InvalidInput.Hintf("invalid oauth provider name '%s'", name)
+		}
+
+		p, _ := oauth.Preset(name)
+		p.Name = name
+
+		prefix := "oauth." + name + "."
+		p.ClientID = app.confL.String(prefix+"client_id", "")
+		p.ClientSecret = app.confL.String(prefix+"client_secret", "")
+		p.AuthURL = app.confL.String(prefix+"auth_url", p.AuthURL)
+		p.TokenURL = app.confL.String(prefix+"token_url", p.TokenURL)
+		p.UserInfoURL = app.confL.String(prefix+"userinfo_url", p.UserInfoURL)
+		p.Scopes = app.confL.Strings(prefix+"scopes", p.Scopes)
+		p.IDField = app.confL.String(prefix+"id_field", p.IDField)
+		p.EmailField = app.confL.String(prefix+"email_field", p.EmailField)
+		p.VerifiedField = app.confL.String(prefix+"verified_field", p.VerifiedField)
+		p.EmailsURL = app.confL.String(prefix+"emails_url", p.EmailsURL)
+
+		if mappings := app.confL.Strings(prefix+"data", nil); len(mappings) > 0 {
+			p.Data = map[string]string{}
+			for _, mapping := range mappings {
+				field, key, ok := strings.Cut(mapping, "=")
+				if !ok || field == "" || key == "" {
+					return nil, errors.InvalidInput.Hintf("%sdata entry '%s' must be of the form 'field=key'", prefix, mapping)
+				}
+				p.Data[field] = key
+			}
+		}
+
+		if p.ClientID == "" || p.AuthURL == "" || p.TokenURL == "" || p.UserInfoURL == "" {
+			return nil, errors.InvalidInput.Hintf("oauth provider '%s' needs client_id, auth_url, token_url and userinfo_url", name)
+		}
+		providers[name] = &p
+	}
+	return providers, nil
+}
+
+func (app *appForge) oauthRoutes(r chi.Router, providers map[string]*oauth.Provider) {
+	cookieName := app.confL.String("auth.cookie_name", "_forge_auth")
+	defRedirect := app.confL.String("oauth.redirect_url", "/")
+
+	providerOf := func(r *http.Request) (*oauth.Provider, error) {
+		name := chi.URLParam(r, "provider")
+		p, found := providers[name]
+		if !found {
+			return nil, errors.NotFound.Hintf("oauth provider '%s' not found", name)
+		}
+		return p, nil
+	}
+
+	callbackURL := func(p *oauth.Provider) string {
+		return baseURL(app.confL) + defRoutePrefix + "/oauth/" + p.Name + "/callback"
+	}
+
+	// start the authorization code flow. if the request carries a valid
+	// session, the provider identity is linked to the current user.
+	r.Get("/{provider}/start", func(w http.ResponseWriter, r *http.Request) {
+		p, err := providerOf(r)
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		redirect := r.URL.Query().Get("redirect")
+		if redirect != "" && !app.isSafeRedirect(redirect) {
+			servio.JSONErr(w, r, errors.InvalidInput.Hintf("redirect must be a path or a url on the same origin"))
+			return
+		}
+
+		attribs := core.M{"provider": p.Name, "redirect": redirect}
+		if sess, err := app.sessionFrom(r, cookieName); err == nil && !sess.Partial && sess.APIKey == nil && sess.Actor == nil {
+			attribs["link_user_id"] = sess.User.ID
+		}
+
+		state := strutils.RandToken(32)
+		verifier, challenge := oauth.NewPKCE()
+		attribs["verifier"] = verifier
+
+		tok := core.Token{
+			Kind:      tokenKindOAuthState,
+			Hash:      core.HashToken(state),
+			Attribs:   attribs,
+			ExpiresAt: time.Now().Add(oauthStateTTL),
+		}
+		if err := app.tokens.Put(r.Context(), tok); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		// lax so that the cookie is sent on the redirect from the provider.
+		stateCookie := app.baseCookie(oauthStateCookie, state, defRoutePrefix+"/oauth")
+		stateCookie.Expires = tok.ExpiresAt
+		stateCookie.SameSite = http.SameSiteLaxMode
+		http.SetCookie(w, stateCookie)
+		http.Redirect(w, r, p.AuthCodeURL(state, challenge, callbackURL(p)), http.StatusFound)
+	})
+
+	// complete the flow and issue a forge session as cookie.
+	r.Get("/{provider}/callback", func(w http.ResponseWriter, r *http.Request) {
+		p, err := providerOf(r)
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		q := r.URL.Query()
+		if e := q.Get("error"); e != "" {
+			servio.JSONErr(w, r, errors.MissingAuth.Coded("oauth_failed").Hintf("%s: %s", e, q.Get("error_description")))
+			return
+		}
+
+		state := q.Get("state")
+		stateCookie, err := r.Cookie(oauthStateCookie)
+		if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(stateCookie.Value), []byte(state)) != 1 {
+			servio.JSONErr(w, r, errOAuthState.Hintf("state does not match"))
+			return
+		}
+
+		// clear the state cookie.
+		cleared := app.baseCookie(oauthStateCookie, "", defRoutePrefix+"/oauth")
+		cleared.MaxAge = -1
+		cleared.SameSite = http.SameSiteLaxMode
+		http.SetCookie(w, cleared)
+
+		tok, err := app.tokens.Take(r.Context(), tokenKindOAuthState, core.HashToken(state))
+		if err != nil {
+			if errors.Is(err, errors.NotFound) {
+				err = errOAuthState.Hintf("unknown or expired state")
+			}
+			servio.JSONErr(w, r, err)
+			return
+		} else if provider, _ := tok.Attribs["provider"].(string); provider != p.Name {
+			servio.JSONErr(w, r, errOAuthState.Hintf("state was issued for another provider"))
+			return
+		}
+
+		verifier, _ := tok.Attribs["verifier"].(string)
+		accessToken, err := p.Exchange(r.Context(), q.Get("code"), verifier, callbackURL(p))
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		ident, err := p.Identity(r.Context(), accessToken)
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		providerKey := core.NewAuthKey(p.Name, ident.ID)
+
+		var u *core.User
+		if linkUserID, _ := tok.Attribs["link_user_id"].(string); linkUserID != "" {
+			key := core.UserKey{AuthKey: providerKey, Attribs: core.M{"provider": p.Name}}
+			if err := app.users.AttachKey(r.Context(), linkUserID, key); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+			u, err = app.users.Get(r.Context(), core.NewAuthKey(core.KeyKindID, linkUserID))
+		} else if ident.VerifiedAt == nil && app.isNewIdentity(r, providerKey) {
+			// the unverified email may belong to someone else and must
+			// not be registered on a new account.
+			err = errors.Forbidden.Coded("unverified_email").Hintf("provider '%s' did not return a verified email", p.Name)
+		} else {
+			u, err = core.UpsertIdentity(r.Context(), app.users, providerKey, *ident)
+		}
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		sess, err := app.sessions.Issue(r.Context(), *u)
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		} else if err := app.attachRefresh(w, r, sess); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		app.setAuthCookie(w, sess)
+		app.onLogin(r.Context(), sess, "oauth:"+p.Name)
+
+		redirect, _ := tok.Attribs["redirect"].(string)
+		if redirect == "" {
+			redirect = defRedirect
+		}
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+}
+
+// isNewIdentity returns true if no user is linked to the provider key.
+func (app *appForge) isNewIdentity(r *http.Request, providerKey string) bool {
+	_, err := app.users.Get(r.Context(), providerKey)
+	return errors.Is(err, errors.NotFound)
+}
+
+// isSafeRedirect returns true if the target is a relative path or a url
+// on the same origin as the base url.
+func (app *appForge) isSafeRedirect(target string) bool {
+	if strings.HasPrefix(target, "/") {
+		return !strings.HasPrefix(target, "//") && !strings.HasPrefix(target, "/\\")
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	base, err := url.Parse(baseURL(app.confL))
+	if err != nil {
+		return false
+	}
+	return u.Scheme == base.Scheme && u.Host == base.Host
+}
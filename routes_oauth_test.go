@@ -0,0 +1,285 @@
+package forge_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge"
+	"github.com/spy16/forge/builtins/memstore"
+	"github.com/spy16/forge/core/session"
+)
+
+func TestOAuth_Flow(t *testing.T) {
+	t.Parallel()
+
+	idp := newMockIdP(t)
+	app := newOAuthApp(t, idp)
+
+	t.Run("Success", func(t *testing.T) {
+		state, cookie := startOAuth(t, app, idp, "mock", "alice", true)
+
+		rec := callback(app, "mock", "code-alice", state, cookie)
+		require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+		assert.Equal(t, "/", rec.Header().Get("Location"))
+		assert.NotEmpty(t, authCookie(rec))
+	})
+
+	t.Run("StateMismatch", func(t *testing.T) {
+		state, _ := startOAuth(t, app, idp, "mock", "alice", true)
+		_, otherCookie := startOAuth(t, app, idp, "mock", "alice", true)
+
+		rec := callback(app, "mock", "code-alice", state, otherCookie)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "invalid_state")
+		assert.Empty(t, authCookie(rec))
+	})
+
+	t.Run("CrossProviderState", func(t *testing.T) {
+		state, cookie := startOAuth(t, app, idp, "other", "alice", true)
+
+		rec := callback(app, "mock", "code-alice", state, cookie)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "invalid_state")
+		assert.Empty(t, authCookie(rec))
+	})
+
+	t.Run("StateReused", func(t *testing.T) {
+		state, cookie := startOAuth(t, app, idp, "mock", "alice", true)
+
+		rec := callback(app, "mock", "code-alice", state, cookie)
+		require.Equal(t, http.StatusFound, rec.Code)
+
+		rec = callback(app, "mock", "code-alice", state, cookie)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("UnverifiedEmail", func(t *testing.T) {
+		state, cookie := startOAuth(t, app, idp, "mock", "mallory", false)
+
+		rec := callback(app, "mock", "code-mallory", state, cookie)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), "unverified_email")
+	})
+}
+
+func TestOAuth_StateCookie(t *testing.T) {
+	t.Parallel()
+
+	idp := newMockIdP(t)
+	app := newOAuthApp(t, idp, testConf{
+		"auth.cookie.domain": "forge.test",
+		"auth.cookie.secure": true,
+	})
+
+	// the state cookie follows the cookie configs.
+	_, cookie := startOAuth(t, app, idp, "mock", "alice", true)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, "forge.test", cookie.Domain)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+}
+
+// startOAuth starts the flow and registers the code for the user with the
+// PKCE challenge sent to the provider.
+func startOAuth(t *testing.T, app http.Handler, idp *mockIdP, provider, user string, verified bool) (string, *http.Cookie) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/forge/oauth/"+provider+"/start", nil))
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	q := loc.Query()
+	require.Equal(t, "S256", q.Get("code_challenge_method"))
+
+	idp.grant("code-"+user, q.Get("code_challenge"), user, verified)
+
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "_forge_oauth_state" {
+			cookie = c
+		}
+	}
+	require.NotNil(t, cookie)
+	require.Equal(t, q.Get("state"), cookie.Value)
+	return q.Get("state"), cookie
+}
+
+func callback(app http.Handler, provider, code, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	q := url.Values{"code": {code}, "state": {state}}
+	req := httptest.NewRequest(http.MethodGet, "/forge/oauth/"+provider+"/callback?"+q.Encode(), nil)
+	req.AddCookie(cookie)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func authCookie(rec *httptest.ResponseRecorder) string {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "_forge_auth" {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+func newOAuthApp(t *testing.T, idp *mockIdP, extra ...testConf) chi.Router {
+	t.Helper()
+
+	conf := testConf{
+		"base_url":         "http://forge.test",
+		"oauth.providers":  []string{"mock", "other"},
+		"webauthn.enabled": false,
+	}
+	for _, e := range extra {
+		for k, v := range e {
+			conf[k] = v
+		}
+	}
+	for _, name := range []string{"mock", "other"} {
+		conf["oauth."+name+".client_id"] = "client"
+		conf["oauth."+name+".auth_url"] = idp.URL + "/authorize"
+		conf["oauth."+name+".token_url"] = idp.URL + "/token"
+		conf["oauth."+name+".userinfo_url"] = idp.URL + "/userinfo"
+		conf["oauth."+name+".verified_field"] = "email_verified"
+	}
+
+	app, err := forge.Forge("forgetest",
+		forge.WithConfLoader(conf),
+		forge.WithPreHook(func(app forge.PreContext) error {
+			iss, err := session.FromConfig(conf)
+			if err != nil {
+				return err
+			}
+			app.SetSessions(iss)
+			app.SetAuth(iss)
+			app.SetUsers(memstore.NewUsers())
+			app.SetTokens(memstore.NewTokens())
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+	return app
+}
+
+// mockIdP is an oauth provider that issues access tokens for the codes
+// granted by the test, only if the PKCE verifier matches the challenge.
+type mockIdP struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	grants map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	user      string
+	verified  bool
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	idp := &mockIdP{grants: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+
+		idp.mu.Lock()
+		g, found := idp.grants[r.PostForm.Get("code")]
+		idp.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !found || base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "at-" + r.PostForm.Get("code")})
+	})
+
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		code := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer at-")
+
+		idp.mu.Lock()
+		g, found := idp.grants[code]
+		idp.mu.Unlock()
+
+		if !found {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"sub":            g.user,
+			"email":          g.user + "@example.com",
+			"email_verified": g.verified,
+		})
+	})
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *mockIdP) grant(code, challenge, user string, verified bool) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.grants[code] = mockGrant{challenge: challenge, user: user, verified: verified}
+}
+
+// testConf is a config loader backed by a map.
+type testConf map[string]any
+
+func (c testConf) Int(key string, defVal int) int {
+	if v, ok := c[key].(int); ok {
+		return v
+	}
+	return defVal
+}
+
+func (c testConf) Bool(key string, defVal bool) bool {
+	if v, ok := c[key].(bool); ok {
+		return v
+	}
+	return defVal
+}
+
+func (c testConf) String(key string, defVal string) string {
+	if v, ok := c[key].(string); ok {
+		return v
+	}
+	return defVal
+}
+
+func (c testConf) Strings(key string, defVal []string) []string {
+	if v, ok := c[key].([]string); ok {
+		return v
+	}
+	return defVal
+}
+
+func (c testConf) Float64(key string, defVal float64) float64 {
+	if v, ok := c[key].(float64); ok {
+		return v
+	}
+	return defVal
+}
+
+func (c testConf) Duration(key string, defVal time.Duration) time.Duration {
+	if v, ok := c[key].(time.Duration); ok {
+		return v
+	}
+	return defVal
+}
@@ -0,0 +1,390 @@
+package forge
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/servio"
+	"github.com/spy16/forge/core/strutils"
+)
+
+const tokenKindOrgInvite = "org_invite"
+
+const inviteMailBody = `Hello,
+
+%s has invited you to join '%s' as %s. Visit the link below to accept
+the invitation:
+
+%s
+
+The link expires at %s. If you were not expecting this, ignore this email.
+`
+
+var errOrgRole = errors.Forbidden.Coded("insufficient_org_role")
+
+func (app *appForge) orgRoutes(r chi.Router) {
+	r.Use(app.Authenticate())
+
+	// list orgs of the current user.
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		type orgMembership struct {
+			Org  core.Org `json:"org"`
+			Role string   `json:"role"`
+		}
+
+		rc := core.FromCtx(r.Context())
+		memberships, err := app.orgs.UserOrgs(r.Context(), rc.Session.User.ID)
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		res := []orgMembership{}
+		for _, m := range memberships {
+			org, err := app.orgs.Get(r.Context(), m.OrgID)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+			res = append(res, orgMembership{Org: *org, Role: m.Role})
+		}
+		servio.JSON(w, r, http.StatusOK, res)
+	})
+
+	// create a new org with the current user as the owner.
+	r.With(denyImpersonation).Post("/", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Slug string `json:"slug"`
+			Name string `json:"name"`
+		}
+		if err := servio.BindJSON(r, &req); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		org, err := app.orgs.Upsert(r.Context(), core.NewOrg(req.Slug, req.Name))
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		rc := core.FromCtx(r.Context())
+		owner := core.Membership{OrgID: org.ID, UserID: rc.Session.User.ID, Role: core.OrgRoleOwner}
+		if err := app.orgs.PutMember(r.Context(), owner); err != nil {
+			_ = app.orgs.Delete(r.Context(), org.ID)
+			servio.JSONErr(w, r, err)
+			return
+		}
+		servio.JSON(w, r, http.StatusCreated, org)
+	})
+
+	r.With(denyImpersonation).Post("/invites/accept", app.acceptInvite)
+
+	r.Route("/{org}", func(r chi.Router) {
+		r.Use(app.ResolveOrg())
+
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			servio.JSON(w, r, http.StatusOK, core.FromCtx(r.Context()).Org)
+		})
+
+		r.With(denyImpersonation).Patch("/", func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Name *string `json:"name"`
+				Data core.M  `json:"data"`
+			}
+			if err := servio.BindJSON(r, &req); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			rc := core.FromCtx(r.Context())
+			if !rc.Member.HasRole(core.OrgRoleAdmin) {
+				servio.JSONErr(w, r, errOrgRole.Hintf("only admins can update the org"))
+				return
+			}
+
+			org := *rc.Org
+			if org.Data == nil {
+				org.Data = core.M{}
+			}
+			if req.Name != nil {
+				org.Name = strings.TrimSpace(*req.Name)
+			}
+			for k, v := range req.Data {
+				org.Data[k] = v
+			}
+
+			updated, err := app.orgs.Upsert(r.Context(), org)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+			servio.JSON(w, r, http.StatusOK, updated)
+		})
+
+		r.With(denyImpersonation).Delete("/", func(w http.ResponseWriter, r *http.Request) {
+			rc := core.FromCtx(r.Context())
+			if !rc.Member.HasRole(core.OrgRoleOwner) {
+				servio.JSONErr(w, r, errOrgRole.Hintf("only owners can delete the org"))
+				return
+			}
+
+			if err := app.orgs.Delete(r.Context(), rc.Org.ID); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+			servio.JSON(w, r, http.StatusNoContent, nil)
+		})
+
+		r.Get("/members", func(w http.ResponseWriter, r *http.Request) {
+			members, err := app.orgs.Members(r.Context(), core.FromCtx(r.Context()).Org.ID)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+			servio.JSON(w, r, http.StatusOK, members)
+		})
+
+		r.With(denyImpersonation).Put("/members/{user_id}", func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Role string `json:"role"`
+			}
+			if err := servio.BindJSON(r, &req); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			target, err := app.manageableMember(r, chi.URLParam(r, "user_id"))
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			rc := core.FromCtx(r.Context())
+			if !rc.Member.HasRole(req.Role) {
+				servio.JSONErr(w, r, errOrgRole.Hintf("cannot grant a role higher than own"))
+				return
+			}
+
+			if target.Role == core.OrgRoleOwner && req.Role != core.OrgRoleOwner {
+				if err := app.ensureOtherOwner(r, target.UserID); err != nil {
+					servio.JSONErr(w, r, err)
+					return
+				}
+			}
+
+			target.Role = req.Role
+			if err := app.orgs.PutMember(r.Context(), *target); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+			servio.JSON(w, r, http.StatusOK, target)
+		})
+
+		r.With(denyImpersonation).Delete("/members/{user_id}", func(w http.ResponseWriter, r *http.Request) {
+			target, err := app.manageableMember(r, chi.URLParam(r, "user_id"))
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			if target.Role == core.OrgRoleOwner {
+				if err := app.ensureOtherOwner(r, target.UserID); err != nil {
+					servio.JSONErr(w, r, err)
+					return
+				}
+			}
+
+			if err := app.orgs.RemoveMember(r.Context(), target.OrgID, target.UserID); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+			servio.JSON(w, r, http.StatusNoContent, nil)
+		})
+
+		r.With(denyImpersonation).Post("/invites", app.createInvite)
+
+		if app.apiKeys != nil {
+			r.Get("/api-keys", func(w http.ResponseWriter, r *http.Request) {
+				rc := core.FromCtx(r.Context())
+				if !rc.Member.HasRole(core.OrgRoleAdmin) {
+					servio.JSONErr(w, r, errOrgRole.Hintf("only admins can list api keys of the org"))
+					return
+				}
+
+				keys, err := app.apiKeys.List(r.Context(), "", rc.Org.ID)
+				if err != nil {
+					servio.JSONErr(w, r, err)
+					return
+				}
+
+				if keys == nil {
+					keys = []core.APIKey{}
+				}
+				servio.JSON(w, r, http.StatusOK, keys)
+			})
+		}
+	})
+}
+
+func (app *appForge) createInvite(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := servio.BindJSON(r, &req); err != nil {
+		servio.JSONErr(w, r, err)
+		return
+	}
+
+	if app.tokens == nil || app.mailer == nil {
+		servio.JSONErr(w, r, errors.Unsupported.Hintf("invites are not enabled"))
+		return
+	}
+
+	rc := core.FromCtx(r.Context())
+	if req.Role == "" {
+		req.Role = core.OrgRoleMember
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if !strutils.IsValidEmail(email) {
+		servio.JSONErr(w, r, errors.InvalidInput.Hintf("invalid email"))
+		return
+	} else if !core.ValidOrgRole(req.Role) {
+		servio.JSONErr(w, r, errors.InvalidInput.Hintf("invalid role '%s'", req.Role))
+		return
+	} else if !rc.Member.HasRole(core.OrgRoleAdmin) || !rc.Member.HasRole(req.Role) {
+		servio.JSONErr(w, r, errOrgRole.Hintf("not allowed to invite as '%s'", req.Role))
+		return
+	}
+
+	ttl := app.confL.Duration("orgs.invite_ttl", 7*24*time.Hour)
+	raw, tok := core.NewToken(tokenKindOrgInvite, rc.Session.User.ID, ttl)
+	tok.Attribs = core.M{
+		"org_id": rc.Org.ID,
+		"email":  email,
+		"role":   req.Role,
+	}
+	if err := app.tokens.Put(r.Context(), tok); err != nil {
+		servio.JSONErr(w, r, err)
+		return
+	}
+
+	link := fmt.Sprintf("%s?%s",
+		app.confL.String("orgs.invite_url", baseURL(app.confL)+"/invites/accept"),
+		url.Values{"token": {raw}}.Encode(),
+	)
+
+	if err := app.mailer.Send(r.Context(), core.Mail{
+		To:      []string{email},
+		Subject: fmt.Sprintf("You are invited to join %s", rc.Org.Name),
+		Body: fmt.Sprintf(inviteMailBody, rc.Session.User.Username, rc.Org.Name,
+			req.Role, link, tok.ExpiresAt.Format(time.RFC1123)),
+	}); err != nil {
+		servio.JSONErr(w, r, err)
+		return
+	}
+	servio.JSON(w, r, http.StatusNoContent, nil)
+}
+
+func (app *appForge) acceptInvite(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := servio.BindJSON(r, &req); err != nil {
+		servio.JSONErr(w, r, err)
+		return
+	}
+
+	if app.tokens == nil {
+		servio.JSONErr(w, r, errors.Unsupported.Hintf("invites are not enabled"))
+		return
+	}
+
+	tok, err := app.tokens.Take(r.Context(), tokenKindOrgInvite, core.HashToken(req.Token))
+	if err != nil {
+		if errors.Is(err, errors.NotFound) {
+			err = errors.InvalidInput.Coded("invalid_token").Hintf("unknown or expired invite")
+		}
+		servio.JSONErr(w, r, err)
+		return
+	}
+
+	rc := core.FromCtx(r.Context())
+	email, _ := tok.Attribs["email"].(string)
+	if !strings.EqualFold(email, rc.Session.User.Email) {
+		// restore the token so that the invitee can still accept it.
+		_ = app.tokens.Put(r.Context(), *tok)
+		servio.JSONErr(w, r, errors.Forbidden.Coded("invite_mismatch").Hintf("invite was sent to a different email"))
+		return
+	}
+
+	orgID, _ := tok.Attribs["org_id"].(string)
+	role, _ := tok.Attribs["role"].(string)
+
+	m := core.Membership{OrgID: orgID, UserID: rc.Session.User.ID, Role: role}
+	if existing, err := app.orgs.Member(r.Context(), orgID, m.UserID); err == nil {
+		if existing.HasRole(role) {
+			servio.JSONErr(w, r, errors.Conflict.Coded("already_member").Hintf("already a member of the org"))
+			return
+		}
+	} else if !errors.Is(err, errors.NotFound) {
+		servio.JSONErr(w, r, err)
+		return
+	}
+
+	if err := app.orgs.PutMember(r.Context(), m); err != nil {
+		servio.JSONErr(w, r, err)
+		return
+	}
+
+	joined, err := app.orgs.Member(r.Context(), orgID, m.UserID)
+	if err != nil {
+		servio.JSONErr(w, r, err)
+		return
+	}
+	servio.JSON(w, r, http.StatusOK, joined)
+}
+
+// manageableMember returns the membership of the user in the current org
+// if the current user is allowed to manage it. Users can always manage
+// their own membership (e.g., to leave the org).
+func (app *appForge) manageableMember(r *http.Request, userID string) (*core.Membership, error) {
+	rc := core.FromCtx(r.Context())
+
+	target, err := app.orgs.Member(r.Context(), rc.Org.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if userID != rc.Session.User.ID {
+		if !rc.Member.HasRole(core.OrgRoleAdmin) || !rc.Member.HasRole(target.Role) {
+			return nil, errOrgRole.Hintf("not allowed to manage this member")
+		}
+	}
+	return target, nil
+}
+
+// ensureOtherOwner returns error if the user is the only owner of the
+// current org.
+func (app *appForge) ensureOtherOwner(r *http.Request, userID string) error {
+	members, err := app.orgs.Members(r.Context(), core.FromCtx(r.Context()).Org.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range members {
+		if m.Role == core.OrgRoleOwner && m.UserID != userID {
+			return nil
+		}
+	}
+	return errors.Conflict.Coded("last_owner").Hintf("org must have at least one owner")
+}
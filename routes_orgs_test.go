@@ -0,0 +1,94 @@
+package forge_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spy16/forge"
+	"github.com/spy16/forge/builtins/memstore"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/session"
+)
+
+func TestOrgs_Impersonation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conf := testConf{"webauthn.enabled": false}
+	users, orgs := memstore.NewUsers(), memstore.NewOrgs()
+
+	var iss *session.Issuer
+	app, err := forge.Forge("forgetest",
+		forge.WithConfLoader(conf),
+		forge.WithPreHook(func(app forge.PreContext) error {
+			var err error
+			if iss, err = session.FromConfig(conf); err != nil {
+				return err
+			}
+			app.SetSessions(iss)
+			app.SetAuth(iss)
+			app.SetUsers(users)
+			app.SetOrgs(orgs)
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+
+	bob, err := users.Upsert(ctx, core.NewUser("", "bob", "bob@bobmail.com"))
+	require.NoError(t, err)
+	alice, err := users.Upsert(ctx, core.NewUser("", "alice", "alice@bobmail.com"))
+	require.NoError(t, err)
+
+	acme, err := orgs.Upsert(ctx, core.NewOrg("acme", "Acme Inc"))
+	require.NoError(t, err)
+	require.NoError(t, orgs.PutMember(ctx, core.Membership{OrgID: acme.ID, UserID: bob.ID, Role: core.OrgRoleOwner}))
+	require.NoError(t, orgs.PutMember(ctx, core.Membership{OrgID: acme.ID, UserID: alice.ID, Role: core.OrgRoleMember}))
+
+	impersonated, err := iss.Impersonate(ctx, *bob, core.Actor{ID: "support"}, false)
+	require.NoError(t, err)
+
+	// reading is allowed while impersonating.
+	rec := doRequest(app, impersonated.Token, http.MethodGet, "/forge/orgs/acme", "")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	for _, tt := range []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/forge/orgs", `{"slug":"other","name":"Other"}`},
+		{http.MethodPatch, "/forge/orgs/acme", `{"name":"Evil Inc"}`},
+		{http.MethodPut, "/forge/orgs/acme/members/" + alice.ID, `{"role":"owner"}`},
+		{http.MethodDelete, "/forge/orgs/acme/members/" + alice.ID, ""},
+		{http.MethodPost, "/forge/orgs/acme/invites", `{"email":"eve@bobmail.com","role":"admin"}`},
+		{http.MethodDelete, "/forge/orgs/acme", ""},
+	} {
+		rec := doRequest(app, impersonated.Token, tt.method, tt.path, tt.body)
+		assert.Equal(t, http.StatusForbidden, rec.Code, tt.method+" "+tt.path)
+		assert.Contains(t, rec.Body.String(), "impersonation_not_allowed")
+	}
+
+	_, err = orgs.Get(ctx, acme.ID)
+	assert.NoError(t, err)
+
+	// the owner can still make the changes.
+	sess, err := iss.Issue(ctx, *bob)
+	require.NoError(t, err)
+	rec = doRequest(app, sess.Token, http.MethodDelete, "/forge/orgs/acme", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+}
+
+func doRequest(app chi.Router, token, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
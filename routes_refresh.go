@@ -0,0 +1,108 @@
+package forge
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/servio"
+	"github.com/spy16/forge/core/session"
+)
+
+const refreshPath = defRoutePrefix + "/auth/refresh"
+
+// newRefresher returns the refresher if refresh tokens are enabled. Refresh
+// tokens need tracked sessions.
+func (app *appForge) newRefresher() *session.Refresher {
+	if !app.confL.Bool("session.refresh.enabled", true) {
+		return nil
+	} else if app.sessions == nil || app.sessStore == nil || app.tokens == nil || app.users == nil {
+		return nil
+	}
+
+	return &session.Refresher{
+		Issuer: app.sessions,
+		Tokens: app.tokens,
+		Users:  app.users,
+		TTL:    app.refreshTTL(),
+	}
+}
+
+func (app *appForge) refreshRoutes(r chi.Router) {
+	r.Post("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		var raw string
+		if c, err := r.Cookie(app.refreshCookieName()); err == nil && c.Value != "" {
+			raw = c.Value
+		} else {
+			var req struct {
+				RefreshToken string `json:"refresh_token"`
+			}
+			if err := servio.BindJSON(r, &req); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+			raw = strings.TrimSpace(req.RefreshToken)
+		}
+
+		if raw == "" {
+			servio.JSONErr(w, r, errors.MissingAuth.Coded("invalid_refresh_token").Hintf("refresh token is not set"))
+			return
+		}
+
+		sess, err := app.refresher.Refresh(r.Context(), raw)
+		if err != nil {
+			if errors.Is(err, errors.MissingAuth) {
+				app.clearRefreshCookie(w)
+			}
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		app.setRefreshCookie(w, sess.RefreshToken)
+		if app.cookieMode() {
+			app.setAuthCookie(w, sess)
+		}
+		servio.JSON(w, r, http.StatusOK, sess)
+	})
+}
+
+// attachRefresh issues a refresh token for the new session and sets it
+// as a cookie scoped to the refresh route. No-op if refresh is disabled
+// or the session is partial.
+func (app *appForge) attachRefresh(w http.ResponseWriter, r *http.Request, sess *core.Session) error {
+	if app.refresher == nil || sess.Partial {
+		return nil
+	}
+
+	if err := app.refresher.Attach(r.Context(), sess); err != nil {
+		return err
+	}
+	app.setRefreshCookie(w, sess.RefreshToken)
+	return nil
+}
+
+func (app *appForge) setRefreshCookie(w http.ResponseWriter, raw string) {
+	c := app.baseCookie(app.refreshCookieName(), raw, refreshPath)
+	c.Expires = time.Now().Add(app.refreshTTL())
+	c.SameSite = http.SameSiteStrictMode
+	http.SetCookie(w, c)
+}
+
+func (app *appForge) clearRefreshCookie(w http.ResponseWriter) {
+	c := app.baseCookie(app.refreshCookieName(), "", refreshPath)
+	c.MaxAge = -1
+	c.SameSite = http.SameSiteStrictMode
+	http.SetCookie(w, c)
+}
+
+func (app *appForge) refreshCookieName() string {
+	return app.confL.String("session.refresh.cookie_name", "_forge_refresh")
+}
+
+func (app *appForge) refreshTTL() time.Duration {
+	return app.confL.Duration("session.refresh.ttl", 30*24*time.Hour)
+}
@@ -0,0 +1,75 @@
+package forge
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/servio"
+)
+
+func (app *appForge) sessionRoutes(r chi.Router) {
+	r.Use(app.Authenticate(), denyAPIKeys)
+
+	type sessionInfo struct {
+		core.SessionRecord
+		Current bool `json:"current"`
+	}
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		rc := core.FromCtx(r.Context())
+		recs, err := app.sessStore.List(r.Context(), rc.Session.User.ID)
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		res := []sessionInfo{}
+		for _, rec := range recs {
+			res = append(res, sessionInfo{
+				SessionRecord: rec,
+				Current:       rec.ID == rc.Session.ID,
+			})
+		}
+		servio.JSON(w, r, http.StatusOK, res)
+	})
+
+	// logout everywhere. the current session is kept if 'except_current'
+	// is set.
+	r.With(denyImpersonation).Delete("/", func(w http.ResponseWriter, r *http.Request) {
+		rc := core.FromCtx(r.Context())
+
+		var except []string
+		if r.URL.Query().Get("except_current") == "true" {
+			except = append(except, rc.Session.ID)
+		}
+
+		if err := app.sessStore.RevokeUser(r.Context(), rc.Session.User.ID, except...); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+		servio.JSON(w, r, http.StatusNoContent, nil)
+	})
+
+	r.With(denyImpersonation).Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		rc := core.FromCtx(r.Context())
+
+		rec, err := app.sessStore.Get(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		} else if rec.UserID != rc.Session.User.ID {
+			// do not reveal sessions of other users.
+			servio.JSONErr(w, r, errors.NotFound.Hintf("session '%s' not found", rec.ID))
+			return
+		}
+
+		if err := app.sessStore.Revoke(r.Context(), rec.ID); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+		servio.JSON(w, r, http.StatusNoContent, nil)
+	})
+}
@@ -0,0 +1,212 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/forge/builtins/password"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/log"
+	"github.com/spy16/forge/core/servio"
+)
+
+const verifyMailBody = `Hello %s,
+
+Please verify your email by visiting the link below:
+
+%s
+
+The link expires at %s. If you did not sign up, ignore this email.
+`
+
+var emailChangePage = template.Must(template.New("email_change").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Confirm email change</title></head>
+<body>
+<form method="post">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Confirm the new email</button>
+</form>
+</body>
+</html>
+`))
+
+func (app *appForge) verifyRoutes(r chi.Router) {
+	redirectURL := app.confL.String("auth.verify.redirect_url", "")
+
+	// (re-)send the verification mail to the current user.
+	r.With(app.Authenticate()).Post("/verify", func(w http.ResponseWriter, r *http.Request) {
+		rc := core.FromCtx(r.Context())
+		if err := app.sendVerification(r.Context(), rc.Session.User.ID); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+		servio.JSON(w, r, http.StatusNoContent, nil)
+	})
+
+	// redeem the token from the verification link.
+	r.Get("/verify", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		u, err := app.users.Get(r.Context(), core.NewAuthKey(core.KeyKindID, q.Get("user_id")))
+		if err != nil {
+			if errors.Is(err, errors.NotFound) {
+				err = errors.InvalidInput.Coded("invalid_token").Hintf("unknown user")
+			}
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		if u.VerifiedAt != nil {
+			servio.JSONErr(w, r, errors.Conflict.Coded("already_verified").Hintf("email is already verified"))
+			return
+		} else if err := u.Verify(q.Get("token")); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		if _, err := app.users.Upsert(r.Context(), *u); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		if redirectURL != "" {
+			http.Redirect(w, r, redirectURL, http.StatusFound)
+			return
+		}
+		servio.JSON(w, r, http.StatusNoContent, nil)
+	})
+
+	if app.tokens == nil {
+		return
+	}
+
+	// the link mailed to the new email renders a page that posts the token
+	// back. the change is not applied on GET since mail scanners and
+	// previews follow the links.
+	r.Get("/verify/email", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		_ = emailChangePage.Execute(w, r.URL.Query().Get("token"))
+	})
+
+	// apply the confirmed email change. other sessions of the user and the
+	// pending password resets are revoked.
+	r.Post("/verify/email", func(w http.ResponseWriter, r *http.Request) {
+		errBadToken := errors.InvalidInput.Coded("invalid_token")
+
+		var req struct {
+			Token string `json:"token"`
+		}
+		if isFormPost(r) {
+			req.Token = r.PostFormValue("token")
+		} else if err := servio.BindJSON(r, &req); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		tok, err := app.tokens.Take(r.Context(), tokenKindEmailChange, core.HashToken(req.Token))
+		if err != nil {
+			if errors.Is(err, errors.NotFound) {
+				err = errBadToken.Hintf("unknown or expired token")
+			}
+			servio.JSONErr(w, r, err)
+			return
+		}
+		email, _ := tok.Attribs["email"].(string)
+		sessionID, _ := tok.Attribs["session_id"].(string)
+
+		u, err := app.users.Get(r.Context(), core.NewAuthKey(core.KeyKindID, tok.UserID))
+		if err != nil {
+			if errors.Is(err, errors.NotFound) {
+				err = errBadToken.Hintf("unknown user")
+			}
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		oldEmail := u.Email
+		now := time.Now()
+		u.Email = email
+		u.VerifiedAt = &now
+		u.VerifyToken = nil
+		if _, err := app.users.Upsert(r.Context(), *u); err != nil {
+			if errors.Is(err, errors.Conflict) {
+				err = errEmailTaken
+			}
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		if app.sessStore != nil {
+			if err := app.sessStore.RevokeUser(r.Context(), u.ID, sessionID); err != nil {
+				log.Warn(r.Context(), "failed to revoke sessions", core.M{"error": err.Error()})
+			}
+		}
+		if err := app.tokens.Revoke(r.Context(), password.TokenKindReset, u.ID); err != nil {
+			log.Warn(r.Context(), "failed to revoke password resets", core.M{"error": err.Error()})
+		}
+
+		// let the owner of the old email know in case of a takeover.
+		if err := app.mailer.Send(r.Context(), core.Mail{
+			To:      []string{oldEmail},
+			Subject: "Your email was changed",
+			Body:    fmt.Sprintf(emailChangedMailBody, u.Username, email),
+		}); err != nil {
+			log.Warn(r.Context(), "failed to send email change notice", core.M{"error": err.Error()})
+		}
+
+		app.Audit(r.Context(), core.AuditEvent{
+			Action:   "email.change",
+			ActorID:  u.ID,
+			TargetID: u.ID,
+			Attribs:  core.M{"old_email": oldEmail, "new_email": email},
+		})
+
+		if redirectURL != "" {
+			http.Redirect(w, r, redirectURL, http.StatusFound)
+			return
+		} else if isFormPost(r) {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		servio.JSON(w, r, http.StatusNoContent, nil)
+	})
+}
+
+// sendVerification issues a new verification token for the user and
+// mails the verification link to the user's email.
+func (app *appForge) sendVerification(ctx context.Context, userID string) error {
+	u, err := app.users.Get(ctx, core.NewAuthKey(core.KeyKindID, userID))
+	if err != nil {
+		return err
+	} else if u.VerifiedAt != nil {
+		return errors.Conflict.Coded("already_verified").Hintf("email is already verified")
+	}
+
+	ttl := app.confL.Duration("auth.verify.ttl", 24*time.Hour)
+	token := u.NewVerifyToken(ttl)
+	if _, err := app.users.Upsert(ctx, *u); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s%s/auth/verify?%s",
+		baseURL(app.confL),
+		defRoutePrefix,
+		url.Values{"user_id": {u.ID}, "token": {token}}.Encode(),
+	)
+
+	return app.mailer.Send(ctx, core.Mail{
+		To:      []string{u.Email},
+		Subject: "Verify your email",
+		Body:    fmt.Sprintf(verifyMailBody, u.Username, link, time.Now().Add(ttl).Format(time.RFC1123)),
+	})
+}
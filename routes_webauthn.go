@@ -0,0 +1,371 @@
+package forge
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spy16/forge/builtins/webauthn"
+	"github.com/spy16/forge/core"
+	"github.com/spy16/forge/core/errors"
+	"github.com/spy16/forge/core/servio"
+)
+
+const (
+	keyKindWebAuthn = "webauthn"
+
+	tokenKindWebAuthnReg   = "webauthn_reg"
+	tokenKindWebAuthnLogin = "webauthn_login"
+)
+
+var errWebAuthnChallenge = errors.InvalidInput.Coded("invalid_challenge")
+
+// relyingParty returns the webauthn relying party if passkeys are enabled.
+// The rp id and the allowed origins default to the base url.
+func (app *appForge) relyingParty() (*webauthn.RelyingParty, error) {
+	if !app.confL.Bool("webauthn.enabled", true) {
+		return nil, nil
+	} else if app.sessions == nil || app.users == nil || app.tokens == nil {
+		return nil, nil
+	}
+
+	base, err := url.Parse(baseURL(app.confL))
+	if err != nil {
+		return nil, errors.InvalidInput.CausedBy(err).Hintf("base_url is not a valid url")
+	}
+
+	rp := &webauthn.RelyingParty{
+		ID:                      app.confL.String("webauthn.rp_id", base.Hostname()),
+		Name:                    app.confL.String("webauthn.rp_name", app.name),
+		Origins:                 app.confL.Strings("webauthn.origins", []string{base.Scheme + "://" + base.Host}),
+		RequireUserVerification: app.confL.Bool("webauthn.require_user_verification", false),
+		Timeout:                 app.confL.Duration("webauthn.timeout", 5*time.Minute),
+	}
+	if rp.ID == "" || len(rp.Origins) == 0 {
+		return nil, errors.InvalidInput.Hintf("webauthn needs rp_id and origins")
+	}
+	return rp, nil
+}
+
+func (app *appForge) webauthnRoutes(r chi.Router, rp *webauthn.RelyingParty) {
+	ceremonyTTL := rp.Timeout + time.Minute
+
+	// takeChallenge consumes the ceremony state of the challenge signed by
+	// the authenticator.
+	takeChallenge := func(r *http.Request, kind, challenge string) (*core.Token, error) {
+		if challenge == "" {
+			return nil, errWebAuthnChallenge.Hintf("challenge is not set")
+		}
+
+		tok, err := app.tokens.Take(r.Context(), kind, core.HashToken(challenge))
+		if err != nil {
+			if errors.Is(err, errors.NotFound) {
+				return nil, errWebAuthnChallenge.Hintf("unknown or expired challenge")
+			}
+			return nil, err
+		}
+		return tok, nil
+	}
+
+	putChallenge := func(r *http.Request, kind, userID string) (string, error) {
+		challenge := webauthn.NewChallenge()
+		tok := core.Token{
+			Kind:      kind,
+			Hash:      core.HashToken(challenge),
+			UserID:    userID,
+			ExpiresAt: time.Now().Add(ceremonyTTL),
+		}
+		return challenge, app.tokens.Put(r.Context(), tok)
+	}
+
+	// start passwordless login. the options allow any discoverable
+	// credential of the rp.
+	r.Post("/login/begin", func(w http.ResponseWriter, r *http.Request) {
+		challenge, err := putChallenge(r, tokenKindWebAuthnLogin, "")
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+		servio.JSON(w, r, http.StatusOK, core.M{"publicKey": rp.RequestOptions(challenge, nil)})
+	})
+
+	// complete the login and issue a forge session. user-verifying
+	// authenticators count as multi-factor.
+	r.Post("/login/finish", func(w http.ResponseWriter, r *http.Request) {
+		var resp webauthn.AssertionResponse
+		if err := servio.BindJSON(r, &resp); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		challenge, err := resp.Challenge()
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		} else if _, err := takeChallenge(r, tokenKindWebAuthnLogin, challenge); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		credID, err := resp.CredentialID()
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		u, key, err := app.webauthnCredential(r, credID)
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		if resp.Response.UserHandle != "" {
+			if handle, err := webauthn.Decode(resp.Response.UserHandle); err != nil || string(handle) != u.ID {
+				servio.JSONErr(w, r, errors.MissingAuth.Coded("invalid_webauthn_assertion").Hintf("user handle does not match"))
+				return
+			}
+		}
+
+		res, err := rp.VerifyAssertion(resp, challenge, credentialOf(credID, key))
+		if err != nil {
+			app.auditLoginFailure(r.Context(), u.ID, "webauthn", err, nil)
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		key.Attribs["sign_count"] = int64(res.SignCount)
+		key.Attribs["last_used_at"] = time.Now().UTC()
+		if err := app.users.AttachKey(r.Context(), u.ID, *key); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		var sess *core.Session
+		if res.UserVerified {
+			sess, err = app.sessions.IssueMFA(r.Context(), *u)
+		} else {
+			sess, err = app.sessions.Issue(r.Context(), *u)
+		}
+		if err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		} else if err := app.completeLogin(w, r, sess); err != nil {
+			servio.JSONErr(w, r, err)
+			return
+		}
+
+		app.onLogin(r.Context(), sess, "webauthn")
+		servio.JSON(w, r, http.StatusOK, sess)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(app.Authenticate(), denyAPIKeys, denyImpersonation)
+
+		// start registering a new passkey for the current user.
+		r.Post("/register/begin", func(w http.ResponseWriter, r *http.Request) {
+			u, err := app.currentUser(r)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			keys, err := app.webauthnKeys(r, u.ID)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			var exclude [][]byte
+			for _, key := range keys {
+				_, val := core.SplitAuthKey(key.AuthKey)
+				if id, err := webauthn.Decode(val); err == nil {
+					exclude = append(exclude, id)
+				}
+			}
+
+			challenge, err := putChallenge(r, tokenKindWebAuthnReg, u.ID)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			name := u.Email
+			if u.Username != "" {
+				name = u.Username
+			}
+			opts := rp.CreationOptions(challenge, webauthn.User{ID: u.ID, Name: name, DisplayName: name}, exclude)
+			servio.JSON(w, r, http.StatusOK, core.M{"publicKey": opts})
+		})
+
+		r.Post("/register/finish", func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				webauthn.AttestationResponse
+				Name string `json:"name"`
+			}
+			if err := servio.BindJSON(r, &req); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			challenge, err := req.Challenge()
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			tok, err := takeChallenge(r, tokenKindWebAuthnReg, challenge)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			} else if rc := core.FromCtx(r.Context()); tok.UserID != rc.Session.User.ID {
+				servio.JSONErr(w, r, errWebAuthnChallenge.Hintf("challenge was issued for another user"))
+				return
+			}
+
+			cred, err := rp.VerifyRegistration(req.AttestationResponse, challenge)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			if req.Name == "" {
+				req.Name = "Passkey"
+			}
+			key := core.UserKey{
+				AuthKey: core.NewAuthKey(keyKindWebAuthn, webauthn.Encode(cred.ID)),
+				Attribs: core.M{
+					"name":       req.Name,
+					"public_key": webauthn.Encode(cred.PublicKey),
+					"alg":        int64(cred.Alg),
+					"sign_count": int64(cred.SignCount),
+					"created_at": time.Now().UTC(),
+				},
+			}
+			if err := app.users.AttachKey(r.Context(), tok.UserID, key); err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+			servio.JSON(w, r, http.StatusCreated, passkeyView(key))
+		})
+
+		r.Get("/credentials", func(w http.ResponseWriter, r *http.Request) {
+			keys, err := app.webauthnKeys(r, core.FromCtx(r.Context()).Session.User.ID)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			views := make([]core.M, 0, len(keys))
+			for _, key := range keys {
+				views = append(views, passkeyView(key))
+			}
+			servio.JSON(w, r, http.StatusOK, views)
+		})
+
+		r.Delete("/credentials/{id}", func(w http.ResponseWriter, r *http.Request) {
+			userID := core.FromCtx(r.Context()).Session.User.ID
+			authKey := core.NewAuthKey(keyKindWebAuthn, chi.URLParam(r, "id"))
+
+			keys, err := app.webauthnKeys(r, userID)
+			if err != nil {
+				servio.JSONErr(w, r, err)
+				return
+			}
+
+			for _, key := range keys {
+				if key.AuthKey == authKey {
+					if err := app.users.DetachKey(r.Context(), userID, authKey); err != nil {
+						servio.JSONErr(w, r, err)
+						return
+					}
+					servio.JSON(w, r, http.StatusNoContent, nil)
+					return
+				}
+			}
+			servio.JSONErr(w, r, errors.NotFound.Hintf("passkey not found"))
+		})
+	})
+}
+
+// webauthnCredential returns the owner of the credential and the stored
+// key.
+func (app *appForge) webauthnCredential(r *http.Request, credID []byte) (*core.User, *core.UserKey, error) {
+	errUnknown := errors.MissingAuth.Coded("invalid_webauthn_assertion").Hintf("unknown credential")
+
+	authKey := core.NewAuthKey(keyKindWebAuthn, webauthn.Encode(credID))
+	u, err := app.users.Get(r.Context(), authKey)
+	if err != nil {
+		if errors.Is(err, errors.NotFound) {
+			return nil, nil, errUnknown
+		}
+		return nil, nil, err
+	}
+
+	keys, err := app.webauthnKeys(r, u.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, key := range keys {
+		if key.AuthKey == authKey {
+			// copied since the attribs are updated by the caller.
+			attribs := core.M{}
+			for k, v := range key.Attribs {
+				attribs[k] = v
+			}
+			key.Attribs = attribs
+			return u, &key, nil
+		}
+	}
+	return nil, nil, errUnknown
+}
+
+func (app *appForge) webauthnKeys(r *http.Request, userID string) ([]core.UserKey, error) {
+	keys, err := app.users.Keys(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []core.UserKey
+	for _, key := range keys {
+		if kind, _ := core.SplitAuthKey(key.AuthKey); kind == keyKindWebAuthn {
+			res = append(res, key)
+		}
+	}
+	return res, nil
+}
+
+func credentialOf(credID []byte, key *core.UserKey) webauthn.Credential {
+	cred := webauthn.Credential{ID: credID}
+	if s, ok := key.Attribs["public_key"].(string); ok {
+		cred.PublicKey, _ = webauthn.Decode(s)
+	}
+	cred.Alg = int(attribInt(key.Attribs["alg"]))
+	cred.SignCount = uint32(attribInt(key.Attribs["sign_count"]))
+	return cred
+}
+
+func passkeyView(key core.UserKey) core.M {
+	_, id := core.SplitAuthKey(key.AuthKey)
+	return core.M{
+		"id":           id,
+		"name":         key.Attribs["name"],
+		"created_at":   key.Attribs["created_at"],
+		"last_used_at": key.Attribs["last_used_at"],
+	}
+}
+
+// attribInt returns the integer value of the attribute which may be in
+// its original or json-decoded form.
+func attribInt(v any) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}